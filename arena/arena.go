@@ -0,0 +1,232 @@
+package arena
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Storage interface that is implemented by storage providers
+type Storage struct {
+	segments	[]*segment
+	seed		maphash.Seed
+	codec		storage.Codec
+	clock		storage.Clock
+	done		chan struct{}
+	// largest encoded entry (header, key and value) that fits in a segment
+	maxEntry	int
+}
+
+// Stats counts the outcomes of Get and the entries evicted to make room, along with the current usage
+type Stats struct {
+	Hits		uint64
+	Misses		uint64
+	Evictions	uint64
+	// Number of indexed entries, including expired entries not yet collected
+	Entries		int
+	// Bytes of the ring buffers in use, including entries that were replaced or deleted but not yet overwritten
+	Bytes		int
+}
+
+// New creates a new arena storage, allocating MaxBytes of ring buffers
+func New(config ...Config) *Storage {
+	// Set default config
+	cfg := configDefault(config...)
+
+	segments := 1
+	for segments < cfg.Segments {
+		segments <<= 1
+	}
+
+	// Every segment needs room for at least one header
+	size := cfg.MaxBytes / segments
+	if size < headerSize {
+		size = headerSize
+	}
+
+	// Create storage
+	store := &Storage{
+		segments:	make([]*segment, segments),
+		seed:		maphash.MakeSeed(),
+		codec:		cfg.Codec,
+		clock:		cfg.Clock,
+		done:		make(chan struct{}),
+		maxEntry:	size,
+	}
+	for i := range store.segments {
+		store.segments[i] = newSegment(size)
+	}
+
+	// Start garbage collector, the ticker is created first so that a fake clock can be advanced straight away
+	go store.gc(cfg.Clock.NewTicker(cfg.GCInterval))
+
+	return store
+}
+
+// Get value by key
+func (s *Storage) Get(key string) *storage.Result {
+	return s.GetContext(context.Background(), key)
+}
+
+// Get value by key, the arena storage never blocks so the context is only checked before starting
+func (s *Storage) GetContext(ctx context.Context, key string) *storage.Result {
+	if err := ctx.Err(); err != nil {
+		return &storage.Result{ Value: nil, Error: err, Missed: false }
+	}
+
+	if len(key) <= 0 {
+		return &storage.Result{ Value: nil, Error: errors.New("storage keys cannot be zero length"), Missed: false }
+	}
+
+	hash := maphash.String(s.seed, key)
+	segment := s.segment(hash)
+	data, expiry, ok := segment.get(hash, key)
+
+	if !ok || (expiry != 0 && expiry <= s.clock.Now().UnixMilli()) {
+		segment.misses.Add(1)
+		return &storage.Result{ Value: nil, Error: nil, Missed: true }
+	}
+
+	segment.hits.Add(1)
+
+	value, err := s.codec.Unmarshal(data)
+	if err != nil {
+		return &storage.Result{ Value: nil, Error: err, Missed: false }
+	}
+
+	return &storage.Result{ Value: value, Error: nil, Missed: false }
+}
+
+// Set key with value
+func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
+	return s.SetContext(context.Background(), key, value, expiry...)
+}
+
+// Set key with value, the arena storage never blocks so the context is only checked before starting
+func (s *Storage) SetContext(ctx context.Context, key string, value any, expiry ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(key) <= 0 {
+		return errors.New("storage keys cannot be zero length")
+	}
+
+	exp, err := storage.Expiry(expiry...)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if size := headerSize + len(key) + len(data); size > s.maxEntry {
+		return fmt.Errorf("entry of %d bytes is larger than a segment (%d bytes), raise MaxBytes or lower Segments", size, s.maxEntry)
+	}
+
+	now := s.clock.Now()
+	hash := maphash.String(s.seed, key)
+	s.segment(hash).set(hash, key, data, storage.ExpiresAt(now, exp), now.UnixMilli())
+
+	return nil
+}
+
+// Delete entries by key
+func (s *Storage) Delete(keys ...string) error {
+	return s.DeleteContext(context.Background(), keys...)
+}
+
+// Delete entries by key, the arena storage never blocks so the context is only checked before starting
+func (s *Storage) DeleteContext(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) <= 0 {
+		return errors.New("at least one key is required for Delete")
+	}
+
+	for _, v := range keys {
+		if len(v) == 0 {
+			return errors.New("storage keys cannot be zero length (no keys deleted)")
+		}
+	}
+
+	for _, key := range keys {
+		hash := maphash.String(s.seed, key)
+		s.segment(hash).delete(hash, key)
+	}
+
+	return nil
+}
+
+// Reset all keys
+func (s *Storage) Reset() error {
+	return s.ResetContext(context.Background())
+}
+
+// Reset all keys, the arena storage never blocks so the context is only checked before starting
+func (s *Storage) ResetContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, segment := range s.segments {
+		segment.reset()
+	}
+
+	return nil
+}
+
+// Close the arena storage
+func (s *Storage) Close() error {
+	s.done <- struct{}{}
+
+	return nil
+}
+
+// gc removes expired entries from the index one segment at a time, so only one segment is locked at once
+func (s *Storage) gc(ticker storage.Ticker) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C():
+			now := s.clock.Now().UnixMilli()
+
+			for _, segment := range s.segments {
+				segment.gc(now)
+			}
+		}
+	}
+}
+
+// Stats returns the number of hits, misses and evictions since the storage was created, along with the current usage
+func (s *Storage) Stats() Stats {
+	var stats Stats
+
+	for _, segment := range s.segments {
+		entries, bytes := segment.usage()
+
+		stats.Hits += segment.hits.Load()
+		stats.Misses += segment.misses.Load()
+		stats.Evictions += segment.evictions.Load()
+		stats.Entries += entries
+		stats.Bytes += bytes
+	}
+
+	return stats
+}
+
+// segment returns the segment that a hash belongs to
+func (s *Storage) segment(hash uint64) *segment {
+	return s.segments[hash & uint64(len(s.segments) - 1)]
+}
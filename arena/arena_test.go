@@ -0,0 +1,136 @@
+package arena
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/clocktest"
+	"github.com/paul-norman/go-fiber-storage/storagetest"
+)
+
+func Test_Arena_Conformance(t *testing.T) {
+	// Expiry is checked against the fake clock, so the tests do not wait
+	clock := clocktest.NewFake()
+
+	storagetest.Run(t, func() storage.Storage {
+		return New(Config{ MaxBytes: 1 << 20, Segments: 4, Clock: clock })
+	}, storagetest.Config{
+		Advance:	clock.Advance,
+	})
+}
+
+func Test_Arena_Eviction(t *testing.T) {
+	clock := clocktest.NewFake()
+	// A single ring with room for 4 entries with 10 bytes of key and encoded value
+	store := New(Config{ MaxBytes: 4 * (headerSize + 10), Segments: 1, Clock: clock })
+	defer store.Close()
+
+	value := []byte("valu")
+	for i := 0; i < 4; i++ {
+		utils.AssertEqual(t, nil, store.Set(fmt.Sprint("key:", i), value))
+	}
+	utils.AssertEqual(t, 4, store.Stats().Entries)
+
+	// The oldest entry makes room for the next
+	utils.AssertEqual(t, nil, store.Set("key:4", value))
+	utils.AssertEqual(t, true, store.Get("key:0").Miss())
+	utils.AssertEqual(t, true, store.Get("key:4").Hit())
+	utils.AssertEqual(t, uint64(1), store.Stats().Evictions)
+
+	// Expired entries are reclaimed without counting as evictions
+	utils.AssertEqual(t, nil, store.Set("key:5", value, time.Second))
+	utils.AssertEqual(t, nil, store.Set("key:6", value))
+	utils.AssertEqual(t, uint64(3), store.Stats().Evictions)
+
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, true, store.Get("key:5").Miss())
+	for i := 7; i < 10; i++ {
+		utils.AssertEqual(t, nil, store.Set(fmt.Sprint("key:", i), value))
+	}
+	utils.AssertEqual(t, uint64(5), store.Stats().Evictions)
+
+	stats := store.Stats()
+	utils.AssertEqual(t, 4, stats.Entries)
+	utils.AssertEqual(t, 4 * (headerSize + 10), stats.Bytes)
+
+	// An entry that can never fit is refused
+	utils.AssertEqual(t, true, store.Set("large", make([]byte, 200)) != nil)
+}
+
+func Test_Arena_Wrap(t *testing.T) {
+	// Entries of 33 bytes do not divide the ring evenly, so they wrap around its end
+	store := New(Config{ MaxBytes: 100, Segments: 1 })
+	defer store.Close()
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprint("k", i % 10)
+		utils.AssertEqual(t, nil, store.Set(key, []byte(fmt.Sprintf("%06d", i))))
+		utils.AssertEqual(t, []byte(fmt.Sprintf("%06d", i)), store.Get(key).Value)
+	}
+
+	// Replacing and deleting keys only leaves the latest values
+	utils.AssertEqual(t, nil, store.Delete("k9"))
+	utils.AssertEqual(t, true, store.Get("k9").Miss())
+	utils.AssertEqual(t, []byte("000048"), store.Get("k8").Value)
+}
+
+func Test_Arena_Collision(t *testing.T) {
+	s := newSegment(1024)
+
+	// A key with the same hash replaces another, which is then missed rather than returned with the wrong value
+	s.set(1, "john", []byte("doe"), 0, 0)
+	s.set(1, "jane", []byte("doe"), 0, 0)
+	_, _, ok := s.get(1, "john")
+	utils.AssertEqual(t, false, ok)
+
+	s.delete(1, "john")
+	value, _, ok := s.get(1, "jane")
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, []byte("doe"), value)
+}
+
+func Test_Arena_GC(t *testing.T) {
+	clock := clocktest.NewFake()
+	store := New(Config{ GCInterval: time.Second, Segments: 1, MaxBytes: 1 << 10, Clock: clock })
+	defer store.Close()
+
+	_ = store.Set("john", "doe", time.Second)
+	_ = store.Set("jane", "doe")
+
+	clock.Advance(time.Second)
+	// The next tick is only taken once that garbage collection has finished
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, 1, store.Stats().Entries)
+}
+
+func Test_Arena_Close(t *testing.T) {
+	utils.AssertEqual(t, nil, New().Close())
+}
+
+// The garbage collector does not scan the entries, compare the pause with the memory driver holding the same entries
+// go test -v -run=^$ -bench=Benchmark_Arena -benchmem
+func Benchmark_Arena(b *testing.B) {
+	store := New(Config{ MaxBytes: 256 << 20 })
+	defer store.Close()
+
+	for i := 0; i < 1000000; i++ {
+		_ = store.Set(fmt.Sprint("session:", i), []byte("user:1234"))
+	}
+
+	b.Run("get", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			_ = store.Get(fmt.Sprint("session:", n % 1000000))
+		}
+	})
+
+	b.Run("gc", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			runtime.GC()
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package arena
+
+import (
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Config defines the config for storage.
+type Config struct {
+	// Total size of the ring buffers, allocated up front. Once they are full the oldest entries are evicted,
+	// so this is the memory budget for keys, values and a 24 byte header per entry.
+	//
+	// Optional. Default is 64 << 20 (64 MiB)
+	MaxBytes int
+
+	// Number of independently locked ring buffers the keys are spread across, rounded up to a power of two.
+	// MaxBytes is divided between them, and an encoded entry cannot be larger than one buffer.
+	//
+	// Optional. Default is 256
+	Segments int
+
+	// Time between passes removing expired entries from the index, their space is reclaimed once the ring reaches it
+	//
+	// Optional. Default is 1 * time.Second
+	GCInterval time.Duration
+
+	// Converts values to the bytes held in the ring buffers, Get returns the decoded values
+	//
+	// Optional. Default is storage.DefaultCodec
+	Codec storage.Codec
+
+	// Source of time for expiry and garbage collection, a clocktest.Fake lets tests expire keys without waiting
+	//
+	// Optional. Default is storage.SystemClock
+	Clock storage.Clock
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	MaxBytes:	64 << 20,
+	Segments:	256,
+	GCInterval:	1 * time.Second,
+	Codec:		storage.DefaultCodec,
+	Clock:		storage.SystemClock,
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		return ConfigDefault
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = ConfigDefault.MaxBytes
+	}
+
+	if cfg.Segments <= 0 {
+		cfg.Segments = ConfigDefault.Segments
+	}
+
+	if cfg.GCInterval <= 0 {
+		cfg.GCInterval = ConfigDefault.GCInterval
+	}
+
+	if cfg.Codec == nil {
+		cfg.Codec = ConfigDefault.Codec
+	}
+
+	if cfg.Clock == nil {
+		cfg.Clock = ConfigDefault.Clock
+	}
+
+	return cfg
+}
@@ -0,0 +1,5 @@
+module github.com/paul-norman/go-fiber-storage/arena
+
+go 1.19
+
+require github.com/gofiber/utils v1.1.0
@@ -0,0 +1,196 @@
+package arena
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+)
+
+// Each entry in a ring is a header followed by the key and the encoded value:
+//
+//	entry length (uint32), expiry (int64 unix milliseconds, 0 for none), hash (uint64), key length (uint32)
+//
+// All big endian. Entries wrap around the end of the ring.
+const headerSize = 24
+
+// segment is an independently locked ring buffer with an index of the entries in it.
+// Neither the ring nor the index hold pointers, so the Go garbage collector does not scan them however many entries
+// they hold.
+type segment struct {
+	mux			sync.RWMutex
+	ring		[]byte
+	// Maps the hash of a key to the position of its entry. Positions only grow (the ring offset is position % len(ring)),
+	// so an entry is still in the ring while its position is at least tail.
+	index		map[uint64]uint64
+	head		uint64
+	tail		uint64
+	hits		atomic.Uint64
+	misses		atomic.Uint64
+	evictions	atomic.Uint64
+	// scratch space for headers and keys, used under the lock
+	scratch		[headerSize]byte
+}
+
+// newSegment allocates a ring of the given size
+func newSegment(size int) *segment {
+	return &segment{
+		ring:	make([]byte, size),
+		index:	make(map[uint64]uint64),
+	}
+}
+
+// get returns the encoded value of a key and its expiry, whether or not it has expired.
+// The value is copied out of the ring, so it stays valid once the lock is released.
+func (s *segment) get(hash uint64, key string) ([]byte, int64, bool) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	pos, ok := s.index[hash]
+	if !ok {
+		return nil, 0, false
+	}
+
+	var header [headerSize]byte
+	s.read(pos, header[:])
+	length, expiry, _, keyLen := decodeHeader(header[:])
+
+	// A different key with the same hash replaced this one's entry
+	if !s.equal(pos + headerSize, key, keyLen) {
+		return nil, 0, false
+	}
+
+	value := make([]byte, length - headerSize - keyLen)
+	s.read(pos + headerSize + uint64(keyLen), value)
+
+	return value, expiry, true
+}
+
+// set appends an entry, evicting the oldest entries until it fits. The entry must fit in the ring.
+// A key with the same hash as another replaces it.
+func (s *segment) set(hash uint64, key string, value []byte, expiry int64, now int64) {
+	length := uint64(headerSize + len(key) + len(value))
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for s.head + length - s.tail > uint64(len(s.ring)) {
+		s.evictOldest(now)
+	}
+
+	binary.BigEndian.PutUint32(s.scratch[0:], uint32(length))
+	binary.BigEndian.PutUint64(s.scratch[4:], uint64(expiry))
+	binary.BigEndian.PutUint64(s.scratch[12:], hash)
+	binary.BigEndian.PutUint32(s.scratch[20:], uint32(len(key)))
+
+	s.write(s.head, s.scratch[:])
+	s.writeString(s.head + headerSize, key)
+	s.write(s.head + headerSize + uint64(len(key)), value)
+
+	s.index[hash] = s.head
+	s.head += length
+}
+
+// delete removes a key from the index, its space is reclaimed once the ring reaches it
+func (s *segment) delete(hash uint64, key string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	pos, ok := s.index[hash]
+	if !ok {
+		return
+	}
+
+	s.read(pos, s.scratch[:])
+	_, _, _, keyLen := decodeHeader(s.scratch[:])
+	if s.equal(pos + headerSize, key, keyLen) {
+		delete(s.index, hash)
+	}
+}
+
+// reset removes every entry
+func (s *segment) reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.index = make(map[uint64]uint64)
+	s.head = 0
+	s.tail = 0
+}
+
+// gc removes the entries that expired by now (unix milliseconds) from the index
+func (s *segment) gc(now int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for hash, pos := range s.index {
+		s.read(pos + 4, s.scratch[:8])
+		if expiry := int64(binary.BigEndian.Uint64(s.scratch[:8])); expiry != 0 && expiry <= now {
+			delete(s.index, hash)
+		}
+	}
+}
+
+// usage returns the number of entries and the bytes the ring holds, including entries that are no longer indexed
+func (s *segment) usage() (int, int) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return len(s.index), int(s.head - s.tail)
+}
+
+// evictOldest drops the entry at the tail of the ring, the lock must be held.
+// Entries that are still indexed are counted as evictions unless they had expired by the time of the write.
+func (s *segment) evictOldest(now int64) {
+	s.read(s.tail, s.scratch[:])
+	length, expiry, hash, _ := decodeHeader(s.scratch[:])
+
+	if pos, ok := s.index[hash]; ok && pos == s.tail {
+		delete(s.index, hash)
+		if expiry == 0 || expiry > now {
+			s.evictions.Add(1)
+		}
+	}
+
+	s.tail += uint64(length)
+}
+
+// equal reports whether the key stored at pos is key, the lock must be held
+func (s *segment) equal(pos uint64, key string, keyLen uint32) bool {
+	if int(keyLen) != len(key) {
+		return false
+	}
+
+	start := int(pos % uint64(len(s.ring)))
+	first := len(s.ring) - start
+	if first >= len(key) {
+		return string(s.ring[start:start + len(key)]) == key
+	}
+
+	return string(s.ring[start:]) == key[:first] && string(s.ring[:len(key) - first]) == key[first:]
+}
+
+// read copies len(b) bytes from pos, wrapping around the end of the ring
+func (s *segment) read(pos uint64, b []byte) {
+	start := int(pos % uint64(len(s.ring)))
+	n := copy(b, s.ring[start:])
+	copy(b[n:], s.ring)
+}
+
+// write copies b to pos, wrapping around the end of the ring
+func (s *segment) write(pos uint64, b []byte) {
+	start := int(pos % uint64(len(s.ring)))
+	n := copy(s.ring[start:], b)
+	copy(s.ring, b[n:])
+}
+
+// writeString copies a string to pos without converting it to a byte slice first
+func (s *segment) writeString(pos uint64, str string) {
+	start := int(pos % uint64(len(s.ring)))
+	n := copy(s.ring[start:], str)
+	copy(s.ring, str[n:])
+}
+
+// decodeHeader returns the entry length, expiry, hash and key length
+func decodeHeader(b []byte) (uint32, int64, uint64, uint32) {
+	return binary.BigEndian.Uint32(b[0:]), int64(binary.BigEndian.Uint64(b[4:])), binary.BigEndian.Uint64(b[12:]), binary.BigEndian.Uint32(b[20:])
+}
@@ -0,0 +1,350 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// State of the circuit
+type State int
+
+const (
+	// Operations reach the storage
+	Closed State = iota
+
+	// Operations are answered without the storage
+	Open
+
+	// A limited number of probe operations reach the storage
+	HalfOpen
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+		case Closed:
+			return "closed"
+		case Open:
+			return "open"
+		case HalfOpen:
+			return "half-open"
+	}
+
+	return "unknown"
+}
+
+// Storage stops calling a failing storage until it recovers, degrading reads to misses in the meantime
+type Storage struct {
+	storage.Chained
+
+	cfg			Config
+	primary		storage.Chained
+	fallback	storage.Chained
+
+	mux			sync.Mutex
+	state		State
+	opened		time.Time
+	probes		int
+	successes	int
+	consecutive	int
+	requests	int
+	failures	int
+	window		time.Time
+	queue		[]write
+}
+
+// write is an operation held while the circuit is open
+type write struct {
+	name	string
+	keys	[]string
+	value	any
+	expiry	time.Duration
+	queued	time.Time
+}
+
+// change is a state transition waiting to be reported
+type change struct {
+	from	State
+	to		State
+}
+
+// New wraps Config.Storage with a circuit breaker
+func New(config ...Config) *Storage {
+	// Set default config
+	cfg := configDefault(config...)
+
+	if cfg.Storage == nil {
+		panic(errors.New("breaker: a Storage to wrap is required"))
+	}
+
+	s := &Storage{
+		cfg:		cfg,
+		primary:	storage.Use(cfg.Storage),
+		window:		time.Now(),
+	}
+	if cfg.Fallback != nil {
+		s.fallback = storage.Use(cfg.Fallback)
+	}
+	s.Chained = storage.Use(cfg.Storage, s.middleware)
+
+	return s
+}
+
+// State returns the current state of the circuit
+func (s *Storage) State() State {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.state
+}
+
+// Queued returns the number of writes waiting to be replayed
+func (s *Storage) Queued() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return len(s.queue)
+}
+
+func (s *Storage) middleware(next storage.Handler) storage.Handler {
+	return func(op *storage.Op) {
+		if op.Name == storage.OpClose {
+			next(op)
+			return
+		}
+
+		allowed, probe := s.allow()
+		if !allowed {
+			s.degrade(op)
+			return
+		}
+
+		next(op)
+
+		err := op.Err
+		if err == nil && op.Result != nil {
+			err = op.Result.Error
+		}
+
+		s.record(s.cfg.IsFailure(err), probe)
+	}
+}
+
+// allow decides whether an operation may reach the storage, and whether it is a probe
+func (s *Storage) allow() (bool, bool) {
+	s.mux.Lock()
+
+	var changes []change
+	defer func() {
+		s.mux.Unlock()
+		s.notify(changes)
+	}()
+
+	if s.state == Open && time.Since(s.opened) >= s.cfg.OpenTimeout {
+		changes = append(changes, s.transition(HalfOpen))
+	}
+
+	switch s.state {
+		case Closed:
+			return true, false
+		case HalfOpen:
+			if s.probes < s.cfg.Probes {
+				s.probes++
+				return true, true
+			}
+	}
+
+	return false, false
+}
+
+// record counts the outcome of an operation that reached the storage
+func (s *Storage) record(failed bool, probe bool) {
+	s.mux.Lock()
+
+	var changes []change
+	defer func() {
+		s.mux.Unlock()
+		s.notify(changes)
+	}()
+
+	if probe {
+		// The circuit may have opened again because of another probe
+		if s.state != HalfOpen {
+			return
+		}
+
+		if failed {
+			changes = append(changes, s.transition(Open))
+			return
+		}
+
+		s.successes++
+		if s.successes >= s.cfg.Probes {
+			s.mux.Unlock()
+			changes = s.replay()
+			s.mux.Lock()
+		}
+
+		return
+	}
+
+	if s.state != Closed {
+		return
+	}
+
+	if time.Since(s.window) >= s.cfg.Window {
+		s.window = time.Now()
+		s.requests = 0
+		s.failures = 0
+	}
+
+	s.requests++
+	if !failed {
+		s.consecutive = 0
+		return
+	}
+
+	s.failures++
+	s.consecutive++
+
+	tripped := s.consecutive >= s.cfg.Failures
+	if s.cfg.ErrorRate > 0 && s.requests >= s.cfg.MinRequests && float64(s.failures) / float64(s.requests) >= s.cfg.ErrorRate {
+		tripped = true
+	}
+
+	if tripped {
+		changes = append(changes, s.transition(Open))
+	}
+}
+
+// transition changes the state and resets the counters for the new state, the lock must be held
+func (s *Storage) transition(to State) change {
+	from := s.state
+	s.state = to
+
+	switch to {
+		case Open:
+			s.opened = time.Now()
+		case HalfOpen:
+			s.probes = 0
+			s.successes = 0
+		case Closed:
+			s.consecutive = 0
+			s.requests = 0
+			s.failures = 0
+			s.window = time.Now()
+	}
+
+	return change{ from: from, to: to }
+}
+
+// notify reports state changes, it is called without the lock so callbacks may inspect the storage
+func (s *Storage) notify(changes []change) {
+	if s.cfg.OnStateChange == nil {
+		return
+	}
+
+	for _, c := range changes {
+		s.cfg.OnStateChange(c.from, c.to)
+	}
+}
+
+// degrade answers an operation without the storage
+func (s *Storage) degrade(op *storage.Op) {
+	if op.Name == storage.OpGet {
+		if s.fallback != nil {
+			op.Result = s.fallback.GetContext(op.Context, op.Key())
+			return
+		}
+
+		op.Result = &storage.Result{ Value: nil, Error: nil, Missed: true }
+		return
+	}
+
+	if s.fallback != nil {
+		switch op.Name {
+			case storage.OpSet:
+				_ = s.fallback.SetContext(op.Context, op.Key(), op.Value, op.Expiry)
+			case storage.OpDelete:
+				_ = s.fallback.DeleteContext(op.Context, op.Keys...)
+			case storage.OpReset:
+				_ = s.fallback.ResetContext(op.Context)
+		}
+	}
+
+	if s.cfg.WriteMode == Queue {
+		s.mux.Lock()
+		// A reset makes every earlier write pointless
+		if op.Name == storage.OpReset {
+			s.queue = s.queue[:0]
+		}
+		if len(s.queue) >= s.cfg.QueueSize {
+			s.queue = s.queue[1:]
+		}
+		s.queue = append(s.queue, write{ name: op.Name, keys: op.Keys, value: op.Value, expiry: op.Expiry, queued: time.Now() })
+		s.mux.Unlock()
+	}
+}
+
+// replay applies the queued writes in order, writes made meanwhile are queued behind them.
+// The circuit closes once the queue is empty, or opens again if a write fails.
+func (s *Storage) replay() []change {
+	for {
+		s.mux.Lock()
+		if s.state != HalfOpen {
+			s.mux.Unlock()
+			return nil
+		}
+		if len(s.queue) == 0 {
+			s.transition(Closed)
+			s.mux.Unlock()
+			break
+		}
+		w := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mux.Unlock()
+
+		if err := s.apply(w); s.cfg.IsFailure(err) {
+			s.mux.Lock()
+			defer s.mux.Unlock()
+
+			s.queue = append([]write{ w }, s.queue...)
+			if s.state != HalfOpen {
+				return nil
+			}
+
+			return []change{ s.transition(Open) }
+		}
+	}
+
+	// Values written while open may be stale now that the storage is back
+	if s.fallback != nil {
+		_ = s.fallback.Reset()
+	}
+
+	return []change{ { from: HalfOpen, to: Closed } }
+}
+
+// apply performs a queued write, expiries count from when the write was made
+func (s *Storage) apply(w write) error {
+	switch w.name {
+		case storage.OpSet:
+			expiry := w.expiry
+			if expiry > 0 {
+				expiry -= time.Since(w.queued)
+				if expiry <= 0 {
+					return s.primary.Delete(w.keys...)
+				}
+			}
+			return s.primary.Set(w.keys[0], w.value, expiry)
+		case storage.OpDelete:
+			return s.primary.Delete(w.keys...)
+		case storage.OpReset:
+			return s.primary.Reset()
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/memory"
+)
+
+var errDown = errors.New("dial tcp 127.0.0.1:6379: connect: connection refused")
+
+// outage fails every operation that reaches the storage while down is set
+type outage struct {
+	mux		sync.Mutex
+	down	bool
+	calls	int
+}
+
+func (o *outage) set(down bool) {
+	o.mux.Lock()
+	o.down = down
+	o.mux.Unlock()
+}
+
+// wrap returns the wrapped storage, failing during an outage
+func (o *outage) wrap(s storage.Storage) storage.Storage {
+	return storage.Use(s, func(next storage.Handler) storage.Handler {
+		return func(op *storage.Op) {
+			o.mux.Lock()
+			o.calls++
+			down := o.down
+			o.mux.Unlock()
+
+			if down {
+				op.Err = errDown
+				return
+			}
+			next(op)
+		}
+	})
+}
+
+func Test_Breaker_Required(t *testing.T) {
+	defer func() {
+		utils.AssertEqual(t, true, recover() != nil)
+	}()
+
+	_ = New()
+}
+
+func Test_Breaker_Trip(t *testing.T) {
+	o := &outage{}
+	var changes []string
+	store := New(Config{
+		Storage:		o.wrap(memory.New()),
+		Failures:		3,
+		OpenTimeout:	50 * time.Millisecond,
+		OnStateChange:	func(from State, to State) {
+			changes = append(changes, from.String() + ">" + to.String())
+		},
+	})
+
+	utils.AssertEqual(t, nil, store.Set("john", "doe"))
+
+	o.set(true)
+	for i := 0; i < 3; i++ {
+		utils.AssertEqual(t, errDown, store.Get("john").Err())
+	}
+	utils.AssertEqual(t, Open, store.State())
+
+	// Open circuits answer without calling the storage
+	calls := o.calls
+	utils.AssertEqual(t, true, store.Get("john").Miss())
+	utils.AssertEqual(t, nil, store.Set("john", "doe"))
+	utils.AssertEqual(t, calls, o.calls)
+
+	// A failed probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	utils.AssertEqual(t, errDown, store.Get("john").Err())
+	utils.AssertEqual(t, Open, store.State())
+
+	// A successful probe closes it
+	o.set(false)
+	time.Sleep(60 * time.Millisecond)
+	utils.AssertEqual(t, true, store.Get("john").Hit())
+	utils.AssertEqual(t, Closed, store.State())
+
+	utils.AssertEqual(t, []string{ "closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed" }, changes)
+}
+
+func Test_Breaker_ErrorRate(t *testing.T) {
+	o := &outage{}
+	store := New(Config{
+		Storage:		o.wrap(memory.New()),
+		Failures:		100,
+		ErrorRate:		0.5,
+		MinRequests:	10,
+	})
+
+	// Alternate failures never reach 100 in a row, but are half of the requests
+	for i := 0; i < 9; i++ {
+		o.set(i % 2 == 0)
+		_ = store.Get("john")
+	}
+	utils.AssertEqual(t, Closed, store.State())
+
+	o.set(true)
+	_ = store.Get("john")
+	utils.AssertEqual(t, Open, store.State())
+}
+
+func Test_Breaker_Fallback(t *testing.T) {
+	o := &outage{}
+	fallback := memory.New()
+	store := New(Config{
+		Storage:		o.wrap(memory.New()),
+		Fallback:		fallback,
+		Failures:		1,
+		OpenTimeout:	20 * time.Millisecond,
+	})
+
+	o.set(true)
+	_ = store.Get("john")
+	utils.AssertEqual(t, Open, store.State())
+
+	utils.AssertEqual(t, nil, store.Set("john", "doe"))
+	val, err, _ := store.Get("john").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "doe", val)
+
+	// The fallback is cleared once the storage is back
+	o.set(false)
+	time.Sleep(30 * time.Millisecond)
+	utils.AssertEqual(t, true, store.Get("john").Miss())
+	utils.AssertEqual(t, Closed, store.State())
+	utils.AssertEqual(t, true, fallback.Get("john").Miss())
+}
+
+func Test_Breaker_Queue(t *testing.T) {
+	o := &outage{}
+	store := New(Config{
+		Storage:		o.wrap(memory.New()),
+		Failures:		1,
+		OpenTimeout:	20 * time.Millisecond,
+		WriteMode:		Queue,
+		QueueSize:		3,
+	})
+
+	o.set(true)
+	_ = store.Get("john")
+	utils.AssertEqual(t, Open, store.State())
+
+	_ = store.Set("a", "1")
+	_ = store.Set("b", "2")
+	_ = store.Set("c", "3", time.Minute)
+	_ = store.Delete("b")
+	_ = store.Set("d", "4", time.Millisecond)
+	utils.AssertEqual(t, 3, store.Queued())
+
+	// The probe replays the queue before the circuit closes
+	o.set(false)
+	time.Sleep(30 * time.Millisecond)
+	utils.AssertEqual(t, true, store.Get("a").Miss())
+	utils.AssertEqual(t, Closed, store.State())
+	utils.AssertEqual(t, 0, store.Queued())
+
+	val, _, _ := store.Get("c").String()
+	utils.AssertEqual(t, "3", val)
+	utils.AssertEqual(t, true, store.Get("b").Miss())
+	utils.AssertEqual(t, true, store.Get("d").Miss())
+}
+
+func Test_Breaker_Queue_Failure(t *testing.T) {
+	o := &outage{}
+	store := New(Config{
+		Storage:		o.wrap(memory.New()),
+		Failures:		1,
+		Probes:			2,
+		OpenTimeout:	20 * time.Millisecond,
+		WriteMode:		Queue,
+	})
+
+	o.set(true)
+	_ = store.Get("john")
+	_ = store.Set("john", "doe")
+	utils.AssertEqual(t, 1, store.Queued())
+
+	// Both probes must succeed
+	o.set(false)
+	time.Sleep(30 * time.Millisecond)
+	_ = store.Get("a")
+	utils.AssertEqual(t, HalfOpen, store.State())
+	_ = store.Get("b")
+	utils.AssertEqual(t, Closed, store.State())
+
+	val, _, _ := store.Get("john").String()
+	utils.AssertEqual(t, "doe", val)
+}
+
+func Test_Breaker_Concurrency(t *testing.T) {
+	o := &outage{}
+	store := New(Config{
+		Storage:		o.wrap(memory.New()),
+		Failures:		2,
+		OpenTimeout:	time.Millisecond,
+		WriteMode:		Queue,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				o.set((i + j) % 3 == 0)
+				_ = store.Set("john", "doe")
+				_ = store.Get("john")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	o.set(false)
+	time.Sleep(5 * time.Millisecond)
+	_ = store.Get("john")
+	_ = store.Get("john")
+	utils.AssertEqual(t, Closed, store.State())
+}
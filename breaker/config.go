@@ -0,0 +1,146 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// WriteMode decides what happens to writes while the circuit is open
+type WriteMode int
+
+const (
+	// Writes are discarded (and reported as successful)
+	Drop WriteMode = iota
+
+	// Writes are kept and replayed, in order, once the circuit closes
+	Queue
+)
+
+// Config defines the config for storage.
+type Config struct {
+	// Storage protected by the circuit breaker
+	//
+	// Required. Default is nil
+	Storage storage.Storage
+
+	// Storage that answers Get, and receives writes, while the circuit is open. It is reset when the circuit closes.
+	//
+	// Optional. Default is nil (Get reports a miss)
+	Fallback storage.Storage
+
+	// Consecutive failures that trip the circuit
+	//
+	// Optional. Default is 5
+	Failures int
+
+	// Fraction of failed operations within Window that trips the circuit, 0 disables
+	//
+	// Optional. Default is 0
+	ErrorRate float64
+
+	// Operations needed within Window before ErrorRate is considered
+	//
+	// Optional. Default is 20
+	MinRequests int
+
+	// Period over which ErrorRate is measured
+	//
+	// Optional. Default is 10 * time.Second
+	Window time.Duration
+
+	// Time the circuit stays open before probing the storage again
+	//
+	// Optional. Default is 30 * time.Second
+	OpenTimeout time.Duration
+
+	// Operations allowed through while half-open, all of them must succeed for the circuit to close
+	//
+	// Optional. Default is 1
+	Probes int
+
+	// What happens to writes while the circuit is open (breaker.Drop or breaker.Queue)
+	//
+	// Optional. Default is Drop
+	WriteMode WriteMode
+
+	// Maximum writes held in Queue mode, the oldest are discarded beyond this
+	//
+	// Optional. Default is 1000
+	QueueSize int
+
+	// Decides whether an error counts as a failure of the storage
+	//
+	// Optional. Default is any error except context.Canceled
+	IsFailure func(err error) bool
+
+	// Called after every change of state, i.e. to raise an alert
+	//
+	// Optional. Default is nil
+	OnStateChange func(from State, to State)
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Storage:		nil,
+	Fallback:		nil,
+	Failures:		5,
+	ErrorRate:		0,
+	MinRequests:	20,
+	Window:			10 * time.Second,
+	OpenTimeout:	30 * time.Second,
+	Probes:			1,
+	WriteMode:		Drop,
+	QueueSize:		1000,
+	IsFailure:		isFailure,
+	OnStateChange:	nil,
+}
+
+// isFailure counts every error except the caller giving up
+func isFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		return ConfigDefault
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.Failures <= 0 {
+		cfg.Failures = ConfigDefault.Failures
+	}
+
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = ConfigDefault.MinRequests
+	}
+
+	if cfg.Window <= 0 {
+		cfg.Window = ConfigDefault.Window
+	}
+
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = ConfigDefault.OpenTimeout
+	}
+
+	if cfg.Probes <= 0 {
+		cfg.Probes = ConfigDefault.Probes
+	}
+
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = ConfigDefault.QueueSize
+	}
+
+	if cfg.IsFailure == nil {
+		cfg.IsFailure = ConfigDefault.IsFailure
+	}
+
+	return cfg
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"time"
+)
+
+// Clock is the source of time for expiry and garbage collection.
+// Drivers accept one in their Config so that tests can control time (see clocktest.Fake).
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// NewTicker returns a Ticker that ticks every d, d must be greater than zero
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers the ticks of a Clock, as time.Ticker does
+type Ticker interface {
+	// C returns the channel that the ticks are delivered on
+	C() <-chan time.Time
+
+	// Stop turns off the ticker, no more ticks will be sent
+	Stop()
+}
+
+// SystemClock is the real time and the default Clock of every driver
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{ time.NewTicker(d) }
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
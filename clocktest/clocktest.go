@@ -0,0 +1,121 @@
+// Package clocktest provides a fake storage.Clock, so that expiry and garbage collection can be tested without waiting
+package clocktest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Fake is a storage.Clock that only moves when it is told to
+type Fake struct {
+	mux		sync.Mutex
+	now		time.Time
+	tickers	[]*ticker
+}
+
+// ticker is a storage.Ticker driven by a Fake
+type ticker struct {
+	clock	*Fake
+	every	time.Duration
+	next	time.Time
+	c		chan time.Time
+	done	chan struct{}
+	stop	sync.Once
+}
+
+// NewFake creates a fake clock set to now, or to the current time when omitted
+func NewFake(now ...time.Time) *Fake {
+	f := &Fake{ now: time.Now() }
+	if len(now) > 0 {
+		f.now = now[0]
+	}
+
+	return f
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	return f.now
+}
+
+// NewTicker returns a ticker that ticks every d of fake time, it panics if d is not greater than zero
+func (f *Fake) NewTicker(d time.Duration) storage.Ticker {
+	if d <= 0 {
+		panic("clocktest: non-positive interval for NewTicker")
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	t := &ticker{ clock: f, every: d, next: f.now.Add(d), c: make(chan time.Time), done: make(chan struct{}) }
+	f.tickers = append(f.tickers, t)
+
+	return t
+}
+
+// Advance moves the clock forward by d and ticks every ticker that became due.
+// A ticker that became due several times ticks once, as a time.Ticker with a slow receiver would.
+// Advance returns once every tick has been received (or its ticker stopped), the work it starts runs on the receiving goroutine,
+// so advancing by the ticker's interval again also waits for that work to finish.
+func (f *Fake) Advance(d time.Duration) {
+	f.mux.Lock()
+	f.now = f.now.Add(d)
+	now := f.now
+
+	var due []*ticker
+	for _, t := range f.tickers {
+		if t.next.After(now) {
+			continue
+		}
+
+		for !t.next.After(now) {
+			t.next = t.next.Add(t.every)
+		}
+		due = append(due, t)
+	}
+	f.mux.Unlock()
+
+	// Deliver without the lock, receivers are likely to call Now
+	for _, t := range due {
+		select {
+			case t.c <- now:
+			case <-t.done:
+		}
+	}
+}
+
+// Set moves the clock to now without ticking any tickers, tickers keep their schedule
+func (f *Fake) Set(now time.Time) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.now = now
+}
+
+// C returns the channel that the ticks are delivered on
+func (t *ticker) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop turns off the ticker, it may be called more than once
+func (t *ticker) Stop() {
+	t.stop.Do(func() {
+		close(t.done)
+
+		f := t.clock
+		f.mux.Lock()
+		defer f.mux.Unlock()
+
+		for i, other := range f.tickers {
+			if other == t {
+				f.tickers = append(f.tickers[:i], f.tickers[i + 1:]...)
+				break
+			}
+		}
+	})
+}
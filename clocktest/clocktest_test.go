@@ -0,0 +1,75 @@
+package clocktest
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+var _ storage.Clock = &Fake{}
+
+func Test_Clocktest_Now(t *testing.T) {
+	start := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFake(start)
+	utils.AssertEqual(t, start, clock.Now())
+
+	clock.Advance(1500 * time.Millisecond)
+	utils.AssertEqual(t, start.Add(1500 * time.Millisecond), clock.Now())
+
+	clock.Set(start)
+	utils.AssertEqual(t, start, clock.Now())
+
+	// Defaults to the current time
+	utils.AssertEqual(t, true, time.Since(NewFake().Now()) < time.Minute)
+}
+
+func Test_Clocktest_Ticker(t *testing.T) {
+	clock := NewFake()
+	ticker := clock.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	var ticks atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range ticker.C() {
+			ticks.Add(1)
+			if ticks.Load() == 2 {
+				return
+			}
+		}
+	}()
+
+	// Not due yet
+	clock.Advance(9 * time.Second)
+	utils.AssertEqual(t, int32(0), ticks.Load())
+
+	// Due, the tick has been received when Advance returns
+	clock.Advance(time.Second)
+
+	// Due several times over, ticks once
+	clock.Advance(time.Minute)
+	<-done
+	utils.AssertEqual(t, int32(2), ticks.Load())
+}
+
+func Test_Clocktest_Ticker_Stop(t *testing.T) {
+	clock := NewFake()
+	ticker := clock.NewTicker(time.Second)
+	ticker.Stop()
+	ticker.Stop()
+
+	// Nothing is receiving, a stopped ticker must not block Advance
+	clock.Advance(time.Minute)
+}
+
+func Test_Clocktest_Ticker_Interval(t *testing.T) {
+	defer func() {
+		utils.AssertEqual(t, true, recover() != nil)
+	}()
+
+	NewFake().NewTicker(0)
+}
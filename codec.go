@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/google/uuid"
+)
+
+// Codec converts values to and from bytes for drivers and wrappers that cannot hold an `any` directly
+type Codec interface {
+	// Encode the value into a byte slice
+	Marshal(value any) ([]byte, error)
+
+	// Decode a byte slice produced by Marshal back into a value
+	Unmarshal(data []byte) (any, error)
+}
+
+// DefaultCodec restores every type that has a Result accessor exactly, other types are returned as their JSON equivalents
+var DefaultCodec Codec = TypedCodec{}
+
+// TypedCodec prefixes the encoded value with a single type byte so that it can be decoded back into its original type.
+// Types without a dedicated tag are encoded as JSON and decoded into the generic JSON types (map[string]any, []any etc).
+type TypedCodec struct{}
+
+const (
+	tagNil byte = iota
+	tagBytes
+	tagString
+	tagBool
+	tagInt
+	tagInt8
+	tagInt16
+	tagInt32
+	tagInt64
+	tagUint
+	tagUint8
+	tagUint16
+	tagUint32
+	tagUint64
+	tagFloat32
+	tagFloat64
+	tagUUID
+	tagBoolSlice
+	tagIntSlice
+	tagInt8Slice
+	tagInt16Slice
+	tagInt32Slice
+	tagInt64Slice
+	tagUintSlice
+	tagUint16Slice
+	tagUint32Slice
+	tagUint64Slice
+	tagFloat32Slice
+	tagFloat64Slice
+	tagStringSlice
+	tagJSON byte = 0xFF
+)
+
+// Encode the value with a leading type tag
+func (TypedCodec) Marshal(value any) ([]byte, error) {
+	switch v := value.(type) {
+		case nil:
+			return []byte{ tagNil }, nil
+		case []byte:
+			return append([]byte{ tagBytes }, v...), nil
+		case string:
+			return append([]byte{ tagString }, v...), nil
+		case bool:
+			if v {
+				return []byte{ tagBool, 1 }, nil
+			}
+			return []byte{ tagBool, 0 }, nil
+		case int:
+			return binary.BigEndian.AppendUint64([]byte{ tagInt }, uint64(v)), nil
+		case int8:
+			return []byte{ tagInt8, byte(v) }, nil
+		case int16:
+			return binary.BigEndian.AppendUint16([]byte{ tagInt16 }, uint16(v)), nil
+		case int32:
+			return binary.BigEndian.AppendUint32([]byte{ tagInt32 }, uint32(v)), nil
+		case int64:
+			return binary.BigEndian.AppendUint64([]byte{ tagInt64 }, uint64(v)), nil
+		case uint:
+			return binary.BigEndian.AppendUint64([]byte{ tagUint }, uint64(v)), nil
+		case uint8:
+			return []byte{ tagUint8, v }, nil
+		case uint16:
+			return binary.BigEndian.AppendUint16([]byte{ tagUint16 }, v), nil
+		case uint32:
+			return binary.BigEndian.AppendUint32([]byte{ tagUint32 }, v), nil
+		case uint64:
+			return binary.BigEndian.AppendUint64([]byte{ tagUint64 }, v), nil
+		case float32:
+			return binary.BigEndian.AppendUint32([]byte{ tagFloat32 }, math.Float32bits(v)), nil
+		case float64:
+			return binary.BigEndian.AppendUint64([]byte{ tagFloat64 }, math.Float64bits(v)), nil
+		case uuid.UUID:
+			return append([]byte{ tagUUID }, v[:]...), nil
+		case []bool:
+			return marshalJSON(tagBoolSlice, v)
+		case []int:
+			return marshalJSON(tagIntSlice, v)
+		case []int8:
+			return marshalJSON(tagInt8Slice, v)
+		case []int16:
+			return marshalJSON(tagInt16Slice, v)
+		case []int32:
+			return marshalJSON(tagInt32Slice, v)
+		case []int64:
+			return marshalJSON(tagInt64Slice, v)
+		case []uint:
+			return marshalJSON(tagUintSlice, v)
+		case []uint16:
+			return marshalJSON(tagUint16Slice, v)
+		case []uint32:
+			return marshalJSON(tagUint32Slice, v)
+		case []uint64:
+			return marshalJSON(tagUint64Slice, v)
+		case []float32:
+			return marshalJSON(tagFloat32Slice, v)
+		case []float64:
+			return marshalJSON(tagFloat64Slice, v)
+		case []string:
+			return marshalJSON(tagStringSlice, v)
+	}
+
+	return marshalJSON(tagJSON, value)
+}
+
+// Decode a tagged byte slice back into its original type
+func (TypedCodec) Unmarshal(data []byte) (any, error) {
+	if len(data) < 1 {
+		return nil, errors.New("encoded values may not be zero length")
+	}
+
+	tag, body := data[0], data[1:]
+
+	switch tag {
+		case tagNil:
+			return nil, nil
+		case tagBytes:
+			return append([]byte{}, body...), nil
+		case tagString:
+			return string(body), nil
+		case tagBool:
+			if len(body) != 1 {
+				return nil, errors.New("invalid encoded bool value")
+			}
+			return body[0] == 1, nil
+		case tagInt8, tagUint8:
+			if len(body) != 1 {
+				return nil, errors.New("invalid encoded 8-bit value")
+			}
+			if tag == tagInt8 {
+				return int8(body[0]), nil
+			}
+			return body[0], nil
+		case tagInt16, tagUint16:
+			if len(body) != 2 {
+				return nil, errors.New("invalid encoded 16-bit value")
+			}
+			if tag == tagInt16 {
+				return int16(binary.BigEndian.Uint16(body)), nil
+			}
+			return binary.BigEndian.Uint16(body), nil
+		case tagInt32, tagUint32, tagFloat32:
+			if len(body) != 4 {
+				return nil, errors.New("invalid encoded 32-bit value")
+			}
+			bits := binary.BigEndian.Uint32(body)
+			switch tag {
+				case tagInt32:
+					return int32(bits), nil
+				case tagFloat32:
+					return math.Float32frombits(bits), nil
+			}
+			return bits, nil
+		case tagInt, tagInt64, tagUint, tagUint64, tagFloat64:
+			if len(body) != 8 {
+				return nil, errors.New("invalid encoded 64-bit value")
+			}
+			bits := binary.BigEndian.Uint64(body)
+			switch tag {
+				case tagInt:
+					return int(bits), nil
+				case tagInt64:
+					return int64(bits), nil
+				case tagUint:
+					return uint(bits), nil
+				case tagFloat64:
+					return math.Float64frombits(bits), nil
+			}
+			return bits, nil
+		case tagUUID:
+			token, err := uuid.FromBytes(body)
+			if err != nil {
+				return nil, errors.New("invalid encoded UUID value")
+			}
+			return token, nil
+		case tagBoolSlice:
+			return unmarshalJSON[bool](body)
+		case tagIntSlice:
+			return unmarshalJSON[int](body)
+		case tagInt8Slice:
+			return unmarshalJSON[int8](body)
+		case tagInt16Slice:
+			return unmarshalJSON[int16](body)
+		case tagInt32Slice:
+			return unmarshalJSON[int32](body)
+		case tagInt64Slice:
+			return unmarshalJSON[int64](body)
+		case tagUintSlice:
+			return unmarshalJSON[uint](body)
+		case tagUint16Slice:
+			return unmarshalJSON[uint16](body)
+		case tagUint32Slice:
+			return unmarshalJSON[uint32](body)
+		case tagUint64Slice:
+			return unmarshalJSON[uint64](body)
+		case tagFloat32Slice:
+			return unmarshalJSON[float32](body)
+		case tagFloat64Slice:
+			return unmarshalJSON[float64](body)
+		case tagStringSlice:
+			return unmarshalJSON[string](body)
+		case tagJSON:
+			var decoded any
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				return nil, err
+			}
+			return decoded, nil
+	}
+
+	return nil, errors.New("unknown encoded value type")
+}
+
+// Encode the value as JSON behind the given tag
+func marshalJSON(tag byte, value any) ([]byte, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{ tag }, encoded...), nil
+}
+
+// Decode a JSON array into a slice of the original element type
+func unmarshalJSON[T any](data []byte) (any, error) {
+	var decoded []T
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,249 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Storage interface that is implemented by storage providers
+type Storage struct {
+	db			storage.Storage
+	algorithm	Algorithm
+	threshold	int
+	level		int
+	codec		storage.Codec
+	encoder		*zstd.Encoder
+	decoder		*zstd.Decoder
+}
+
+// New creates a new compressing storage around Config.Storage
+func New(config ...Config) *Storage {
+	// Set default config
+	cfg := configDefault(config...)
+
+	if cfg.Storage == nil {
+		panic(errors.New("compress: a Storage to wrap is required"))
+	}
+
+	if cfg.Algorithm != Gzip && cfg.Algorithm != Zstd && cfg.Algorithm != Snappy {
+		panic(errors.New("compress: unknown compression algorithm"))
+	}
+
+	level := zstd.SpeedDefault
+	if cfg.Algorithm == Zstd && cfg.Level > 0 {
+		level = zstd.EncoderLevelFromZstd(cfg.Level)
+	}
+
+	// Both are safe for concurrent use through EncodeAll / DecodeAll
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	if err != nil {
+		panic(err)
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+
+	// Create storage
+	return &Storage{
+		db:			cfg.Storage,
+		algorithm:	cfg.Algorithm,
+		threshold:	cfg.Threshold,
+		level:		cfg.Level,
+		codec:		cfg.Codec,
+		encoder:	encoder,
+		decoder:	decoder,
+	}
+}
+
+// Get value by key
+func (s *Storage) Get(key string) *storage.Result {
+	result := s.db.Get(key)
+	if result.Error != nil || result.Missed {
+		return result
+	}
+
+	value, ok := s.decode(result.Value)
+	if !ok {
+		return result
+	}
+
+	return &storage.Result{ Value: value, Error: nil, Missed: false }
+}
+
+// Set key with value
+func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
+	if len(key) <= 0 {
+		return errors.New("storage keys cannot be zero length")
+	}
+
+	encoded, err := s.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	// Values that are too small or would not shrink are stored as they are, unless they would be mistaken for a
+	// compressed value on Get
+	if len(encoded) < s.threshold && !s.ambiguous(value) {
+		return s.db.Set(key, value, expiry...)
+	}
+
+	compressed, err := s.compress(encoded)
+	if err != nil {
+		return err
+	}
+
+	// Not worth it, store the original
+	if len(compressed) > len(encoded) && !s.ambiguous(value) {
+		return s.db.Set(key, value, expiry...)
+	}
+
+	return s.db.Set(key, compressed, expiry...)
+}
+
+// ambiguous reports whether a value would be decoded on Get if it was stored as it is, these are always compressed
+func (s *Storage) ambiguous(value any) bool {
+	_, ok := s.decode(value)
+	return ok
+}
+
+// Delete entries by key
+func (s *Storage) Delete(keys ...string) error {
+	return s.db.Delete(keys...)
+}
+
+// Reset all keys
+func (s *Storage) Reset() error {
+	return s.db.Reset()
+}
+
+// Close the wrapped storage
+func (s *Storage) Close() error {
+	s.encoder.Close()
+	s.decoder.Close()
+
+	return s.db.Close()
+}
+
+// Return the wrapped storage
+func (s *Storage) Conn() storage.Storage {
+	return s.db
+}
+
+// compress the encoded value with the configured algorithm and prefix it with its header byte
+func (s *Storage) compress(data []byte) ([]byte, error) {
+	out := []byte{ byte(s.algorithm) }
+
+	switch s.algorithm {
+		case Gzip:
+			level := gzip.DefaultCompression
+			if s.level > 0 {
+				level = s.level
+			}
+
+			buf := bytes.NewBuffer(out)
+			writer, err := gzip.NewWriterLevel(buf, level)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := writer.Write(data); err != nil {
+				return nil, err
+			}
+			if err := writer.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		case Zstd:
+			return s.encoder.EncodeAll(data, out), nil
+		case Snappy:
+			return append(out, snappy.Encode(nil, data)...), nil
+	}
+
+	return nil, errors.New("unknown compression algorithm")
+}
+
+// decompress a body written with the given algorithm
+func (s *Storage) decompress(algorithm Algorithm, data []byte) ([]byte, error) {
+	switch algorithm {
+		case Gzip:
+			reader, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+			return io.ReadAll(reader)
+		case Zstd:
+			return s.decoder.DecodeAll(data, nil)
+		case Snappy:
+			return snappy.Decode(nil, data)
+	}
+
+	return nil, errors.New("unknown compression algorithm")
+}
+
+// decode returns the original value of a stored value, ok is false for values that were not written by the wrapper.
+// Values stored as they are only start with a header byte if they are []byte, those that cannot be decoded are
+// returned untouched.
+func (s *Storage) decode(value any) (any, bool) {
+	algorithm, body, ok := header(value)
+	if !ok {
+		return nil, false
+	}
+
+	decompressed, err := s.decompress(algorithm, body)
+	if err != nil {
+		return nil, false
+	}
+
+	decoded, err := s.codec.Unmarshal(decompressed)
+	if err != nil {
+		return nil, false
+	}
+
+	return decoded, true
+}
+
+// header splits a stored []byte value into its algorithm and body. Drivers that return []byte values as strings
+// (i.e. Redis) are also understood, the header bytes can never start a valid UTF-8 string. Drivers that keep values
+// as JSON (i.e. the SQL drivers) return them base64 encoded, strings that decode to a header are tried as well.
+func header(value any) (Algorithm, []byte, bool) {
+	var data []byte
+
+	switch v := value.(type) {
+		case []byte:
+			data = v
+		case string:
+			data = []byte(v)
+			if len(v) > 0 && !isHeader(v[0]) {
+				data = nil
+				if decoded, err := base64.StdEncoding.DecodeString(v); err == nil {
+					data = decoded
+				}
+			}
+	}
+
+	if len(data) < 1 || !isHeader(data[0]) {
+		return 0, nil, false
+	}
+
+	return Algorithm(data[0]), data[1:], true
+}
+
+// isHeader reports whether b is one of the header bytes
+func isHeader(b byte) bool {
+	switch Algorithm(b) {
+		case Gzip, Zstd, Snappy:
+			return true
+	}
+
+	return false
+}
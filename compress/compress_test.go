@@ -0,0 +1,203 @@
+package compress
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage/memory"
+)
+
+var (
+	testBackend = memory.New()
+	testStore   = New(Config{
+		Storage:   testBackend,
+		Threshold: 64,
+	})
+	testLarge   = strings.Repeat("<p>a rendered fragment</p>", 100)
+)
+
+func Test_Compress_Set_Below_Threshold(t *testing.T) {
+	var (
+		key = "john"
+		val = "doe"
+	)
+
+	err := testStore.Set(key, val, 0)
+	utils.AssertEqual(t, nil, err)
+
+	// Stored as it is
+	stored, err, miss := testBackend.Get(key).String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, miss)
+	utils.AssertEqual(t, val, stored)
+
+	result, err, miss := testStore.Get(key).String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, miss)
+	utils.AssertEqual(t, val, result)
+}
+
+func Test_Compress_Set_Above_Threshold(t *testing.T) {
+	key := "page"
+
+	err := testStore.Set(key, testLarge, 0)
+	utils.AssertEqual(t, nil, err)
+
+	stored, err, _ := testBackend.Get(key).Bytes()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, byte(Zstd), stored[0])
+	utils.AssertEqual(t, true, len(stored) < len(testLarge))
+
+	result, err, miss := testStore.Get(key).String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, miss)
+	utils.AssertEqual(t, testLarge, result)
+}
+
+func Test_Compress_Algorithms(t *testing.T) {
+	for _, algorithm := range []Algorithm{ Gzip, Zstd, Snappy } {
+		store := New(Config{
+			Storage:   testBackend,
+			Algorithm: algorithm,
+			Threshold: 64,
+		})
+
+		err := store.Set("algorithm", testLarge, 0)
+		utils.AssertEqual(t, nil, err)
+
+		stored, _, _ := testBackend.Get("algorithm").Bytes()
+		utils.AssertEqual(t, byte(algorithm), stored[0])
+
+		// Any algorithm can be read regardless of the configured one
+		result, err, _ := testStore.Get("algorithm").String()
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, testLarge, result)
+	}
+}
+
+func Test_Compress_Types(t *testing.T) {
+	ints := make([]int, 100)
+	for i := range ints {
+		ints[i] = i % 3
+	}
+
+	err := testStore.Set("ints", ints, 0)
+	utils.AssertEqual(t, nil, err)
+
+	result, err, miss := testStore.Get("ints").IntSlice()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, miss)
+	utils.AssertEqual(t, ints, result)
+}
+
+func Test_Compress_Get_Uncompressed(t *testing.T) {
+	err := testBackend.Set("legacy", testLarge, 0)
+	utils.AssertEqual(t, nil, err)
+
+	result, err, miss := testStore.Get("legacy").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, miss)
+	utils.AssertEqual(t, testLarge, result)
+}
+
+func Test_Compress_Get_Legacy(t *testing.T) {
+	// Values that were in the store before the wrapper are returned untouched, even if they look like base64 or start
+	// with a header byte
+	for _, val := range []any{ "9gE=", "+ABC", []byte{ byte(Gzip), 1, 2, 3 }, []byte{ byte(Snappy), 0xFF } } {
+		err := testBackend.Set("legacy", val, 0)
+		utils.AssertEqual(t, nil, err)
+
+		result, err, miss := testStore.Get("legacy").Interface()
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, false, miss)
+		utils.AssertEqual(t, val, result)
+
+		// And read back the same once they are written through the wrapper
+		err = testStore.Set("legacy", val, 0)
+		utils.AssertEqual(t, nil, err)
+
+		result, err, _ = testStore.Get("legacy").Interface()
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, val, result)
+	}
+}
+
+func Test_Compress_Set_Escaped(t *testing.T) {
+	// A small value that is itself a compressed value is compressed again, rather than stored as it is
+	encoded, err := testStore.codec.Marshal("doe")
+	utils.AssertEqual(t, nil, err)
+
+	val, err := testStore.compress(encoded)
+	utils.AssertEqual(t, nil, err)
+
+	err = testStore.Set("escaped", val, 0)
+	utils.AssertEqual(t, nil, err)
+
+	stored, err, _ := testBackend.Get("escaped").Bytes()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, string(stored) == string(val))
+
+	result, err, _ := testStore.Get("escaped").Bytes()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, val, result)
+}
+
+func Test_Compress_Get_Base64(t *testing.T) {
+	// The SQL drivers keep values as JSON and return []byte values base64 encoded
+	for _, val := range []any{ testLarge, []byte(testLarge) } {
+		err := testStore.Set("base64", val, 0)
+		utils.AssertEqual(t, nil, err)
+
+		stored, err, _ := testBackend.Get("base64").Bytes()
+		utils.AssertEqual(t, nil, err)
+
+		err = testBackend.Set("base64", base64.StdEncoding.EncodeToString(stored), 0)
+		utils.AssertEqual(t, nil, err)
+
+		result, err, miss := testStore.Get("base64").Interface()
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, false, miss)
+		utils.AssertEqual(t, val, result)
+	}
+}
+
+func Test_Compress_Get_NotExist(t *testing.T) {
+	result := testStore.Get("notexist")
+	utils.AssertEqual(t, nil, result.Err())
+	utils.AssertEqual(t, true, result.Miss())
+}
+
+func Test_Compress_Delete(t *testing.T) {
+	err := testStore.Set("john", testLarge, 0)
+	utils.AssertEqual(t, nil, err)
+
+	err = testStore.Delete("john")
+	utils.AssertEqual(t, nil, err)
+
+	utils.AssertEqual(t, true, testStore.Get("john").Miss())
+}
+
+func Test_Compress_Close(t *testing.T) {
+	utils.AssertEqual(t, nil, testStore.Close())
+}
+
+// go test -v -run=^$ -bench=Benchmark_Compress -benchmem -count=4
+func Benchmark_Compress(b *testing.B) {
+	for _, algorithm := range []Algorithm{ Gzip, Zstd, Snappy } {
+		store := New(Config{
+			Storage:   memory.New(),
+			Algorithm: algorithm,
+		})
+
+		b.Run(map[Algorithm]string{ Gzip: "gzip", Zstd: "zstd", Snappy: "snappy" }[algorithm], func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				_ = store.Set("page", testLarge)
+				_ = store.Get("page")
+			}
+		})
+	}
+}
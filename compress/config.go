@@ -0,0 +1,83 @@
+package compress
+
+import (
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Algorithm is the compression algorithm, its value is also the header byte written in front of compressed values.
+// The header bytes can never start a valid UTF-8 string, so they will not be confused with existing text values.
+type Algorithm byte
+
+const (
+	// Gzip (RFC 1952), slowest but understood everywhere
+	Gzip Algorithm = 0xF5
+
+	// Zstandard, the best compression ratio for its speed
+	Zstd Algorithm = 0xF6
+
+	// Snappy, the fastest but weakest compression
+	Snappy Algorithm = 0xF7
+)
+
+// Config defines the config for storage.
+type Config struct {
+	// Storage that the compressed values will be written to
+	//
+	// Required. Default is nil
+	Storage storage.Storage
+
+	// Compression algorithm used for new values, values written with any algorithm can always be read
+	//
+	// Optional. Default is Zstd
+	Algorithm Algorithm
+
+	// Values whose encoding is shorter than this number of bytes are stored as they are, uncompressed
+	//
+	// Optional. Default is 1024
+	Threshold int
+
+	// Compression level, its meaning depends on the algorithm (gzip: 1-9, zstd: 1-22, snappy: ignored)
+	//
+	// Optional. Default is 0 (the algorithm's default level)
+	Level int
+
+	// Codec used to convert values to bytes before they are compressed
+	//
+	// Optional. Default is storage.DefaultCodec
+	Codec storage.Codec
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Storage:	nil,
+	Algorithm:	Zstd,
+	Threshold:	1024,
+	Level:		0,
+	Codec:		storage.DefaultCodec,
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		return ConfigDefault
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.Algorithm == 0 {
+		cfg.Algorithm = ConfigDefault.Algorithm
+	}
+
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = ConfigDefault.Threshold
+	}
+
+	if cfg.Codec == nil {
+		cfg.Codec = ConfigDefault.Codec
+	}
+
+	return cfg
+}
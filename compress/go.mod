@@ -0,0 +1,8 @@
+module github.com/paul-norman/go-fiber-storage/compress
+
+go 1.22
+
+require (
+	github.com/gofiber/utils v1.1.0
+	github.com/klauspost/compress v1.18.0
+)
@@ -0,0 +1,82 @@
+package encrypt
+
+import (
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Algorithm is the AEAD cipher, its value is also the header byte written in front of encrypted values.
+// The header bytes can never start a valid UTF-8 string, so they will not be confused with plain text values.
+type Algorithm byte
+
+const (
+	// AES-256 in Galois/Counter Mode with a random 12 byte nonce
+	AESGCM Algorithm = 0xF9
+
+	// XChaCha20-Poly1305 with a random 24 byte nonce, preferable on hardware without AES instructions
+	XChaCha20Poly1305 Algorithm = 0xFA
+)
+
+// Config defines the config for storage.
+type Config struct {
+	// Storage that the encrypted values will be written to
+	//
+	// Required. Default is nil
+	Storage storage.Storage
+
+	// 32 byte encryption keys indexed by their ID, the ID is stored with every value so that old keys can still decrypt
+	//
+	// Required. Default is nil
+	Keys map[byte][]byte
+
+	// ID of the key in Keys that is used to encrypt new values
+	//
+	// Optional. Default is 0
+	KeyID byte
+
+	// Cipher used for new values, values written with either cipher can always be read
+	//
+	// Optional. Default is AESGCM
+	Algorithm Algorithm
+
+	// Return values that are not encrypted instead of an error (useful while migrating existing data)
+	//
+	// Optional. Default is false
+	AllowPlaintext bool
+
+	// Codec used to convert values to bytes before they are encrypted
+	//
+	// Optional. Default is storage.DefaultCodec
+	Codec storage.Codec
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Storage:		nil,
+	Keys:			nil,
+	KeyID:			0,
+	Algorithm:		AESGCM,
+	AllowPlaintext:	false,
+	Codec:			storage.DefaultCodec,
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		return ConfigDefault
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.Algorithm == 0 {
+		cfg.Algorithm = ConfigDefault.Algorithm
+	}
+
+	if cfg.Codec == nil {
+		cfg.Codec = ConfigDefault.Codec
+	}
+
+	return cfg
+}
@@ -0,0 +1,271 @@
+package encrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Storage interface that is implemented by storage providers
+type Storage struct {
+	db				storage.Storage
+	keyID			byte
+	algorithm		Algorithm
+	aeads			map[Algorithm]map[byte]cipher.AEAD
+	allowPlaintext	bool
+	codec			storage.Codec
+}
+
+// Length of the algorithm and key ID header
+const headerLength = 2
+
+// New creates a new encrypting storage around Config.Storage
+func New(config ...Config) *Storage {
+	// Set default config
+	cfg := configDefault(config...)
+
+	if cfg.Storage == nil {
+		panic(errors.New("encrypt: a Storage to wrap is required"))
+	}
+
+	if cfg.Algorithm != AESGCM && cfg.Algorithm != XChaCha20Poly1305 {
+		panic(errors.New("encrypt: unknown encryption algorithm"))
+	}
+
+	if _, ok := cfg.Keys[cfg.KeyID]; !ok {
+		panic(fmt.Errorf("encrypt: the current key ID %d is not present in Keys", cfg.KeyID))
+	}
+
+	aeads := map[Algorithm]map[byte]cipher.AEAD{
+		AESGCM:				{},
+		XChaCha20Poly1305:	{},
+	}
+
+	for id, key := range cfg.Keys {
+		if len(key) != 32 {
+			panic(fmt.Errorf("encrypt: key ID %d must be 32 bytes long", id))
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			panic(err)
+		}
+
+		if aeads[AESGCM][id], err = cipher.NewGCM(block); err != nil {
+			panic(err)
+		}
+
+		if aeads[XChaCha20Poly1305][id], err = chacha20poly1305.NewX(key); err != nil {
+			panic(err)
+		}
+	}
+
+	// Create storage
+	return &Storage{
+		db:				cfg.Storage,
+		keyID:			cfg.KeyID,
+		algorithm:		cfg.Algorithm,
+		aeads:			aeads,
+		allowPlaintext:	cfg.AllowPlaintext,
+		codec:			cfg.Codec,
+	}
+}
+
+// Get value by key
+func (s *Storage) Get(key string) *storage.Result {
+	if len(key) <= 0 {
+		return &storage.Result{ Value: nil, Error: errors.New("storage keys cannot be zero length"), Missed: false }
+	}
+
+	result := s.db.Get(key)
+	if result.Error != nil || result.Missed {
+		return result
+	}
+
+	sealed, ok := payload(result.Value)
+	if !ok {
+		if s.allowPlaintext {
+			return result
+		}
+		return &storage.Result{ Value: nil, Error: errors.New("stored value is not encrypted"), Missed: false }
+	}
+
+	value, err := s.open(key, sealed)
+	if err != nil {
+		return &storage.Result{ Value: nil, Error: err, Missed: false }
+	}
+
+	return &storage.Result{ Value: value, Error: nil, Missed: false }
+}
+
+// Set key with value
+func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
+	if len(key) <= 0 {
+		return errors.New("storage keys cannot be zero length")
+	}
+
+	sealed, err := s.seal(key, value)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Set(key, sealed, expiry...)
+}
+
+// Delete entries by key
+func (s *Storage) Delete(keys ...string) error {
+	return s.db.Delete(keys...)
+}
+
+// Reset all keys
+func (s *Storage) Reset() error {
+	return s.db.Reset()
+}
+
+// Close the wrapped storage
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// Return the wrapped storage
+func (s *Storage) Conn() storage.Storage {
+	return s.db
+}
+
+// Rotate re-encrypts the given keys with the current key ID and algorithm, returning the number of entries rewritten.
+// Missing keys and values that are already current are skipped.
+// Rotation resets the TTL of every rewritten entry: the Storage interface cannot report the remaining lifetime of an
+// entry, so they all receive the given expiry (0 stores them without one).
+func (s *Storage) Rotate(keys []string, expiry time.Duration) (int, error) {
+	rotated := 0
+
+	for _, key := range keys {
+		result := s.db.Get(key)
+		if result.Error != nil {
+			return rotated, result.Error
+		}
+
+		if result.Missed {
+			continue
+		}
+
+		sealed, ok := payload(result.Value)
+		if ok && Algorithm(sealed[0]) == s.algorithm && sealed[1] == s.keyID {
+			continue
+		}
+
+		var value any
+		if ok {
+			opened, err := s.open(key, sealed)
+			if err != nil {
+				return rotated, fmt.Errorf("encrypt: unable to rotate %q: %w", key, err)
+			}
+			value = opened
+		} else if s.allowPlaintext {
+			value = result.Value
+		} else {
+			return rotated, fmt.Errorf("encrypt: unable to rotate %q: stored value is not encrypted", key)
+		}
+
+		if err := s.Set(key, value, expiry); err != nil {
+			return rotated, err
+		}
+
+		rotated++
+	}
+
+	return rotated, nil
+}
+
+// seal encodes and encrypts the value with the current key, binding it to the storage key
+func (s *Storage) seal(key string, value any) ([]byte, error) {
+	encoded, err := s.codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	aead := s.aeads[s.algorithm][s.keyID]
+	header := []byte{ byte(s.algorithm), s.keyID }
+
+	out := make([]byte, headerLength + aead.NonceSize(), headerLength + aead.NonceSize() + len(encoded) + aead.Overhead())
+	copy(out, header)
+
+	nonce := out[headerLength:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(out, nonce, encoded, additionalData(header, key)), nil
+}
+
+// open decrypts and decodes a sealed value, failing if it was sealed for a different storage key
+func (s *Storage) open(key string, sealed []byte) (any, error) {
+	aead, ok := s.aeads[Algorithm(sealed[0])][sealed[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key ID %d", sealed[1])
+	}
+
+	if len(sealed) < headerLength + aead.NonceSize() + aead.Overhead() {
+		return nil, errors.New("encrypted value is too short")
+	}
+
+	nonce := sealed[headerLength : headerLength + aead.NonceSize()]
+	ciphertext := sealed[headerLength + aead.NonceSize():]
+
+	encoded, err := aead.Open(nil, nonce, ciphertext, additionalData(sealed[:headerLength], key))
+	if err != nil {
+		return nil, errors.New("unable to decrypt value (wrong key or tampered data)")
+	}
+
+	return s.codec.Unmarshal(encoded)
+}
+
+// additionalData authenticates the header and the storage key so that values cannot be moved between keys
+func additionalData(header []byte, key string) []byte {
+	return append(append([]byte{}, header...), key...)
+}
+
+// payload returns the sealed bytes of a stored value.
+// Redis hands []byte values back as strings and the JSON based SQL drivers as base64 strings, so all three forms are checked.
+func payload(value any) ([]byte, bool) {
+	var data []byte
+
+	switch v := value.(type) {
+		case []byte:
+			data = v
+		case string:
+			data = []byte(v)
+			if !isSealed(data) {
+				if decoded, err := base64.StdEncoding.DecodeString(v); err == nil {
+					data = decoded
+				}
+			}
+	}
+
+	if !isSealed(data) {
+		return nil, false
+	}
+
+	return data, true
+}
+
+// isSealed reports whether the data starts with a valid header
+func isSealed(data []byte) bool {
+	if len(data) < headerLength {
+		return false
+	}
+
+	switch Algorithm(data[0]) {
+		case AESGCM, XChaCha20Poly1305:
+			return true
+	}
+
+	return false
+}
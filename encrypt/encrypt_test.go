@@ -0,0 +1,240 @@
+package encrypt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage/clocktest"
+	"github.com/paul-norman/go-fiber-storage/memory"
+)
+
+var (
+	testKey1    = bytes.Repeat([]byte{ 1 }, 32)
+	testKey2    = bytes.Repeat([]byte{ 2 }, 32)
+	testBackend = memory.New()
+	testStore   = New(Config{
+		Storage: testBackend,
+		Keys:    map[byte][]byte{ 1: testKey1 },
+		KeyID:   1,
+	})
+)
+
+func Test_Encrypt_Set(t *testing.T) {
+	var (
+		key = "john"
+		val = "doe"
+	)
+
+	err := testStore.Set(key, val, 0)
+	utils.AssertEqual(t, nil, err)
+
+	// Stored sealed with the header, key ID and no trace of the plain text
+	stored, err, _ := testBackend.Get(key).Bytes()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, byte(AESGCM), stored[0])
+	utils.AssertEqual(t, byte(1), stored[1])
+	utils.AssertEqual(t, false, bytes.Contains(stored, []byte(val)))
+}
+
+func Test_Encrypt_Get(t *testing.T) {
+	var (
+		key = "john"
+		val = map[string]any{ "token": "secret" }
+	)
+
+	err := testStore.Set(key, val, 0)
+	utils.AssertEqual(t, nil, err)
+
+	result, err, miss := testStore.Get(key).Interface()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, miss)
+	utils.AssertEqual(t, val, result)
+}
+
+func Test_Encrypt_XChaCha20Poly1305(t *testing.T) {
+	store := New(Config{
+		Storage:   testBackend,
+		Keys:      map[byte][]byte{ 1: testKey1 },
+		KeyID:     1,
+		Algorithm: XChaCha20Poly1305,
+	})
+
+	err := store.Set("xchacha", int64(42), 0)
+	utils.AssertEqual(t, nil, err)
+
+	stored, _, _ := testBackend.Get("xchacha").Bytes()
+	utils.AssertEqual(t, byte(XChaCha20Poly1305), stored[0])
+
+	// Readable regardless of the configured algorithm
+	result, err, _ := testStore.Get("xchacha").Int64()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, int64(42), result)
+}
+
+func Test_Encrypt_Get_Swapped(t *testing.T) {
+	err := testStore.Set("alice", "alice's session", 0)
+	utils.AssertEqual(t, nil, err)
+
+	// Copy the ciphertext to another key
+	stored, _, _ := testBackend.Get("alice").Bytes()
+	err = testBackend.Set("mallory", stored, 0)
+	utils.AssertEqual(t, nil, err)
+
+	result := testStore.Get("mallory")
+	utils.AssertEqual(t, true, result.Err() != nil)
+	utils.AssertEqual(t, nil, result.Val())
+}
+
+func Test_Encrypt_Get_Base64(t *testing.T) {
+	err := testStore.Set("base64", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+
+	// Mimic the JSON based SQL drivers which return []byte values as base64 strings
+	stored, _, _ := testBackend.Get("base64").Bytes()
+	err = testBackend.Set("base64", base64.StdEncoding.EncodeToString(stored), 0)
+	utils.AssertEqual(t, nil, err)
+
+	result, err, _ := testStore.Get("base64").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "doe", result)
+}
+
+func Test_Encrypt_Get_Plaintext(t *testing.T) {
+	err := testBackend.Set("plain", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+
+	result := testStore.Get("plain")
+	utils.AssertEqual(t, true, result.Err() != nil)
+
+	store := New(Config{
+		Storage:        testBackend,
+		Keys:           map[byte][]byte{ 1: testKey1 },
+		KeyID:          1,
+		AllowPlaintext: true,
+	})
+
+	str, err, _ := store.Get("plain").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "doe", str)
+}
+
+func Test_Encrypt_Rotate(t *testing.T) {
+	err := testStore.Set("rotate1", "one", 0)
+	utils.AssertEqual(t, nil, err)
+
+	err = testStore.Set("rotate2", "two", 0)
+	utils.AssertEqual(t, nil, err)
+
+	rotated := New(Config{
+		Storage: testBackend,
+		Keys:    map[byte][]byte{ 1: testKey1, 2: testKey2 },
+		KeyID:   2,
+	})
+
+	// Old values are still readable with the new key set
+	str, err, _ := rotated.Get("rotate1").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "one", str)
+
+	count, err := rotated.Rotate([]string{ "rotate1", "rotate2", "notexist" }, 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 2, count)
+
+	stored, _, _ := testBackend.Get("rotate2").Bytes()
+	utils.AssertEqual(t, byte(2), stored[1])
+
+	// Already current
+	count, err = rotated.Rotate([]string{ "rotate1", "rotate2" }, 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 0, count)
+
+	// The retired key can be dropped
+	current := New(Config{
+		Storage: testBackend,
+		Keys:    map[byte][]byte{ 2: testKey2 },
+		KeyID:   2,
+	})
+
+	str, err, _ = current.Get("rotate2").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "two", str)
+
+	// Values sealed with an unknown key are an error
+	result := current.Get("john")
+	utils.AssertEqual(t, true, result.Err() != nil)
+}
+
+func Test_Encrypt_Rotate_Expiry(t *testing.T) {
+	clock := clocktest.NewFake()
+	backend := memory.New(memory.Config{ Clock: clock })
+	store := New(Config{
+		Storage: backend,
+		Keys:    map[byte][]byte{ 1: testKey1 },
+		KeyID:   1,
+	})
+
+	err := store.Set("session", "one", 0)
+	utils.AssertEqual(t, nil, err)
+
+	rotated := New(Config{
+		Storage: backend,
+		Keys:    map[byte][]byte{ 1: testKey1, 2: testKey2 },
+		KeyID:   2,
+	})
+
+	// Rotated entries receive the given expiry
+	count, err := rotated.Rotate([]string{ "session" }, time.Hour)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 1, count)
+
+	clock.Advance(time.Hour + time.Second)
+
+	result := rotated.Get("session")
+	utils.AssertEqual(t, nil, result.Err())
+	utils.AssertEqual(t, true, result.Miss())
+}
+
+func Test_Encrypt_Get_NotExist(t *testing.T) {
+	result := testStore.Get("notexist")
+	utils.AssertEqual(t, nil, result.Err())
+	utils.AssertEqual(t, true, result.Miss())
+}
+
+func Test_Encrypt_Delete(t *testing.T) {
+	err := testStore.Set("john", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+
+	err = testStore.Delete("john")
+	utils.AssertEqual(t, nil, err)
+
+	utils.AssertEqual(t, true, testStore.Get("john").Miss())
+}
+
+func Test_Encrypt_Close(t *testing.T) {
+	utils.AssertEqual(t, nil, testStore.Close())
+}
+
+// go test -v -run=^$ -bench=Benchmark_Encrypt -benchmem -count=4
+func Benchmark_Encrypt(b *testing.B) {
+	value := bytes.Repeat([]byte("session"), 64)
+
+	for name, algorithm := range map[string]Algorithm{ "aes_gcm": AESGCM, "xchacha20_poly1305": XChaCha20Poly1305 } {
+		store := New(Config{
+			Storage:   memory.New(),
+			Keys:      map[byte][]byte{ 0: testKey1 },
+			Algorithm: algorithm,
+		})
+
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				_ = store.Set("session", value)
+				_ = store.Get("session")
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+module github.com/paul-norman/go-fiber-storage/encrypt
+
+go 1.19
+
+require (
+	github.com/gofiber/utils v1.1.0
+	golang.org/x/crypto v0.11.0
+)
+
+require golang.org/x/sys v0.10.0 // indirect
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNegativeExpiry is returned by Set when the expiry is negative
+var ErrNegativeExpiry = errors.New("storage expiry cannot be negative")
+
+// Expiry returns the optional expiry passed to Set. Expiries are precise to the millisecond, so they are rounded up
+// to a whole millisecond: a very short expiry never becomes 0 (no expiration). Negative expiries are rejected.
+func Expiry(expiry ...time.Duration) (time.Duration, error) {
+	if len(expiry) < 1 || expiry[0] == 0 {
+		return 0, nil
+	}
+
+	if expiry[0] < 0 {
+		return 0, ErrNegativeExpiry
+	}
+
+	exp := expiry[0].Truncate(time.Millisecond)
+	if exp < expiry[0] {
+		exp += time.Millisecond
+	}
+
+	return exp, nil
+}
+
+// ExpiresAt returns the unix time in milliseconds that an expiry from Expiry ends at, 0 when there is no expiry
+func ExpiresAt(now time.Time, expiry time.Duration) int64 {
+	if expiry <= 0 {
+		return 0
+	}
+
+	return now.UnixMilli() + expiry.Milliseconds()
+}
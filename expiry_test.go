@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+func Test_Expiry(t *testing.T) {
+	cases := []struct {
+		in	[]time.Duration
+		out	time.Duration
+		err	error
+	}{
+		{ nil, 0, nil },
+		{ []time.Duration{ 0 }, 0, nil },
+		{ []time.Duration{ time.Nanosecond }, time.Millisecond, nil },
+		{ []time.Duration{ 1500 * time.Millisecond }, 1500 * time.Millisecond, nil },
+		{ []time.Duration{ 1500*time.Millisecond + 1 }, 1501 * time.Millisecond, nil },
+		{ []time.Duration{ -time.Second }, 0, ErrNegativeExpiry },
+	}
+
+	for _, c := range cases {
+		exp, err := Expiry(c.in...)
+		utils.AssertEqual(t, c.err, err)
+		utils.AssertEqual(t, c.out, exp)
+	}
+}
+
+func Test_ExpiresAt(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+
+	utils.AssertEqual(t, int64(0), ExpiresAt(now, 0))
+	utils.AssertEqual(t, int64(1700000001500), ExpiresAt(now, 1500 * time.Millisecond))
+
+	// Far beyond 2106, when unix seconds no longer fit in 32 bits
+	utils.AssertEqual(t, time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli(), ExpiresAt(now, time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC).Sub(now)))
+}
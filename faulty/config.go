@@ -0,0 +1,120 @@
+package faulty
+
+import (
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Corruption is the damage done to values returned by Get
+type Corruption int
+
+const (
+	// Values are returned untouched
+	Intact Corruption = iota
+
+	// Values lose their second half
+	Truncate
+
+	// Values are replaced with random bytes of the same length
+	Garbage
+)
+
+// Rule describes the faults injected into matching operations.
+// When it fires, faults are applied in this order: latency, panic, error, miss, corruption.
+type Rule struct {
+	// Operations the rule applies to (storage.OpGet, storage.OpSet etc, case insensitive)
+	//
+	// Optional. Default is all operations
+	Operations []string
+
+	// Pattern (path.Match syntax, i.e. "session:*") that one of the operation's keys must match
+	//
+	// Optional. Default is "" (any key, including operations without keys)
+	Keys string
+
+	// Chance of the rule firing for each matching operation, between 0 and 1
+	//
+	// Optional. Default is 1 (always)
+	Probability float64
+
+	// Maximum number of times the rule fires, i.e. 2 to fail only the first two calls
+	//
+	// Optional. Default is 0 (unlimited)
+	Times int
+
+	// Delay added before the operation
+	//
+	// Optional. Default is 0
+	Latency time.Duration
+
+	// Random extra delay, between 0 and this value, added to Latency
+	//
+	// Optional. Default is 0
+	Jitter time.Duration
+
+	// Error returned instead of performing the operation
+	//
+	// Optional. Default is nil
+	Err error
+
+	// Report a miss from Get instead of reading the storage
+	//
+	// Optional. Default is false
+	Miss bool
+
+	// Damage done to values returned by Get
+	//
+	// Optional. Default is Intact
+	Corrupt Corruption
+
+	// Panic instead of performing the operation
+	//
+	// Optional. Default is false
+	Panic bool
+}
+
+// Config defines the config for storage.
+type Config struct {
+	// Storage that faults will be injected into
+	//
+	// Required. Default is nil
+	Storage storage.Storage
+
+	// Rules checked, in order, for every operation
+	//
+	// Optional. Default is none (operations are passed straight through)
+	Rules []Rule
+
+	// Seed for the random choices (probability, jitter and garbage), the same seed reproduces the same faults
+	//
+	// Optional. Default is 0 (a seed based on the current time, available from Seed())
+	Seed int64
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Storage:	nil,
+	Rules:		nil,
+	Seed:		0,
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		cfg := ConfigDefault
+		cfg.Seed = time.Now().UnixNano()
+		return cfg
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	return cfg
+}
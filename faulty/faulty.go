@@ -0,0 +1,280 @@
+package faulty
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// ErrInjected is a ready made error for rules that only need the operation to fail
+var ErrInjected = errors.New("faulty: injected error")
+
+// Names of the faults recorded in Call.Faults
+const (
+	FaultLatency	= "latency"
+	FaultPanic		= "panic"
+	FaultError		= "error"
+	FaultMiss		= "miss"
+	FaultTruncate	= "truncate"
+	FaultGarbage	= "garbage"
+)
+
+// Call is an operation that passed through the storage, with the faults that were injected into it
+type Call struct {
+	// Name of the operation (storage.OpGet etc)
+	Operation string
+
+	// Keys of the operation
+	Keys []string
+
+	// Faults injected, in the order they were applied (FaultLatency etc)
+	Faults []string
+
+	// Time taken, including injected latency
+	Duration time.Duration
+
+	// Error returned to the caller
+	Err error
+}
+
+// Storage injects faults into the operations on the wrapped storage and records every call
+type Storage struct {
+	storage.Chained
+
+	mux		sync.Mutex
+	rules	[]*rule
+	random	*rand.Rand
+	seed	int64
+	calls	[]Call
+}
+
+// rule is a Rule along with the number of times that it has fired
+type rule struct {
+	Rule
+	fired int
+}
+
+// New wraps Config.Storage, passing every operation through the configured rules
+func New(config ...Config) *Storage {
+	// Set default config
+	cfg := configDefault(config...)
+
+	if cfg.Storage == nil {
+		panic(errors.New("faulty: a Storage to wrap is required"))
+	}
+
+	s := &Storage{
+		random:	rand.New(rand.NewSource(cfg.Seed)),
+		seed:	cfg.Seed,
+	}
+	s.SetRules(cfg.Rules...)
+	s.Chained = storage.Use(cfg.Storage, s.middleware)
+
+	return s
+}
+
+// SetRules replaces the rules, so that faults can be switched on and off during a test
+func (s *Storage) SetRules(rules ...Rule) {
+	compiled := make([]*rule, 0, len(rules))
+	for _, r := range rules {
+		if _, err := path.Match(r.Keys, ""); err != nil {
+			panic(fmt.Errorf("faulty: invalid key pattern %q: %w", r.Keys, err))
+		}
+		if r.Probability == 0 {
+			r.Probability = 1
+		}
+		compiled = append(compiled, &rule{ Rule: r })
+	}
+
+	s.mux.Lock()
+	s.rules = compiled
+	s.mux.Unlock()
+}
+
+// Calls returns the operations recorded so far, oldest first
+func (s *Storage) Calls() []Call {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return append([]Call{}, s.calls...)
+}
+
+// ResetCalls clears the recorded operations
+func (s *Storage) ResetCalls() {
+	s.mux.Lock()
+	s.calls = nil
+	s.mux.Unlock()
+}
+
+// Seed returns the seed of the random choices, log it to reproduce a failure caused by a random fault
+func (s *Storage) Seed() int64 {
+	return s.seed
+}
+
+// fire returns the rules that fire for the operation along with the total injected latency
+func (s *Storage) fire(op *storage.Op) ([]*rule, time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var fired []*rule
+	var latency time.Duration
+
+	for _, r := range s.rules {
+		if !r.matches(op) || (r.Times > 0 && r.fired >= r.Times) {
+			continue
+		}
+		if r.Probability < 1 && s.random.Float64() >= r.Probability {
+			continue
+		}
+
+		r.fired++
+		fired = append(fired, r)
+
+		latency += r.Latency
+		if r.Jitter > 0 {
+			latency += time.Duration(s.random.Int63n(int64(r.Jitter) + 1))
+		}
+	}
+
+	return fired, latency
+}
+
+// matches reports whether the rule applies to the operation
+func (r *rule) matches(op *storage.Op) bool {
+	if len(r.Operations) > 0 {
+		found := false
+		for _, name := range r.Operations {
+			if strings.EqualFold(name, op.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.Keys == "" {
+		return true
+	}
+
+	for _, key := range op.Keys {
+		if ok, _ := path.Match(r.Keys, key); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Storage) middleware(next storage.Handler) storage.Handler {
+	return func(op *storage.Op) {
+		if op.Name == storage.OpClose {
+			next(op)
+			return
+		}
+
+		start := time.Now()
+		call := Call{ Operation: op.Name, Keys: append([]string{}, op.Keys...) }
+
+		// Recorded even when an injected panic unwinds through here
+		defer func() {
+			call.Duration = time.Since(start)
+			call.Err = op.Err
+
+			s.mux.Lock()
+			s.calls = append(s.calls, call)
+			s.mux.Unlock()
+		}()
+
+		fired, latency := s.fire(op)
+
+		if latency > 0 {
+			call.Faults = append(call.Faults, FaultLatency)
+
+			timer := time.NewTimer(latency)
+			select {
+				case <-timer.C:
+				case <-op.Context.Done():
+					timer.Stop()
+					op.Err = op.Context.Err()
+					return
+			}
+		}
+
+		for _, r := range fired {
+			switch {
+				case r.Panic:
+					call.Faults = append(call.Faults, FaultPanic)
+					panic(fmt.Sprintf("faulty: injected panic in %s %v", op.Name, op.Keys))
+				case r.Err != nil:
+					call.Faults = append(call.Faults, FaultError)
+					op.Err = r.Err
+					return
+				case r.Miss && op.Name == storage.OpGet:
+					call.Faults = append(call.Faults, FaultMiss)
+					op.Result = &storage.Result{ Value: nil, Error: nil, Missed: true }
+					return
+			}
+		}
+
+		next(op)
+
+		if op.Name != storage.OpGet || op.Err != nil || op.Result == nil || !op.Result.Hit() {
+			return
+		}
+
+		for _, r := range fired {
+			if r.Corrupt == Intact {
+				continue
+			}
+
+			value := s.corrupt(op.Result.Value, r.Corrupt)
+			op.Result = &storage.Result{ Value: value, Error: nil, Missed: false }
+
+			if r.Corrupt == Truncate {
+				call.Faults = append(call.Faults, FaultTruncate)
+			} else {
+				call.Faults = append(call.Faults, FaultGarbage)
+			}
+		}
+	}
+}
+
+// corrupt damages a value, strings and byte slices keep their type while anything else becomes a byte slice of its encoded form
+func (s *Storage) corrupt(value any, corruption Corruption) any {
+	var data []byte
+	_, isString := value.(string)
+
+	switch v := value.(type) {
+		case []byte:
+			data = v
+		case string:
+			data = []byte(v)
+		default:
+			data, _ = storage.DefaultCodec.Marshal(v)
+	}
+
+	switch corruption {
+		case Truncate:
+			data = data[:len(data) / 2]
+		case Garbage:
+			garbage := make([]byte, len(data))
+			s.mux.Lock()
+			s.random.Read(garbage)
+			s.mux.Unlock()
+			data = garbage
+	}
+
+	if isString {
+		return string(data)
+	}
+
+	return data
+}
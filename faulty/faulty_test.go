@@ -0,0 +1,172 @@
+package faulty
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/memory"
+)
+
+func Test_Faulty_Required(t *testing.T) {
+	defer func() {
+		utils.AssertEqual(t, true, recover() != nil)
+	}()
+
+	_ = New()
+}
+
+func Test_Faulty_PassThrough(t *testing.T) {
+	store := New(Config{ Storage: memory.New() })
+
+	utils.AssertEqual(t, nil, store.Set("john", "doe"))
+	val, err, missed := store.Get("john").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, missed)
+	utils.AssertEqual(t, "doe", val)
+
+	calls := store.Calls()
+	utils.AssertEqual(t, 2, len(calls))
+	utils.AssertEqual(t, storage.OpSet, calls[0].Operation)
+	utils.AssertEqual(t, []string{ "john" }, calls[1].Keys)
+	utils.AssertEqual(t, 0, len(calls[1].Faults))
+
+	store.ResetCalls()
+	utils.AssertEqual(t, 0, len(store.Calls()))
+}
+
+func Test_Faulty_Error(t *testing.T) {
+	store := New(Config{
+		Storage:	memory.New(),
+		Rules:		[]Rule{ { Operations: []string{ storage.OpSet }, Keys: "session:*", Err: ErrInjected } },
+	})
+
+	utils.AssertEqual(t, ErrInjected, store.Set("session:1", "doe"))
+	utils.AssertEqual(t, nil, store.Set("user:1", "doe"))
+	utils.AssertEqual(t, true, store.Get("session:1").Miss())
+
+	calls := store.Calls()
+	utils.AssertEqual(t, []string{ FaultError }, calls[0].Faults)
+	utils.AssertEqual(t, ErrInjected, calls[0].Err)
+	utils.AssertEqual(t, 0, len(calls[1].Faults))
+}
+
+func Test_Faulty_Times(t *testing.T) {
+	store := New(Config{
+		Storage:	memory.New(),
+		Rules:		[]Rule{ { Operations: []string{ "get" }, Err: ErrInjected, Times: 2 } },
+	})
+	_ = store.Set("john", "doe")
+
+	utils.AssertEqual(t, ErrInjected, store.Get("john").Err())
+	utils.AssertEqual(t, ErrInjected, store.Get("john").Err())
+	utils.AssertEqual(t, true, store.Get("john").Hit())
+}
+
+func Test_Faulty_Miss(t *testing.T) {
+	store := New(Config{
+		Storage:	memory.New(),
+		Rules:		[]Rule{ { Miss: true } },
+	})
+
+	utils.AssertEqual(t, nil, store.Set("john", "doe"))
+	utils.AssertEqual(t, true, store.Get("john").Miss())
+
+	store.SetRules()
+	utils.AssertEqual(t, true, store.Get("john").Hit())
+}
+
+func Test_Faulty_Corrupt(t *testing.T) {
+	store := New(Config{
+		Storage:	memory.New(),
+		Rules:		[]Rule{ { Keys: "truncate", Corrupt: Truncate }, { Keys: "garbage", Corrupt: Garbage } },
+	})
+
+	_ = store.Set("truncate", "abcdef")
+	val, err, _ := store.Get("truncate").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "abc", val)
+
+	_ = store.Set("garbage", []byte("abcdef"))
+	data, err, _ := store.Get("garbage").Bytes()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 6, len(data))
+
+	// The stored value is left alone
+	store.SetRules()
+	val, _, _ = store.Get("truncate").String()
+	utils.AssertEqual(t, "abcdef", val)
+
+	calls := store.Calls()
+	utils.AssertEqual(t, []string{ FaultTruncate }, calls[1].Faults)
+	utils.AssertEqual(t, []string{ FaultGarbage }, calls[3].Faults)
+}
+
+func Test_Faulty_Panic(t *testing.T) {
+	store := New(Config{
+		Storage:	memory.New(),
+		Rules:		[]Rule{ { Operations: []string{ storage.OpDelete }, Panic: true } },
+	})
+
+	func() {
+		defer func() {
+			utils.AssertEqual(t, true, recover() != nil)
+		}()
+		_ = store.Delete("john")
+	}()
+
+	calls := store.Calls()
+	utils.AssertEqual(t, 1, len(calls))
+	utils.AssertEqual(t, []string{ FaultPanic }, calls[0].Faults)
+}
+
+func Test_Faulty_Latency(t *testing.T) {
+	store := New(Config{
+		Storage:	memory.New(),
+		Rules:		[]Rule{ { Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond } },
+	})
+
+	start := time.Now()
+	utils.AssertEqual(t, nil, store.Set("john", "doe"))
+	utils.AssertEqual(t, true, time.Since(start) >= 50 * time.Millisecond)
+	utils.AssertEqual(t, []string{ FaultLatency }, store.Calls()[0].Faults)
+
+	// Cancelling the context cuts the delay short
+	ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Millisecond)
+	defer cancel()
+	err := store.SetContext(ctx, "john", "doe")
+	utils.AssertEqual(t, true, errors.Is(err, context.DeadlineExceeded))
+}
+
+func Test_Faulty_Seed(t *testing.T) {
+	run := func(seed int64) []bool {
+		store := New(Config{
+			Storage:	memory.New(),
+			Rules:		[]Rule{ { Err: ErrInjected, Probability: 0.5 } },
+			Seed:		seed,
+		})
+
+		failed := make([]bool, 32)
+		for i := range failed {
+			failed[i] = store.Set("john", "doe") != nil
+		}
+
+		return failed
+	}
+
+	utils.AssertEqual(t, run(42), run(42))
+
+	store := New(Config{ Storage: memory.New() })
+	utils.AssertEqual(t, true, store.Seed() != 0)
+}
+
+func Test_Faulty_Invalid_Pattern(t *testing.T) {
+	defer func() {
+		utils.AssertEqual(t, true, recover() != nil)
+	}()
+
+	_ = New(Config{ Storage: memory.New(), Rules: []Rule{ { Keys: "[" } } })
+}
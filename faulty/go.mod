@@ -0,0 +1,7 @@
+module github.com/paul-norman/go-fiber-storage/faulty
+
+go 1.19
+
+require github.com/gofiber/utils v1.1.0
+
+require github.com/google/uuid v1.3.0 // indirect
@@ -2,4 +2,7 @@ module github.com/paul-norman/go-fiber-storage
 
 go 1.19
 
-require github.com/google/uuid v1.3.0
+require (
+	github.com/gofiber/utils v1.1.0
+	github.com/google/uuid v1.3.0
+)
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Logger receives messages that cannot be returned to a caller, such as failures in background garbage collection
+type Logger interface {
+	// Report a problem that does not stop the storage from working
+	Warn(msg string, keysAndValues ...any)
+
+	// Report a failed operation
+	Error(msg string, keysAndValues ...any)
+}
+
+// DefaultLogger writes to stderr through the standard library logger
+var DefaultLogger Logger = NewStdLogger(log.New(os.Stderr, "", log.LstdFlags))
+
+// NopLogger discards all messages
+var NopLogger Logger = nopLogger{}
+
+// NewStdLogger adapts a standard library logger, producing lines such as `WARN storage gc failed driver=mysql error="..."`
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{ l: l }
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+// Report a problem that does not stop the storage from working
+func (s *stdLogger) Warn(msg string, keysAndValues ...any) {
+	s.l.Print(format("WARN", msg, keysAndValues))
+}
+
+// Report a failed operation
+func (s *stdLogger) Error(msg string, keysAndValues ...any) {
+	s.l.Print(format("ERROR", msg, keysAndValues))
+}
+
+// format renders a message and its key / value pairs as a single line
+func format(level string, msg string, keysAndValues []any) string {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value any = "(missing)"
+		if i + 1 < len(keysAndValues) {
+			value = keysAndValues[i + 1]
+		}
+
+		str := fmt.Sprint(value)
+		if err, ok := value.(error); ok {
+			str = err.Error()
+		}
+		if str == "" || strings.ContainsAny(str, " \"=\n") {
+			str = fmt.Sprintf("%q", str)
+		}
+
+		fmt.Fprintf(&b, " %v=%s", keysAndValues[i], str)
+	}
+
+	return b.String()
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Warn(string, ...any) {}
+
+func (nopLogger) Error(string, ...any) {}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Config defines the config for storage.
+type Config struct {
+	// Storage that will be logged
+	//
+	// Required. Default is nil
+	Storage storage.Storage
+
+	// Logger that receives the messages
+	//
+	// Optional. Default is storage.DefaultLogger
+	Logger storage.Logger
+
+	// Operations taking longer than this are logged as warnings, a negative value disables slow operation reporting
+	//
+	// Optional. Default is 100 * time.Millisecond
+	SlowThreshold time.Duration
+
+	// Namespace included in every message
+	//
+	// Optional. Default is ""
+	Namespace string
+
+	// Include values in messages instead of "[redacted]"
+	//
+	// Optional. Default is false
+	LogValues bool
+
+	// Do not log failed operations, only slow ones
+	//
+	// Optional. Default is false
+	IgnoreErrors bool
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Storage:		nil,
+	Logger:			storage.DefaultLogger,
+	SlowThreshold:	100 * time.Millisecond,
+	Namespace:		"",
+	LogValues:		false,
+	IgnoreErrors:	false,
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		return ConfigDefault
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.Logger == nil {
+		cfg.Logger = ConfigDefault.Logger
+	}
+
+	if cfg.SlowThreshold == 0 {
+		cfg.SlowThreshold = ConfigDefault.SlowThreshold
+	}
+
+	return cfg
+}
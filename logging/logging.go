@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Placeholder logged instead of values unless Config.LogValues is set
+const redacted = "[redacted]"
+
+// New wraps Config.Storage so that failed and slow operations are reported to Config.Logger
+func New(config ...Config) storage.Chained {
+	// Set default config
+	cfg := configDefault(config...)
+
+	if cfg.Storage == nil {
+		panic(errors.New("logging: a Storage to wrap is required"))
+	}
+
+	return storage.Use(cfg.Storage, Middleware(cfg))
+}
+
+// Middleware returns the logging middleware so that it can be combined with others in storage.Use (Config.Storage is ignored)
+func Middleware(config ...Config) storage.Middleware {
+	// Set default config
+	cfg := configDefault(config...)
+
+	return func(next storage.Handler) storage.Handler {
+		return func(op *storage.Op) {
+			start := time.Now()
+			next(op)
+			duration := time.Since(start)
+
+			failed := op.Err != nil && !cfg.IgnoreErrors
+			slow := cfg.SlowThreshold > 0 && duration >= cfg.SlowThreshold
+			if !failed && !slow {
+				return
+			}
+
+			fields := cfg.fields(op, duration)
+
+			if failed {
+				cfg.Logger.Error("storage operation failed", append(fields, "error", op.Err)...)
+			} else {
+				cfg.Logger.Warn("storage operation slow", fields...)
+			}
+		}
+	}
+}
+
+// fields describes the operation as key / value pairs for the logger
+func (cfg Config) fields(op *storage.Op, duration time.Duration) []any {
+	fields := []any{
+		"operation", strings.ToLower(op.Name),
+		"keys", strings.Join(op.Keys, ","),
+	}
+
+	if cfg.Namespace != "" {
+		fields = append(fields, "namespace", cfg.Namespace)
+	}
+
+	fields = append(fields, "duration", duration)
+
+	var value any
+	switch op.Name {
+		case storage.OpSet:
+			value = op.Value
+		case storage.OpGet:
+			if op.Result != nil && op.Result.Hit() {
+				value = op.Result.Value
+			}
+	}
+
+	if value != nil {
+		fields = append(fields, "size", size(value))
+		if cfg.LogValues {
+			fields = append(fields, "value", value)
+		} else {
+			fields = append(fields, "value", redacted)
+		}
+	}
+
+	return fields
+}
+
+// size returns the number of bytes a value occupies, using the default codec for anything other than strings and bytes
+func size(value any) int {
+	switch v := value.(type) {
+		case []byte:
+			return len(v)
+		case string:
+			return len(v)
+	}
+
+	data, err := storage.DefaultCodec.Marshal(value)
+	if err != nil {
+		return 0
+	}
+
+	return len(data)
+}
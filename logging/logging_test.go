@@ -0,0 +1,159 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/clocktest"
+	"github.com/paul-norman/go-fiber-storage/memory"
+)
+
+// testLogger records every message it receives
+type testLogger struct {
+	mux			sync.Mutex
+	messages	[]string
+	fields		[]map[string]any
+}
+
+func (l *testLogger) log(level string, msg string, keysAndValues []any) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	fields := make(map[string]any)
+	for i := 0; i + 1 < len(keysAndValues); i += 2 {
+		fields[fmt.Sprint(keysAndValues[i])] = keysAndValues[i + 1]
+	}
+
+	l.messages = append(l.messages, level + " " + msg)
+	l.fields = append(l.fields, fields)
+}
+
+func (l *testLogger) Warn(msg string, keysAndValues ...any) {
+	l.log("WARN", msg, keysAndValues)
+}
+
+func (l *testLogger) Error(msg string, keysAndValues ...any) {
+	l.log("ERROR", msg, keysAndValues)
+}
+
+// slow delays every operation on the wrapped storage
+func slow(delay time.Duration) storage.Middleware {
+	return func(next storage.Handler) storage.Handler {
+		return func(op *storage.Op) {
+			time.Sleep(delay)
+			next(op)
+		}
+	}
+}
+
+func Test_Logging_Quiet(t *testing.T) {
+	logger := &testLogger{}
+	store := New(Config{ Storage: memory.New(), Logger: logger })
+
+	_ = store.Set("john", "doe")
+	_ = store.Get("john")
+	_ = store.Delete("john")
+
+	utils.AssertEqual(t, 0, len(logger.messages))
+}
+
+func Test_Logging_Error(t *testing.T) {
+	logger := &testLogger{}
+	store := New(Config{ Storage: memory.New(), Logger: logger, Namespace: "sessions" })
+
+	err := store.Set("", "doe")
+	utils.AssertEqual(t, true, err != nil)
+
+	utils.AssertEqual(t, []string{ "ERROR storage operation failed" }, logger.messages)
+	utils.AssertEqual(t, "set", logger.fields[0]["operation"])
+	utils.AssertEqual(t, "sessions", logger.fields[0]["namespace"])
+	utils.AssertEqual(t, err, logger.fields[0]["error"])
+	utils.AssertEqual(t, 3, logger.fields[0]["size"])
+	utils.AssertEqual(t, redacted, logger.fields[0]["value"])
+
+	// Errors can be ignored
+	logger = &testLogger{}
+	store = New(Config{ Storage: memory.New(), Logger: logger, IgnoreErrors: true })
+	_ = store.Set("", "doe")
+	utils.AssertEqual(t, 0, len(logger.messages))
+}
+
+func Test_Logging_Slow(t *testing.T) {
+	logger := &testLogger{}
+	store := New(Config{
+		Storage:		storage.Use(memory.New(), slow(20 * time.Millisecond)),
+		Logger:			logger,
+		SlowThreshold:	10 * time.Millisecond,
+		LogValues:		true,
+	})
+
+	_ = store.Set("john", []byte("doe"))
+	_ = store.Get("john")
+	_ = store.Delete("john", "jane")
+
+	utils.AssertEqual(t, []string{ "WARN storage operation slow", "WARN storage operation slow", "WARN storage operation slow" }, logger.messages)
+
+	get := logger.fields[1]
+	utils.AssertEqual(t, "get", get["operation"])
+	utils.AssertEqual(t, "john", get["keys"])
+	utils.AssertEqual(t, 3, get["size"])
+	utils.AssertEqual(t, []byte("doe"), get["value"])
+	utils.AssertEqual(t, true, get["duration"].(time.Duration) >= 20 * time.Millisecond)
+
+	del := logger.fields[2]
+	utils.AssertEqual(t, "john,jane", del["keys"])
+	_, ok := del["value"]
+	utils.AssertEqual(t, false, ok)
+
+	// A negative threshold disables slow operation reporting
+	logger = &testLogger{}
+	store = New(Config{
+		Storage:		storage.Use(memory.New(), slow(20 * time.Millisecond)),
+		Logger:			logger,
+		SlowThreshold:	-1,
+	})
+	_ = store.Set("john", "doe")
+	utils.AssertEqual(t, 0, len(logger.messages))
+}
+
+func Test_Logging_Size(t *testing.T) {
+	utils.AssertEqual(t, 3, size("doe"))
+	utils.AssertEqual(t, 3, size([]byte("doe")))
+	utils.AssertEqual(t, true, size(int64(42)) > 0)
+}
+
+func Test_Logging_Std_Logger(t *testing.T) {
+	var buf strings.Builder
+	logger := storage.NewStdLogger(log.New(&buf, "", 0))
+
+	store := New(Config{ Storage: memory.New(), Logger: logger })
+	_ = store.Delete()
+
+	utils.AssertEqual(t, true, strings.HasPrefix(buf.String(), "ERROR storage operation failed operation=delete keys=\"\" duration="))
+	utils.AssertEqual(t, true, strings.HasSuffix(buf.String(), " error=\"at least one key is required for Delete\"\n"))
+}
+
+func Test_Logging_OnExpire(t *testing.T) {
+	clock := clocktest.NewFake()
+	backend := memory.New(memory.Config{ GCInterval: time.Second, Clock: clock })
+	store := New(Config{ Storage: backend, Logger: &testLogger{} })
+	defer store.Close()
+
+	// Subscribing through the wrapper reaches the wrapped storage
+	notifier, ok := store.(storage.ExpiryNotifier)
+	utils.AssertEqual(t, true, ok)
+
+	events, cancel := storage.ExpiryEvents(notifier, 10)
+	defer cancel()
+
+	utils.AssertEqual(t, nil, store.Set("john", "doe", time.Second))
+
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, storage.ExpiryEvent{ Key: "john", Value: "doe" }, <-events)
+}
@@ -1,6 +1,10 @@
 package memcache
 
-import "time"
+import (
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
 
 // Config defines the config for storage.
 type Config struct {
@@ -27,6 +31,12 @@ type Config struct {
 	//
 	// Optional. Default is 2
 	MaxIdleConns int
+
+	// Clock used to check millisecond expiries, a clocktest.Fake lets tests expire keys without waiting
+	// (the server's own expiry is in whole seconds and unaffected)
+	//
+	// Optional. Default is storage.SystemClock
+	Clock storage.Clock
 }
 
 // ConfigDefault is the default config
@@ -34,6 +44,7 @@ var ConfigDefault = Config{
 	Servers:      "127.0.0.1:11211",
 	Timeout:      100 * time.Millisecond,
 	MaxIdleConns: 2,
+	Clock:        storage.SystemClock,
 }
 
 // Helper function to set default values
@@ -51,5 +62,9 @@ func configDefault(config ...Config) Config {
 		cfg.Servers = ConfigDefault.Servers
 	}
 
+	if cfg.Clock == nil {
+		cfg.Clock = ConfigDefault.Clock
+	}
+
 	return cfg
 }
\ No newline at end of file
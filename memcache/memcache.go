@@ -1,7 +1,10 @@
 package memcache
 
 import (
+	"context"
+	"encoding/binary"
 	"errors"
+	"math"
 	"strings"
 	"sync"
 	"time"
@@ -15,8 +18,17 @@ import (
 type Storage struct {
 	db    *mc.Client
 	items *sync.Pool
+	clock storage.Clock
 }
 
+const (
+	// Set in an item's flags when its value starts with an 8 byte unix millisecond deadline
+	deadlineFlag uint32 = 1 << 0
+
+	// Memcache treats expiries above 30 days as unix timestamps
+	relativeExpiryLimit = 60 * 60 * 24 * 30
+)
+
 // New creates a new storage
 func New(config ...Config) *Storage {
 	// Set default config
@@ -45,7 +57,8 @@ func New(config ...Config) *Storage {
 
 	// Create storage
 	store := &Storage{
-		db: db,
+		db:    db,
+		clock: cfg.Clock,
 		items: &sync.Pool{
 			New: func() interface{} {
 				return new(mc.Item)
@@ -58,6 +71,15 @@ func New(config ...Config) *Storage {
 
 // Get value by key
 func (s *Storage) Get(key string) *storage.Result {
+	return s.GetContext(context.Background(), key)
+}
+
+// Get value by key, the memcache client has no context support so the context is only checked before starting
+func (s *Storage) GetContext(ctx context.Context, key string) *storage.Result {
+	if err := ctx.Err(); err != nil {
+		return &storage.Result{ Value: nil, Error: err, Missed: false }
+	}
+
 	if len(key) <= 0 {
 		return &storage.Result{ Value: nil, Error: errors.New("storage keys cannot be zero length"), Missed: false }
 	}
@@ -70,26 +92,67 @@ func (s *Storage) Get(key string) *storage.Result {
 		return &storage.Result{ Value: nil, Error: err, Missed: false }
 	}
 
-	return &storage.Result{ Value: item.Value, Error: nil, Missed: false }
+	data := item.Value
+	if item.Flags & deadlineFlag != 0 {
+		if len(data) < 8 {
+			return &storage.Result{ Value: nil, Error: errors.New("memcache: stored value is missing its expiry"), Missed: false }
+		}
+
+		// Memcache only expires whole seconds, so the deadline decides the exact millisecond
+		if int64(binary.BigEndian.Uint64(data)) <= s.clock.Now().UnixMilli() {
+			return &storage.Result{ Value: nil, Error: nil, Missed: true }
+		}
+
+		data = data[8:]
+	}
+
+	value, err := storage.DefaultCodec.Unmarshal(data)
+
+	return &storage.Result{ Value: value, Error: err, Missed: false }
 }
 
 // Set key with value
 func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
+	return s.SetContext(context.Background(), key, value, expiry...)
+}
+
+// Set key with value, the memcache client has no context support so the context is only checked before starting
+func (s *Storage) SetContext(ctx context.Context, key string, value any, expiry ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if len(key) <= 0 {
 		return errors.New("storage keys cannot be zero length")
 	}
 
-	var exp time.Duration = 0
-	if len(expiry) > 0 {
-		exp = expiry[0]
+	exp, err := storage.Expiry(expiry...)
+	if err != nil {
+		return err
+	}
+
+	// Memcache only holds bytes, so the value is encoded with its type
+	data, err := storage.DefaultCodec.Marshal(value)
+	if err != nil {
+		return err
 	}
 
 	item := s.acquireItem()
 	item.Key		= key
-	item.Value		= value
-	item.Expiration = int32(exp.Seconds())
+	item.Value		= data
+
+	if exp != 0 {
+		deadline := storage.ExpiresAt(s.clock.Now(), exp)
+
+		item.Value = make([]byte, 8 + len(data))
+		binary.BigEndian.PutUint64(item.Value, uint64(deadline))
+		copy(item.Value[8:], data)
+
+		item.Flags = deadlineFlag
+		item.Expiration = expiration(exp, deadline)
+	}
 
-	err := s.db.Set(item)
+	err = s.db.Set(item)
 
 	s.releaseItem(item)
 
@@ -98,6 +161,11 @@ func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
 
 // Delete entries by key
 func (s *Storage) Delete(keys ...string) error {
+	return s.DeleteContext(context.Background(), keys...)
+}
+
+// Delete entries by key, the memcache client has no context support so the context is checked before each key
+func (s *Storage) DeleteContext(ctx context.Context, keys ...string) error {
 	if len(keys) <= 0 {
 		return errors.New("at least one key is required for Delete")
 	}
@@ -109,6 +177,9 @@ func (s *Storage) Delete(keys ...string) error {
 	}
 
 	for _, v := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		s.db.Delete(v)
 	}
 
@@ -117,6 +188,15 @@ func (s *Storage) Delete(keys ...string) error {
 
 // Reset all keys
 func (s *Storage) Reset() error {
+	return s.ResetContext(context.Background())
+}
+
+// Reset all keys, the memcache client has no context support so the context is only checked before starting
+func (s *Storage) ResetContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	return s.db.DeleteAll()
 }
 
@@ -135,12 +215,31 @@ func (s *Storage) releaseItem(item *mc.Item) {
 	if item != nil {
 		item.Key = ""
 		item.Value = nil
+		item.Flags = 0
 		item.Expiration = 0
 
 		s.items.Put(item)
 	}
 }
 
+// expiration converts an expiry into a memcache exptime, rounding up to whole seconds so the
+// server never removes an item before its deadline
+func expiration(exp time.Duration, deadline int64) int32 {
+	seconds := int64((exp + time.Second - 1) / time.Second)
+	if seconds <= relativeExpiryLimit {
+		return int32(seconds)
+	}
+
+	// Longer expiries must be sent as a unix timestamp
+	unix := (deadline + 999) / 1000
+	if unix > math.MaxInt32 {
+		// Beyond 2038 the server cannot hold the expiry, so only the deadline checked by Get applies
+		return 0
+	}
+
+	return int32(unix)
+}
+
 // Return database client
 func (s *Storage) Conn() *mc.Client {
 	return s.db
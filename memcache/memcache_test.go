@@ -1,119 +1,107 @@
 package memcache
 
 import (
+	"os"
 	"testing"
 	"time"
 
+	mc "github.com/bradfitz/gomemcache/memcache"
+	"github.com/gofiber/storage/memcache/memcachetest"
 	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/clocktest"
+	"github.com/paul-norman/go-fiber-storage/storagetest"
 )
 
-var testStore = New()
-
-func Test_Memcache_Set(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-}
+var (
+	testServer	*memcachetest.Server
+	testStore	*Storage
+)
 
-func Test_Memcache_Set_Override(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
+func TestMain(m *testing.M) {
+	testServer = memcachetest.NewServer()
+	testStore = New(Config{
+		Servers: testServer.Addr,
+	})
 
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	code := m.Run()
 
-	err = testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	testServer.Close()
+	os.Exit(code)
 }
 
-func Test_Memcache_Get(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, val, result)
+func Test_Memcache_Conformance(t *testing.T) {
+	// The server's expiry and the millisecond deadline are both moved on, so the tests do not wait
+	clock := clocktest.NewFake()
+
+	storagetest.Run(t, func() storage.Storage {
+		return New(Config{
+			Servers:	testServer.Addr,
+			Reset:		true,
+			Clock:		clock,
+		})
+	}, storagetest.Config{
+		Advance: func(d time.Duration) {
+			clock.Advance(d)
+			testServer.FastForward(d)
+		},
+	})
 }
 
-func Test_Memcache_Set_Expiration(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-		exp = 1 * time.Second
-	)
-
-	err := testStore.Set(key, val, exp)
+func Test_Memcache_Expiration(t *testing.T) {
+	err := testStore.Set("john", "doe", 10 * time.Second)
 	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, testStore.Get("john").Hit())
 
-	time.Sleep(1100 * time.Millisecond)
+	testServer.FastForward(10 * time.Second)
+	utils.AssertEqual(t, true, testStore.Get("john").Miss())
 }
 
-func Test_Memcache_Get_Expired(t *testing.T) {
-	var (
-		key = "john"
-	)
+func Test_Memcache_Expiration_Milliseconds(t *testing.T) {
+	clock := clocktest.NewFake()
+	store := New(Config{ Servers: testServer.Addr, Clock: clock })
 
-	result, err := testStore.Get(key)
+	// The server keeps the item for 2 seconds, the deadline hides it after 1.5
+	err := store.Set("john", "doe", 1500 * time.Millisecond)
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
-}
 
-func Test_Memcache_Get_NotExist(t *testing.T) {
-
-	result, err := testStore.Get("notexist")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
-}
-
-func Test_Memcache_Delete(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
+	item, err := store.Conn().Get("john")
 	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, deadlineFlag, item.Flags)
 
-	err = testStore.Delete(key)
-	utils.AssertEqual(t, nil, err)
+	clock.Advance(1499 * time.Millisecond)
+	utils.AssertEqual(t, true, store.Get("john").Hit())
 
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	clock.Advance(time.Millisecond)
+	utils.AssertEqual(t, true, store.Get("john").Miss())
 }
 
-func Test_Memcache_Reset(t *testing.T) {
-	var (
-		val = []byte("doe")
-	)
+func Test_Memcache_Expiration_Conversion(t *testing.T) {
+	now := time.Now()
 
-	err := testStore.Set("john1", val, 0)
-	utils.AssertEqual(t, nil, err)
+	exp := 1500 * time.Millisecond
+	utils.AssertEqual(t, int32(2), expiration(exp, storage.ExpiresAt(now, exp)))
 
-	err = testStore.Set("john2", val, 0)
-	utils.AssertEqual(t, nil, err)
+	exp = 30 * 24 * time.Hour
+	utils.AssertEqual(t, int32(relativeExpiryLimit), expiration(exp, storage.ExpiresAt(now, exp)))
 
-	err = testStore.Reset()
-	utils.AssertEqual(t, nil, err)
+	exp = 31 * 24 * time.Hour
+	utils.AssertEqual(t, int32(now.Add(exp).Unix()) + 1, expiration(exp, now.Add(exp).UnixMilli() + 1))
+
+	exp = 100 * 365 * 24 * time.Hour
+	utils.AssertEqual(t, int32(0), expiration(exp, storage.ExpiresAt(now, exp)))
+}
 
-	result, err := testStore.Get("john1")
+func Test_Memcache_Without_Deadline(t *testing.T) {
+	// Items stored before millisecond expiries have no deadline prefix
+	data, err := storage.DefaultCodec.Marshal("doe")
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	utils.AssertEqual(t, nil, testStore.Conn().Set(&mc.Item{ Key: "legacy", Value: data, Expiration: 10 }))
 
-	result, err = testStore.Get("john2")
+	result, err, missed := testStore.Get("legacy").String()
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	utils.AssertEqual(t, false, missed)
+	utils.AssertEqual(t, "doe", result)
 }
 
 func Test_Memcache_Close(t *testing.T) {
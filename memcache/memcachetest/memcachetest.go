@@ -0,0 +1,434 @@
+// Package memcachetest provides an in-process memcache server for tests, so that they do not depend on a real server.
+//
+// It speaks the memcache text protocol for: get, gets, set, add, replace, cas, delete, touch, incr, decr, flush_all, version and quit.
+//
+//	srv := memcachetest.NewServer()
+//	defer srv.Close()
+//
+//	store := memcache.New(memcache.Config{ Servers: srv.Addr })
+package memcachetest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Expiry times above this many seconds are unix timestamps rather than relative times, as in memcached
+const relativeExpiryLimit = 60 * 60 * 24 * 30
+
+// Longest key accepted by memcached
+const maxKeyLength = 250
+
+// Server is an in-process memcache server listening on a random local port
+type Server struct {
+	// Address of the server, i.e. "127.0.0.1:49152"
+	Addr string
+
+	// Host and Port of the server, for configs that take them separately
+	Host string
+	Port int
+
+	listener	net.Listener
+
+	mux			sync.Mutex
+	items		map[string]*item
+	cas			uint64
+	offset		time.Duration
+	conns		map[net.Conn]struct{}
+	closed		bool
+	wg			sync.WaitGroup
+}
+
+// item is a stored value, the zero expiry meaning none
+type item struct {
+	value	[]byte
+	flags	uint32
+	expiry	time.Time
+	cas		uint64
+}
+
+// NewServer starts a server, it must be stopped with Close
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("memcachetest: failed to listen: %v", err))
+	}
+
+	addr := listener.Addr().(*net.TCPAddr)
+
+	s := &Server{
+		Addr:		addr.String(),
+		Host:		addr.IP.String(),
+		Port:		addr.Port,
+		listener:	listener,
+		items:		make(map[string]*item),
+		conns:		make(map[net.Conn]struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// Close stops the server and closes all client connections
+func (s *Server) Close() {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return
+	}
+	s.closed = true
+	_ = s.listener.Close()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mux.Unlock()
+
+	s.wg.Wait()
+}
+
+// Keys returns the unexpired keys, sorted
+func (s *Server) Keys() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	keys := []string{}
+	for key := range s.items {
+		if s.get(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Value returns the value stored for key
+func (s *Server) Value(key string) ([]byte, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	it := s.get(key)
+	if it == nil {
+		return nil, false
+	}
+
+	return it.value, true
+}
+
+// FastForward moves the server's clock forward by d, so that expiry can be tested without waiting
+func (s *Server) FastForward(d time.Duration) {
+	s.mux.Lock()
+	s.offset += d
+	s.mux.Unlock()
+}
+
+// now is the server's clock, including any FastForward calls
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+// expiry converts a memcache exptime into a time, negative values have already expired
+func (s *Server) expiry(exptime int64) time.Time {
+	switch {
+		case exptime == 0:
+			return time.Time{}
+		case exptime < 0:
+			return s.now().Add(-time.Second)
+		case exptime > relativeExpiryLimit:
+			return time.Unix(exptime, 0)
+	}
+
+	return s.now().Add(time.Duration(exptime) * time.Second)
+}
+
+// get returns the unexpired item for key, removing it if it has expired
+func (s *Server) get(key string) *item {
+	it, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+
+	if !it.expiry.IsZero() && !it.expiry.After(s.now()) {
+		delete(s.items, key)
+		return nil
+	}
+
+	return it
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mux.Lock()
+		if s.closed {
+			s.mux.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mux.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mux.Lock()
+		delete(s.conns, conn)
+		s.mux.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else if quit := s.dispatch(r, w, args); quit {
+			_ = w.Flush()
+			return
+		}
+
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dispatch runs a single command, returning true when the connection should be closed
+func (s *Server) dispatch(r *bufio.Reader, w *bufio.Writer, args []string) bool {
+	name := args[0]
+
+	// Storage commands carry a data block which must be read whatever happens
+	var data []byte
+	if name == "set" || name == "add" || name == "replace" || name == "cas" {
+		if len(args) < 5 {
+			w.WriteString("ERROR\r\n")
+			return false
+		}
+
+		size, err := strconv.Atoi(args[4])
+		if err != nil || size < 0 {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+			return true
+		}
+
+		data = make([]byte, size + 2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return true
+		}
+		if string(data[size:]) != "\r\n" {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+			return false
+		}
+		data = data[:size]
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	switch name {
+		case "get", "gets":
+			s.cmdGet(w, args)
+		case "set", "add", "replace", "cas":
+			s.cmdStore(w, args, data)
+		case "delete":
+			s.cmdDelete(w, args)
+		case "touch":
+			s.cmdTouch(w, args)
+		case "incr", "decr":
+			s.cmdIncr(w, args)
+		case "flush_all":
+			s.items = make(map[string]*item)
+			reply(w, args, "OK")
+		case "version":
+			w.WriteString("VERSION 1.6.0-memcachetest\r\n")
+		case "quit":
+			return true
+		default:
+			w.WriteString("ERROR\r\n")
+	}
+
+	return false
+}
+
+// reply writes the response unless the command ended with noreply
+func reply(w *bufio.Writer, args []string, response string) {
+	if args[len(args) - 1] == "noreply" {
+		return
+	}
+
+	w.WriteString(response + "\r\n")
+}
+
+func validKey(key string) bool {
+	return len(key) > 0 && len(key) <= maxKeyLength && !strings.ContainsAny(key, " \t\r\n")
+}
+
+func (s *Server) cmdGet(w *bufio.Writer, args []string) {
+	for _, key := range args[1:] {
+		it := s.get(key)
+		if it == nil {
+			continue
+		}
+
+		if args[0] == "gets" {
+			fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", key, it.flags, len(it.value), it.cas)
+		} else {
+			fmt.Fprintf(w, "VALUE %s %d %d\r\n", key, it.flags, len(it.value))
+		}
+		w.Write(it.value)
+		w.WriteString("\r\n")
+	}
+
+	w.WriteString("END\r\n")
+}
+
+// cmdStore handles `<command> <key> <flags> <exptime> <bytes> [cas unique] [noreply]`
+func (s *Server) cmdStore(w *bufio.Writer, args []string, data []byte) {
+	key := args[1]
+	if !validKey(key) {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+
+	flags, err1 := strconv.ParseUint(args[2], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[3], 10, 64)
+	if err1 != nil || err2 != nil {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return
+	}
+
+	existing := s.get(key)
+	switch args[0] {
+		case "add":
+			if existing != nil {
+				reply(w, args, "NOT_STORED")
+				return
+			}
+		case "replace":
+			if existing == nil {
+				reply(w, args, "NOT_STORED")
+				return
+			}
+		case "cas":
+			if len(args) < 6 {
+				w.WriteString("ERROR\r\n")
+				return
+			}
+			if existing == nil {
+				reply(w, args, "NOT_FOUND")
+				return
+			}
+			if strconv.FormatUint(existing.cas, 10) != args[5] {
+				reply(w, args, "EXISTS")
+				return
+			}
+	}
+
+	s.cas++
+	s.items[key] = &item{ value: data, flags: uint32(flags), expiry: s.expiry(exptime), cas: s.cas }
+	reply(w, args, "STORED")
+}
+
+func (s *Server) cmdDelete(w *bufio.Writer, args []string) {
+	if len(args) < 2 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+
+	if s.get(args[1]) == nil {
+		reply(w, args, "NOT_FOUND")
+		return
+	}
+
+	delete(s.items, args[1])
+	reply(w, args, "DELETED")
+}
+
+func (s *Server) cmdTouch(w *bufio.Writer, args []string) {
+	if len(args) < 3 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+
+	exptime, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+
+	it := s.get(args[1])
+	if it == nil {
+		reply(w, args, "NOT_FOUND")
+		return
+	}
+
+	it.expiry = s.expiry(exptime)
+	reply(w, args, "TOUCHED")
+}
+
+func (s *Server) cmdIncr(w *bufio.Writer, args []string) {
+	if len(args) < 3 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+
+	delta, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+		return
+	}
+
+	it := s.get(args[1])
+	if it == nil {
+		reply(w, args, "NOT_FOUND")
+		return
+	}
+
+	current, err := strconv.ParseUint(string(it.value), 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+		return
+	}
+
+	if args[0] == "incr" {
+		current += delta
+	} else if delta > current {
+		current = 0
+	} else {
+		current -= delta
+	}
+
+	s.cas++
+	it.value = []byte(strconv.FormatUint(current, 10))
+	it.cas = s.cas
+	reply(w, args, string(it.value))
+}
@@ -0,0 +1,82 @@
+package memcachetest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+// send writes a raw command and returns the reply up to and including the line starting with end
+func send(t *testing.T, conn net.Conn, r *bufio.Reader, command string, end string) string {
+	t.Helper()
+
+	_, err := conn.Write([]byte(command))
+	utils.AssertEqual(t, nil, err)
+
+	var reply strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		utils.AssertEqual(t, nil, err)
+		reply.WriteString(line)
+		if end == "" || strings.HasPrefix(line, end) {
+			return reply.String()
+		}
+	}
+}
+
+func Test_Memcachetest_Protocol(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	utils.AssertEqual(t, nil, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	utils.AssertEqual(t, "STORED\r\n", send(t, conn, r, "set john 5 0 3\r\ndoe\r\n", ""))
+	utils.AssertEqual(t, "VALUE john 5 3\r\ndoe\r\nEND\r\n", send(t, conn, r, "get john jane\r\n", "END"))
+	utils.AssertEqual(t, "VALUE john 5 3 1\r\ndoe\r\nEND\r\n", send(t, conn, r, "gets john\r\n", "END"))
+	utils.AssertEqual(t, "NOT_STORED\r\n", send(t, conn, r, "add john 0 0 5\r\nsmith\r\n", ""))
+	utils.AssertEqual(t, "EXISTS\r\n", send(t, conn, r, "cas john 0 0 5 9\r\nsmith\r\n", ""))
+	utils.AssertEqual(t, "STORED\r\n", send(t, conn, r, "cas john 0 0 5 1\r\nsmith\r\n", ""))
+	utils.AssertEqual(t, "42\r\n", send(t, conn, r, "set count 0 0 1 noreply\r\n1\r\nincr count 41\r\n", ""))
+	utils.AssertEqual(t, "DELETED\r\n", send(t, conn, r, "delete john\r\n", ""))
+	utils.AssertEqual(t, "NOT_FOUND\r\n", send(t, conn, r, "delete john\r\n", ""))
+	utils.AssertEqual(t, "ERROR\r\n", send(t, conn, r, "stats\r\n", ""))
+
+	value, ok := srv.Value("count")
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, "42", string(value))
+
+	utils.AssertEqual(t, "OK\r\n", send(t, conn, r, "flush_all\r\n", ""))
+	utils.AssertEqual(t, []string{}, srv.Keys())
+}
+
+func Test_Memcachetest_Expiry(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	utils.AssertEqual(t, nil, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	utils.AssertEqual(t, "STORED\r\n", send(t, conn, r, "set john 0 10 3\r\ndoe\r\n", ""))
+	utils.AssertEqual(t, "STORED\r\n", send(t, conn, r, "set jane 0 0 3\r\ndoe\r\n", ""))
+	utils.AssertEqual(t, "STORED\r\n", send(t, conn, r, "set jim 0 -1 3\r\ndoe\r\n", ""))
+	utils.AssertEqual(t, []string{ "jane", "john" }, srv.Keys())
+
+	srv.FastForward(9 * time.Second)
+	utils.AssertEqual(t, "TOUCHED\r\n", send(t, conn, r, "touch john 10\r\n", ""))
+
+	srv.FastForward(9 * time.Second)
+	utils.AssertEqual(t, []string{ "jane", "john" }, srv.Keys())
+
+	srv.FastForward(time.Second)
+	utils.AssertEqual(t, "END\r\n", send(t, conn, r, "get john\r\n", "END"))
+	utils.AssertEqual(t, []string{ "jane" }, srv.Keys())
+}
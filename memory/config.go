@@ -1,34 +1,256 @@
 package memory
 
-import "time"
+import (
+	"runtime"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/memory/internal/eviction"
+)
+
+// Policy chooses the keys that are evicted once MaxEntries is reached
+type Policy int
+
+const (
+	// Least recently used, suits most workloads
+	LRU Policy = iota
+
+	// Least frequently used, suits stable popularity but keeps formerly popular keys for a long time
+	LFU
+
+	// Window TinyLFU, only admits new keys that are used more often than the ones they would replace, resisting scans
+	WTinyLFU
+
+	// Adaptive replacement cache, balances recency and frequency by itself, resisting scans
+	ARC
+)
+
+// String returns the name of the policy
+func (p Policy) String() string {
+	switch p {
+		case LRU:
+			return "lru"
+		case LFU:
+			return "lfu"
+		case WTinyLFU:
+			return "w-tinylfu"
+		case ARC:
+			return "arc"
+	}
+
+	return "unknown"
+}
+
+// assumedEntries sizes the ARC and W-TinyLFU policies when only MaxBytes limits the number of entries
+const assumedEntries = 10000
+
+// create returns the implementation of the policy
+func (p Policy) create(capacity int) eviction.Policy {
+	if capacity <= 0 {
+		capacity = assumedEntries
+	}
+
+	switch p {
+		case LFU:
+			return eviction.NewLFU()
+		case WTinyLFU:
+			return eviction.NewTinyLFU(capacity)
+		case ARC:
+			return eviction.NewARC(capacity)
+	}
+
+	return eviction.NewLRU()
+}
 
 // Config defines the config for storage.
 type Config struct {
+	// Namespace of the storage returned by New, Storage.Namespace returns views of other namespaces sharing it
+	//
+	// Default is "" (the default namespace)
+	Namespace string
+
 	// Time before deleting expired keys
 	//
-	// Default is 10 * time.Second
+	// Default is 1 * time.Second
 	GCInterval time.Duration
+
+	// Maximum number of keys, Policy chooses the keys evicted beyond this (pinned keys are never evicted)
+	//
+	// Default is 0 (unlimited)
+	MaxEntries int
+
+	// Maximum size of the stored keys and values as measured by Sizer, Policy chooses the keys evicted beyond this.
+	// Set returns an error for a single value larger than this.
+	//
+	// Default is 0 (unlimited)
+	MaxBytes int
+
+	// Measures values for MaxBytes and Stats
+	//
+	// Default is DefaultSizer
+	Sizer func(value any) int
+
+	// How the keys to evict are chosen (LRU, LFU, WTinyLFU or ARC)
+	//
+	// Default is LRU
+	Policy Policy
+
+	// Number of independently locked parts the keys are spread across, rounded up to a power of two.
+	// When it is left at 0 a storage with MaxEntries or MaxBytes uses a single shard, so that eviction chooses between
+	// every key. Setting it explicitly is always honoured, MaxEntries and MaxBytes still hold for the storage as a whole
+	// but each shard's policy only chooses between its own keys.
+	//
+	// Default is 0 (4 * GOMAXPROCS when unbounded, 1 when MaxEntries or MaxBytes is set)
+	Shards int
+
+	// Called whenever an entry is removed, with the reason it was removed
+	//
+	// Default is nil
+	OnEvict func(key string, value any, reason EvictReason)
+
+	// Source of time for expiry and garbage collection, a clocktest.Fake lets tests expire keys without waiting
+	//
+	// Default is storage.SystemClock
+	Clock storage.Clock
+
+	// File the entries are snapshotted to every SnapshotInterval and on Close, and restored from by New.
+	// Entries that expire while the process is down are dropped on restore.
+	//
+	// Default is "" (no snapshots), or LogPath + ".snapshot" when LogPath is set
+	SnapshotPath string
+
+	// Time between snapshots when SnapshotPath is set
+	//
+	// Default is 1 * time.Minute
+	SnapshotInterval time.Duration
+
+	// Whether callers share the stored values (IsolateNone), or get deep copies (IsolateCopy) or decoded values
+	// (IsolateEncode, stored encoded by Codec) so that changing a value after Set or Get cannot change the stored one
+	//
+	// Default is IsolateNone
+	Isolation Isolation
+
+	// Converts values to bytes for snapshots, the log and IsolateEncode, values it cannot encode are left out of snapshots
+	//
+	// Default is storage.DefaultCodec
+	Codec storage.Codec
+
+	// Logger for failures that happen in the background (snapshots, log flushes)
+	//
+	// Default is storage.DefaultLogger
+	Logger storage.Logger
+
+	// File every Set, Delete and Reset is appended to before it is applied, replayed by New after the snapshot.
+	// Each snapshot compacts the log, starting a new one.
+	//
+	// Default is "" (no log)
+	LogPath string
+
+	// How often the log is flushed to disk (SyncEverySecond, SyncAlways or SyncNever)
+	//
+	// Default is SyncEverySecond
+	LogSync LogSync
+
+	// Size in bytes beyond which the log is compacted into a snapshot straight away, rather than at the next SnapshotInterval
+	//
+	// Default is 64 << 20 (64 MiB)
+	LogCompactSize int64
 }
 
 // ConfigDefault is the default config
 var ConfigDefault = Config{
-	GCInterval: 10 * time.Second,
+	Namespace:			"",
+	GCInterval:			1 * time.Second,
+	MaxEntries:			0,
+	MaxBytes:			0,
+	Sizer:				DefaultSizer,
+	Policy:				LRU,
+	Shards:				0,
+	OnEvict:			nil,
+	Clock:				storage.SystemClock,
+	SnapshotPath:		"",
+	SnapshotInterval:	1 * time.Minute,
+	Isolation:			IsolateNone,
+	Codec:				storage.DefaultCodec,
+	Logger:				storage.DefaultLogger,
+	LogPath:			"",
+	LogSync:			SyncEverySecond,
+	LogCompactSize:		64 << 20,
 }
 
 // configDefault is a helper function to set default values
 func configDefault(config ...Config) Config {
 	// Return default config if nothing provided
 	if len(config) < 1 {
-		return ConfigDefault
+		cfg := ConfigDefault
+		cfg.Shards = shards(cfg)
+		return cfg
 	}
 
 	// Override default config
 	cfg := config[0]
 
 	// Set default values
-	if int(cfg.GCInterval.Seconds()) <= 0 {
+	if cfg.GCInterval <= 0 {
 		cfg.GCInterval = ConfigDefault.GCInterval
 	}
 
+	if cfg.MaxEntries < 0 {
+		cfg.MaxEntries = ConfigDefault.MaxEntries
+	}
+
+	if cfg.MaxBytes < 0 {
+		cfg.MaxBytes = ConfigDefault.MaxBytes
+	}
+
+	if cfg.Sizer == nil {
+		cfg.Sizer = ConfigDefault.Sizer
+	}
+
+	if cfg.Clock == nil {
+		cfg.Clock = ConfigDefault.Clock
+	}
+
+	if cfg.SnapshotInterval <= 0 {
+		cfg.SnapshotInterval = ConfigDefault.SnapshotInterval
+	}
+
+	if cfg.Codec == nil {
+		cfg.Codec = ConfigDefault.Codec
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = ConfigDefault.Logger
+	}
+
+	if cfg.LogPath != "" && cfg.SnapshotPath == "" {
+		cfg.SnapshotPath = cfg.LogPath + ".snapshot"
+	}
+
+	if cfg.LogCompactSize <= 0 {
+		cfg.LogCompactSize = ConfigDefault.LogCompactSize
+	}
+
+	cfg.Shards = shards(cfg)
+
 	return cfg
-}
\ No newline at end of file
+}
+
+// shards returns the number of shards to use, a power of two
+func shards(cfg Config) int {
+	n := cfg.Shards
+	if n <= 0 {
+		// A single shard keeps eviction exact across every key
+		if cfg.MaxEntries > 0 || cfg.MaxBytes > 0 {
+			return 1
+		}
+		n = 4 * runtime.GOMAXPROCS(0)
+	}
+
+	power := 1
+	for power < n {
+		power <<= 1
+	}
+
+	return power
+}
@@ -0,0 +1,138 @@
+package eviction
+
+import "container/list"
+
+// arc is the Adaptive Replacement Cache policy (Megiddo & Modha). Keys seen once live in t1, keys seen again in t2,
+// and recently evicted keys are remembered in the ghost lists b1 and b2 to adapt the target size of t1.
+type arc struct {
+	capacity	int
+	target		int
+	t1, t2		*list.List
+	b1, b2		*list.List
+	items		map[string]*arcItem
+}
+
+type arcItem struct {
+	element	*list.Element
+	in		*list.List
+}
+
+// NewARC creates an adaptive replacement policy for the given capacity
+func NewARC(capacity int) Policy {
+	p := &arc{ capacity: capacity }
+	p.Reset()
+
+	return p
+}
+
+func (p *arc) Add(key string) {
+	item, ok := p.items[key]
+
+	switch {
+		case ok && (item.in == p.t1 || item.in == p.t2):
+			p.Hit(key)
+			return
+		case ok && item.in == p.b1:
+			// Recency is paying off, grow t1
+			p.target = min(p.capacity, p.target + max(1, p.b2.Len() / p.b1.Len()))
+			p.move(key, item, p.t2)
+		case ok && item.in == p.b2:
+			// Frequency is paying off, shrink t1
+			p.target = max(0, p.target - max(1, p.b1.Len() / p.b2.Len()))
+			p.move(key, item, p.t2)
+		default:
+			p.items[key] = &arcItem{ element: p.t1.PushFront(key), in: p.t1 }
+	}
+
+	p.trim()
+}
+
+func (p *arc) Hit(key string) {
+	if item, ok := p.items[key]; ok && (item.in == p.t1 || item.in == p.t2) {
+		p.move(key, item, p.t2)
+	}
+}
+
+func (p *arc) Remove(key string, evicted bool) {
+	item, ok := p.items[key]
+	if !ok || (item.in != p.t1 && item.in != p.t2) {
+		return
+	}
+
+	if !evicted {
+		item.in.Remove(item.element)
+		delete(p.items, key)
+		return
+	}
+
+	if item.in == p.t1 {
+		p.move(key, item, p.b1)
+	} else {
+		p.move(key, item, p.b2)
+	}
+	p.trim()
+}
+
+func (p *arc) Victim(keep string) (string, bool) {
+	first, second := p.t2, p.t1
+	if p.t1.Len() > 0 && (p.t1.Len() > p.target || p.t2.Len() == 0) {
+		first, second = p.t1, p.t2
+	}
+
+	if key, ok := back(first, keep); ok {
+		return key, true
+	}
+
+	return back(second, keep)
+}
+
+func (p *arc) Len() int {
+	return p.t1.Len() + p.t2.Len()
+}
+
+func (p *arc) Reset() {
+	p.target = 0
+	p.t1, p.t2, p.b1, p.b2 = list.New(), list.New(), list.New(), list.New()
+	p.items = make(map[string]*arcItem)
+}
+
+// move puts a key at the front of a list
+func (p *arc) move(key string, item *arcItem, to *list.List) {
+	item.in.Remove(item.element)
+	item.element = to.PushFront(key)
+	item.in = to
+}
+
+// trim keeps the ghost lists within their bounds
+func (p *arc) trim() {
+	for p.b1.Len() > 0 && p.t1.Len() + p.b1.Len() > p.capacity {
+		p.forget(p.b1)
+	}
+
+	for p.b2.Len() > 0 && p.t1.Len() + p.t2.Len() + p.b1.Len() + p.b2.Len() > 2 * p.capacity {
+		p.forget(p.b2)
+	}
+}
+
+// forget drops the oldest key of a ghost list
+func (p *arc) forget(l *list.List) {
+	e := l.Back()
+	l.Remove(e)
+	delete(p.items, e.Value.(string))
+}
+
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,77 @@
+// Package eviction holds the policies that choose which keys a bounded memory storage evicts.
+// Policies are not safe for concurrent use, the storage calls them with its lock held.
+package eviction
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Policy tracks the keys that may be evicted and chooses between them
+type Policy interface {
+	// Add records a key that has just been stored
+	Add(key string)
+
+	// Hit records a read or overwrite of a key that the policy holds
+	Hit(key string)
+
+	// Remove forgets a key, evicted is true when it was chosen by Victim (policies may remember evicted keys)
+	Remove(key string, evicted bool)
+
+	// Victim returns the key that should be evicted next, other than keep (usually the key just stored), without removing it
+	Victim(keep string) (string, bool)
+
+	// Len returns the number of keys held
+	Len() int
+
+	// Reset forgets every key
+	Reset()
+}
+
+// Replay runs a trace of key requests through a cache of the given capacity that is managed by the policy.
+// Missing keys are added, so the trace describes reads that fall back to a slower source. It returns the hit ratio.
+func Replay(p Policy, capacity int, trace []string) float64 {
+	if len(trace) == 0 {
+		return 0
+	}
+
+	present := make(map[string]struct{}, capacity)
+	hits := 0
+
+	for _, key := range trace {
+		if _, ok := present[key]; ok {
+			hits++
+			p.Hit(key)
+			continue
+		}
+
+		p.Add(key)
+		present[key] = struct{}{}
+
+		for len(present) > capacity {
+			victim, ok := p.Victim(key)
+			if !ok {
+				break
+			}
+			p.Remove(victim, true)
+			delete(present, victim)
+		}
+	}
+
+	return float64(hits) / float64(len(trace))
+}
+
+// LoadTrace reads a trace with one key per line, blank lines are skipped
+func LoadTrace(r io.Reader) ([]string, error) {
+	var trace []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			trace = append(trace, key)
+		}
+	}
+
+	return trace, scanner.Err()
+}
@@ -0,0 +1,187 @@
+package eviction
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/utils"
+)
+
+// policies creates each policy for a capacity
+var policies = map[string]func(capacity int) Policy{
+	"lru":		func(int) Policy { return NewLRU() },
+	"lfu":		func(int) Policy { return NewLFU() },
+	"arc":		NewARC,
+	"tinylfu":	NewTinyLFU,
+}
+
+// zipfTrace requests keys with a skewed popularity
+func zipfTrace(n int, keys uint64, seed int64) []string {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(seed)), 1.1, 1, keys - 1)
+
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = fmt.Sprint("hot:", zipf.Uint64())
+	}
+
+	return trace
+}
+
+// scanTrace interleaves a skewed workload with long scans of keys that are requested once
+func scanTrace() []string {
+	var trace []string
+	hot := zipfTrace(50000, 500, 1)
+
+	for i := 0; i < len(hot); i += 5000 {
+		trace = append(trace, hot[i:i + 5000]...)
+		for j := 0; j < 2000; j++ {
+			trace = append(trace, fmt.Sprint("scan:", i, ":", j))
+		}
+	}
+
+	return trace
+}
+
+func Test_Eviction_Basics(t *testing.T) {
+	for name, create := range policies {
+		p := create(3)
+
+		p.Add("a")
+		p.Add("b")
+		p.Add("c")
+		p.Hit("a")
+		p.Hit("c")
+		utils.AssertEqual(t, 3, p.Len(), name)
+
+		victim, ok := p.Victim("")
+		utils.AssertEqual(t, true, ok, name)
+		utils.AssertEqual(t, "b", victim, name)
+
+		// The kept key is never chosen
+		victim, _ = p.Victim("b")
+		utils.AssertEqual(t, true, victim != "b", name)
+
+		p.Remove("b", true)
+		p.Remove("missing", false)
+		utils.AssertEqual(t, 2, p.Len(), name)
+
+		p.Reset()
+		utils.AssertEqual(t, 0, p.Len(), name)
+		_, ok = p.Victim("")
+		utils.AssertEqual(t, false, ok, name)
+
+		p.Add("only")
+		_, ok = p.Victim("only")
+		utils.AssertEqual(t, false, ok, name)
+	}
+}
+
+func Test_Eviction_Frequency(t *testing.T) {
+	p := NewLFU()
+	p.Add("popular")
+	for i := 0; i < 5; i++ {
+		p.Hit("popular")
+	}
+	p.Add("once")
+
+	victim, _ := p.Victim("")
+	utils.AssertEqual(t, "once", victim)
+}
+
+func Test_Eviction_ARC_Ghosts(t *testing.T) {
+	p := NewARC(2).(*arc)
+	p.Add("a")
+	p.Add("b")
+	p.Remove("a", true)
+	utils.AssertEqual(t, 1, p.b1.Len())
+
+	// A key returning from the ghost list goes straight to t2 and grows the target for t1
+	p.Add("a")
+	utils.AssertEqual(t, 1, p.target)
+	utils.AssertEqual(t, p.t2, p.items["a"].in)
+	utils.AssertEqual(t, 0, p.b1.Len())
+
+	// Deleted keys are not remembered
+	p.Remove("b", false)
+	_, ok := p.items["b"]
+	utils.AssertEqual(t, false, ok)
+}
+
+func Test_Eviction_Sketch(t *testing.T) {
+	s := newSketch(100)
+	for i := 0; i < 10; i++ {
+		s.increment("often")
+	}
+	s.increment("rarely")
+
+	utils.AssertEqual(t, uint8(10), s.estimate("often"))
+	utils.AssertEqual(t, uint8(1), s.estimate("rarely"))
+	utils.AssertEqual(t, uint8(0), s.estimate("never"))
+
+	// Counters saturate and are halved as the sample fills
+	for i := 0; i < 1000; i++ {
+		s.increment("often")
+	}
+	utils.AssertEqual(t, true, s.estimate("often") <= 15)
+	utils.AssertEqual(t, true, s.estimate("rarely") == 0)
+}
+
+func Test_Eviction_Scan_Resistance(t *testing.T) {
+	trace := scanTrace()
+
+	ratios := make(map[string]float64)
+	for name, create := range policies {
+		ratios[name] = Replay(create(200), 200, trace)
+	}
+
+	utils.AssertEqual(t, true, ratios["arc"] > ratios["lru"], fmt.Sprint(ratios))
+	utils.AssertEqual(t, true, ratios["tinylfu"] > ratios["lru"], fmt.Sprint(ratios))
+}
+
+func Test_Eviction_LoadTrace(t *testing.T) {
+	trace, err := LoadTrace(strings.NewReader("a\n\n b \nc\n"))
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, []string{ "a", "b", "c" }, trace)
+
+	utils.AssertEqual(t, 0.0, Replay(NewLRU(), 1, nil))
+	utils.AssertEqual(t, 0.25, Replay(NewLRU(), 1, []string{ "a", "a", "b", "c" }))
+}
+
+// Compares the policies on synthetic traces and on any recorded traces (one key per line) in testdata/*.trace
+// go test -v -run=^$ -bench=Benchmark_Eviction -benchmem
+func Benchmark_Eviction(b *testing.B) {
+	traces := map[string][]string{
+		"zipf":	zipfTrace(100000, 10000, 1),
+		"scan":	scanTrace(),
+	}
+
+	files, _ := filepath.Glob(filepath.Join("testdata", "*.trace"))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		trace, err := LoadTrace(f)
+		_ = f.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+		traces[strings.TrimSuffix(filepath.Base(file), ".trace")] = trace
+	}
+
+	for traceName, trace := range traces {
+		for name, create := range policies {
+			b.Run(traceName + "/" + name, func(b *testing.B) {
+				var ratio float64
+				for n := 0; n < b.N; n++ {
+					ratio = Replay(create(1000), 1000, trace)
+				}
+				b.ReportMetric(ratio * 100, "hit%")
+			})
+		}
+	}
+}
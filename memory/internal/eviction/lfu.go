@@ -0,0 +1,118 @@
+package eviction
+
+import "container/heap"
+
+// lfu evicts the least frequently used key, the least recently used of those on a tie
+type lfu struct {
+	items	map[string]*lfuItem
+	heap	lfuHeap
+	tick	uint64
+}
+
+type lfuItem struct {
+	key		string
+	count	uint64
+	tick	uint64
+	index	int
+}
+
+// NewLFU creates a least frequently used policy
+func NewLFU() Policy {
+	return &lfu{ items: make(map[string]*lfuItem) }
+}
+
+func (p *lfu) Add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.Hit(key)
+		return
+	}
+
+	p.tick++
+	item := &lfuItem{ key: key, count: 1, tick: p.tick }
+	p.items[key] = item
+	heap.Push(&p.heap, item)
+}
+
+func (p *lfu) Hit(key string) {
+	if item, ok := p.items[key]; ok {
+		p.tick++
+		item.count++
+		item.tick = p.tick
+		heap.Fix(&p.heap, item.index)
+	}
+}
+
+func (p *lfu) Remove(key string, evicted bool) {
+	if item, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, item.index)
+		delete(p.items, key)
+	}
+}
+
+func (p *lfu) Victim(keep string) (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+
+	if p.heap[0].key != keep {
+		return p.heap[0].key, true
+	}
+
+	// The next smallest is one of the root's children
+	var next *lfuItem
+	for _, i := range []int{ 1, 2 } {
+		if i < len(p.heap) && (next == nil || p.heap.less(p.heap[i], next)) {
+			next = p.heap[i]
+		}
+	}
+
+	if next == nil {
+		return "", false
+	}
+
+	return next.key, true
+}
+
+func (p *lfu) Len() int {
+	return len(p.items)
+}
+
+func (p *lfu) Reset() {
+	p.items = make(map[string]*lfuItem)
+	p.heap = nil
+}
+
+// lfuHeap is a min-heap of items by count, then by last use
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) less(a *lfuItem, b *lfuItem) bool {
+	if a.count != b.count {
+		return a.count < b.count
+	}
+
+	return a.tick < b.tick
+}
+
+func (h lfuHeap) Len() int { return len(h) }
+func (h lfuHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	item := x.(*lfuItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	item := old[len(old) - 1]
+	old[len(old) - 1] = nil
+	*h = old[:len(old) - 1]
+
+	return item
+}
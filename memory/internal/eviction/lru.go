@@ -0,0 +1,60 @@
+package eviction
+
+import "container/list"
+
+// lru evicts the least recently used key
+type lru struct {
+	order	*list.List
+	items	map[string]*list.Element
+}
+
+// NewLRU creates a least recently used policy
+func NewLRU() Policy {
+	return &lru{ order: list.New(), items: make(map[string]*list.Element) }
+}
+
+func (p *lru) Add(key string) {
+	if e, ok := p.items[key]; ok {
+		p.order.MoveToFront(e)
+		return
+	}
+
+	p.items[key] = p.order.PushFront(key)
+}
+
+func (p *lru) Hit(key string) {
+	if e, ok := p.items[key]; ok {
+		p.order.MoveToFront(e)
+	}
+}
+
+func (p *lru) Remove(key string, evicted bool) {
+	if e, ok := p.items[key]; ok {
+		p.order.Remove(e)
+		delete(p.items, key)
+	}
+}
+
+func (p *lru) Victim(keep string) (string, bool) {
+	return back(p.order, keep)
+}
+
+func (p *lru) Len() int {
+	return len(p.items)
+}
+
+func (p *lru) Reset() {
+	p.order.Init()
+	p.items = make(map[string]*list.Element)
+}
+
+// back returns the last key of a list other than keep
+func back(l *list.List, keep string) (string, bool) {
+	for e := l.Back(); e != nil; e = e.Prev() {
+		if key := e.Value.(string); key != keep {
+			return key, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,219 @@
+package eviction
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+// Segments of the W-TinyLFU policy
+const (
+	window = iota
+	probation
+	protected
+)
+
+// tinyLFU is the W-TinyLFU policy (Einziger, Friedman & Manes). New keys enter a small LRU window, when it overflows
+// the window's oldest key only replaces the main area's victim if the frequency sketch says it is used more often.
+// The main area is a segmented LRU, so keys read twice are protected from one-off scans.
+type tinyLFU struct {
+	capacity		int
+	windowSize		int
+	protectedSize	int
+	segments		[3]*list.List
+	items			map[string]*tinyItem
+	sketch			*sketch
+}
+
+type tinyItem struct {
+	element	*list.Element
+	segment	int
+}
+
+// NewTinyLFU creates a W-TinyLFU policy for the given capacity
+func NewTinyLFU(capacity int) Policy {
+	windowSize := max(1, capacity / 100)
+
+	p := &tinyLFU{
+		capacity:		capacity,
+		windowSize:		windowSize,
+		protectedSize:	(capacity - windowSize) * 8 / 10,
+		sketch:			newSketch(capacity),
+	}
+	p.Reset()
+
+	return p
+}
+
+func (p *tinyLFU) Add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.Hit(key)
+		return
+	}
+
+	p.sketch.increment(key)
+	p.items[key] = &tinyItem{ element: p.segments[window].PushFront(key), segment: window }
+	p.admit()
+}
+
+func (p *tinyLFU) Hit(key string) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+
+	p.sketch.increment(key)
+
+	switch item.segment {
+		case window, protected:
+			p.segments[item.segment].MoveToFront(item.element)
+		case probation:
+			p.move(key, item, protected)
+
+			if p.segments[protected].Len() > p.protectedSize {
+				demoted := p.segments[protected].Back().Value.(string)
+				p.move(demoted, p.items[demoted], probation)
+			}
+	}
+}
+
+func (p *tinyLFU) Remove(key string, evicted bool) {
+	item, ok := p.items[key]
+	if !ok {
+		return
+	}
+
+	p.segments[item.segment].Remove(item.element)
+	delete(p.items, key)
+	p.admit()
+}
+
+func (p *tinyLFU) Victim(keep string) (string, bool) {
+	if p.segments[window].Len() <= p.windowSize {
+		if key, ok := p.mainVictim(keep); ok {
+			return key, true
+		}
+
+		return back(p.segments[window], keep)
+	}
+
+	candidate, hasCandidate := back(p.segments[window], keep)
+	victim, hasVictim := p.mainVictim(keep)
+
+	switch {
+		case !hasVictim:
+			return candidate, hasCandidate
+		case !hasCandidate:
+			return victim, true
+		case p.sketch.estimate(candidate) > p.sketch.estimate(victim):
+			return victim, true
+	}
+
+	return candidate, true
+}
+
+func (p *tinyLFU) Len() int {
+	return len(p.items)
+}
+
+func (p *tinyLFU) Reset() {
+	for i := range p.segments {
+		p.segments[i] = list.New()
+	}
+	p.items = make(map[string]*tinyItem)
+	p.sketch.reset()
+}
+
+// mainVictim returns the oldest key of the main area, probation first
+func (p *tinyLFU) mainVictim(keep string) (string, bool) {
+	if key, ok := back(p.segments[probation], keep); ok {
+		return key, true
+	}
+
+	return back(p.segments[protected], keep)
+}
+
+// admit moves keys from an overflowing window into probation while there is room, once full Victim decides
+func (p *tinyLFU) admit() {
+	for p.segments[window].Len() > p.windowSize && len(p.items) <= p.capacity {
+		key := p.segments[window].Back().Value.(string)
+		p.move(key, p.items[key], probation)
+	}
+}
+
+// move puts a key at the front of a segment
+func (p *tinyLFU) move(key string, item *tinyItem, segment int) {
+	p.segments[item.segment].Remove(item.element)
+	item.element = p.segments[segment].PushFront(key)
+	item.segment = segment
+}
+
+// sketchDepth is the number of hashed counters per key
+const sketchDepth = 4
+
+// sketch is a count-min sketch of 4 bit counters that are halved periodically, so old popularity fades
+type sketch struct {
+	seed		maphash.Seed
+	counters	[]uint8
+	mask		uint64
+	additions	int
+	sample		int
+}
+
+func newSketch(capacity int) *sketch {
+	width := 64
+	for width < capacity {
+		width <<= 1
+	}
+
+	return &sketch{
+		seed:		maphash.MakeSeed(),
+		counters:	make([]uint8, width * sketchDepth),
+		mask:		uint64(width - 1),
+		sample:		10 * max(capacity, 1),
+	}
+}
+
+// index returns the counter for a key in a row
+func (s *sketch) index(hash uint64, row int) int {
+	h := uint64(uint32(hash)) + uint64(row) * (hash >> 32 | 1)
+
+	return row * int(s.mask + 1) + int(h & s.mask)
+}
+
+func (s *sketch) increment(key string) {
+	hash := maphash.String(s.seed, key)
+
+	for row := 0; row < sketchDepth; row++ {
+		if i := s.index(hash, row); s.counters[i] < 15 {
+			s.counters[i]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sample {
+		for i := range s.counters {
+			s.counters[i] >>= 1
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *sketch) estimate(key string) uint8 {
+	hash := maphash.String(s.seed, key)
+
+	estimate := uint8(15)
+	for row := 0; row < sketchDepth; row++ {
+		if c := s.counters[s.index(hash, row)]; c < estimate {
+			estimate = c
+		}
+	}
+
+	return estimate
+}
+
+func (s *sketch) reset() {
+	for i := range s.counters {
+		s.counters[i] = 0
+	}
+	s.additions = 0
+}
@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"reflect"
+	"time"
+)
+
+// Isolation chooses whether callers share the values held by the storage
+type Isolation int
+
+const (
+	// Set keeps the caller's value and Get returns it, so changes made by either are seen by everyone (the fastest)
+	IsolateNone Isolation = iota
+
+	// Set and Get make deep copies, so values behave as they would over a network but keep their Go types
+	IsolateCopy
+
+	// Set stores the value encoded by Codec and Get decodes it, exactly as the remote drivers do
+	IsolateEncode
+)
+
+// String returns the name of the mode
+func (i Isolation) String() string {
+	switch i {
+		case IsolateNone:
+			return "none"
+		case IsolateCopy:
+			return "copy"
+		case IsolateEncode:
+			return "encode"
+	}
+
+	return "unknown"
+}
+
+// store converts a value passed to Set into the data kept in an entry
+func (s *Storage) store(value any) (any, error) {
+	switch s.isolation {
+		case IsolateCopy:
+			return deepCopy(value), nil
+		case IsolateEncode:
+			return s.codec.Marshal(value)
+	}
+
+	return value, nil
+}
+
+// load converts the data kept in an entry into the value returned by Get
+func (s *Storage) load(data any) (any, error) {
+	switch s.isolation {
+		case IsolateCopy:
+			return deepCopy(data), nil
+		case IsolateEncode:
+			return s.codec.Unmarshal(data.([]byte))
+	}
+
+	return data, nil
+}
+
+// marshal encodes the data kept in an entry for snapshots and the log, encoded data is written as it is
+func (s *Storage) marshal(data any) ([]byte, error) {
+	if s.isolation == IsolateEncode {
+		return data.([]byte), nil
+	}
+
+	return s.codec.Marshal(data)
+}
+
+// unmarshal decodes the data of an entry read from a snapshot or the log
+func (s *Storage) unmarshal(b []byte) (any, error) {
+	if s.isolation == IsolateEncode {
+		return b, nil
+	}
+
+	return s.codec.Unmarshal(b)
+}
+
+// deepCopy returns a copy of a value that shares no memory with it, other than through unexported struct fields,
+// channels and functions (which cannot be copied). Shared and cyclic pointers are copied once, keeping their shape,
+// pointers into the middle of another copied value (such as to a struct's field) get their own copy.
+func deepCopy(value any) any {
+	switch v := value.(type) {
+		case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr,
+			float32, float64, complex64, complex128, time.Time, time.Duration:
+			return value
+		case []byte:
+			if v == nil {
+				return v
+			}
+			return append(make([]byte, 0, len(v)), v...)
+	}
+
+	c := copier{ seen: make(map[copied]reflect.Value) }
+
+	return c.copy(reflect.ValueOf(value)).Interface()
+}
+
+// copier deep copies values with reflection, remembering the pointers and maps already copied
+type copier struct {
+	seen map[copied]reflect.Value
+}
+
+// copied identifies a pointer or map by its type as well as its address, a struct and its first field share an address
+type copied struct {
+	p	uintptr
+	t	reflect.Type
+}
+
+func (c *copier) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+		case reflect.Pointer:
+			if v.IsNil() {
+				return v
+			}
+			key := copied{ p: v.Pointer(), t: v.Type() }
+			if n, ok := c.seen[key]; ok {
+				return n
+			}
+
+			n := reflect.New(v.Type().Elem())
+			c.seen[key] = n
+			n.Elem().Set(c.copy(v.Elem()))
+
+			return n
+		case reflect.Map:
+			if v.IsNil() {
+				return v
+			}
+			key := copied{ p: v.Pointer(), t: v.Type() }
+			if n, ok := c.seen[key]; ok {
+				return n
+			}
+
+			n := reflect.MakeMapWithSize(v.Type(), v.Len())
+			c.seen[key] = n
+			for iter := v.MapRange(); iter.Next(); {
+				n.SetMapIndex(c.copy(iter.Key()), c.copy(iter.Value()))
+			}
+
+			return n
+		case reflect.Slice:
+			if v.IsNil() {
+				return v
+			}
+
+			n := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				n.Index(i).Set(c.copy(v.Index(i)))
+			}
+
+			return n
+		case reflect.Array:
+			n := reflect.New(v.Type()).Elem()
+			for i := 0; i < v.Len(); i++ {
+				n.Index(i).Set(c.copy(v.Index(i)))
+			}
+
+			return n
+		case reflect.Struct:
+			// Unexported fields are copied as they are, reflection cannot set them individually
+			n := reflect.New(v.Type()).Elem()
+			n.Set(v)
+			for i := 0; i < v.NumField(); i++ {
+				if n.Field(i).CanSet() {
+					n.Field(i).Set(c.copy(v.Field(i)))
+				}
+			}
+
+			return n
+		case reflect.Interface:
+			if v.IsNil() {
+				return v
+			}
+
+			n := reflect.New(v.Type()).Elem()
+			n.Set(c.copy(v.Elem()))
+
+			return n
+	}
+
+	// Numbers, strings and booleans are values, channels, functions and unsafe pointers can only be shared
+	return v
+}
@@ -0,0 +1,435 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// LogSync chooses how often the append-only log is flushed to disk
+type LogSync int
+
+const (
+	// Flush once a second, a crash of the machine loses up to a second of writes (a crash of the process loses none)
+	SyncEverySecond LogSync = iota
+
+	// Flush before each Set, Delete and Reset returns, nothing acknowledged is lost but every write waits for the disk
+	SyncAlways
+
+	// Leave flushing to the operating system, which usually writes within 30 seconds
+	SyncNever
+)
+
+// String returns the name of the policy
+func (l LogSync) String() string {
+	switch l {
+		case SyncEverySecond:
+			return "everysec"
+		case SyncAlways:
+			return "always"
+		case SyncNever:
+			return "never"
+	}
+
+	return "unknown"
+}
+
+// Log files start with a magic number and a format version, followed by one record per operation:
+//
+//	payload length (uvarint), CRC-32 (IEEE) of the payload (big endian), payload
+//
+// A payload is an operation byte followed by its fields:
+//
+//	set: key length (uvarint), key, expiry (int64 unix milliseconds, big endian, 0 for none), value length (uvarint), value
+//	delete: number of keys (uvarint), then each key length (uvarint) and key
+//	reset: nothing (the default namespace)
+//	reset namespace: namespace length (uvarint), namespace
+const (
+	logMagic	= "FSML"
+	logVersion	= 1
+)
+
+const (
+	opSet byte = iota + 1
+	opDelete
+	opReset
+	opResetNamespace
+)
+
+// appendLog records every write so that the storage can be rebuilt after a restart
+type appendLog struct {
+	// Held while a write is appended and applied, so the log has the same order as the storage
+	mux			sync.Mutex
+	path		string
+	file		*os.File
+	sync		LogSync
+	// unflushed writes, for SyncEverySecond
+	dirty		bool
+	size		int64
+	// Size beyond which the garbage collector is asked to compact the log
+	compactSize	int64
+	compact		chan struct{}
+	buf			[]byte
+}
+
+// openLog opens the log for appending, writing the header to a new log
+func openLog(path string, sync LogSync, compactSize int64) (*appendLog, error) {
+	l := &appendLog{
+		path:			path,
+		sync:			sync,
+		compactSize:	compactSize,
+		compact:		make(chan struct{}, 1),
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// open starts appending to the file at path
+func (l *appendLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY | os.O_CREATE | os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = info.Size()
+
+	if l.size == 0 {
+		if _, err = f.WriteString(logMagic + string(rune(logVersion))); err != nil {
+			f.Close()
+			return err
+		}
+		l.size = int64(len(logMagic) + 1)
+	}
+
+	return nil
+}
+
+// set appends a Set, the lock must be held
+func (l *appendLog) set(key string, value []byte, expiry int64) error {
+	p := append(l.buf[:0], opSet)
+	p = appendField(p, key)
+	p = binary.BigEndian.AppendUint64(p, uint64(expiry))
+	p = binary.AppendUvarint(p, uint64(len(value)))
+	p = append(p, value...)
+
+	return l.append(p)
+}
+
+// delete appends a Delete, the lock must be held
+func (l *appendLog) delete(keys []string) error {
+	p := append(l.buf[:0], opDelete)
+	p = binary.AppendUvarint(p, uint64(len(keys)))
+	for _, key := range keys {
+		p = appendField(p, key)
+	}
+
+	return l.append(p)
+}
+
+// reset appends a Reset of a namespace, the lock must be held
+func (l *appendLog) reset(namespace string) error {
+	if namespace == "" {
+		return l.append(append(l.buf[:0], opReset))
+	}
+
+	return l.append(appendField(append(l.buf[:0], opResetNamespace), namespace))
+}
+
+// append frames and writes a payload, flushing it when the policy is SyncAlways
+func (l *appendLog) append(payload []byte) error {
+	// The payload is framed in the same buffer after itself, so neither needs allocating once it has grown
+	frame := binary.AppendUvarint(payload, uint64(len(payload)))
+	frame = binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(payload))
+	frame = append(frame, payload...)
+	l.buf = frame[:0]
+
+	record := frame[len(payload):]
+	if _, err := l.file.Write(record); err != nil {
+		return err
+	}
+	l.size += int64(len(record))
+
+	if l.sync == SyncAlways {
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+	} else {
+		l.dirty = true
+	}
+
+	if l.compactSize > 0 && l.size > l.compactSize {
+		select {
+			case l.compact <- struct{}{}:
+			default:
+		}
+	}
+
+	return nil
+}
+
+// flush writes unflushed records to disk, for SyncEverySecond
+func (l *appendLog) flush() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if !l.dirty {
+		return nil
+	}
+	l.dirty = false
+
+	return l.file.Sync()
+}
+
+// rotate moves the log aside to the .old file and starts a new one, the lock must be held.
+// Everything written before the rotation is in the storage, so a snapshot taken afterwards makes the .old file redundant.
+func (l *appendLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(l.path, l.path + ".old"); err != nil {
+		// Keep appending to the current log
+		if oerr := l.open(); oerr != nil {
+			return oerr
+		}
+		return err
+	}
+
+	return l.open()
+}
+
+// close flushes and closes the log
+func (l *appendLog) close() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	err := l.file.Sync()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// appendField appends a uvarint length followed by the string
+func appendField(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+
+	return append(b, s...)
+}
+
+// replay applies the operations recorded in a log, a missing log is not an error.
+// A damaged or partly written record ends the log (i.e. the process stopped mid-write), the file is truncated there
+// when truncate is set so that new records follow the last intact one.
+func (s *Storage) replay(path string, truncate bool) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(logMagic) + 1)
+	if _, err = io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return s.truncate(f, path, 0, truncate, err)
+	}
+	if string(header[:len(logMagic)]) != logMagic {
+		return fmt.Errorf("%s is not a memory storage log", path)
+	}
+	if header[len(logMagic)] != logVersion {
+		return fmt.Errorf("memory storage log version %d is not supported", header[len(logMagic)])
+	}
+
+	offset := int64(len(header))
+	now := s.clock.Now().UnixMilli()
+	var removed []removal
+
+	for {
+		payload, n, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return s.truncate(f, path, offset, truncate, err)
+		}
+
+		if removed, err = s.apply(payload, now, removed[:0]); err != nil {
+			return s.truncate(f, path, offset, truncate, err)
+		}
+		s.notify(removed)
+
+		offset += n
+	}
+}
+
+// truncate cuts a damaged log back to its last intact record
+func (s *Storage) truncate(f *os.File, path string, offset int64, truncate bool, cause error) error {
+	s.logger.Warn("storage log is damaged, ignoring the rest of it", "driver", "memory", "path", path, "offset", offset, "error", cause)
+
+	if !truncate {
+		return nil
+	}
+
+	// Without a header (i.e. the process stopped while creating the log) the log is started again
+	return f.Truncate(offset)
+}
+
+// readRecord reads a framed record, returning its payload and the number of bytes read
+func readRecord(r *bufio.Reader) ([]byte, int64, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, err
+	}
+	if length == 0 || length > maxSnapshotField {
+		return nil, 0, fmt.Errorf("record length %d is invalid", length)
+	}
+
+	frame := make([]byte, 4 + length)
+	if _, err = io.ReadFull(r, frame); err != nil {
+		return nil, 0, fmt.Errorf("record is incomplete: %w", err)
+	}
+
+	payload := frame[4:]
+	if binary.BigEndian.Uint32(frame) != crc32.ChecksumIEEE(payload) {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+
+	var scratch [binary.MaxVarintLen64]byte
+
+	return payload, int64(binary.PutUvarint(scratch[:], length)) + int64(len(frame)), nil
+}
+
+// apply performs a logged operation on the storage, without logging it again
+func (s *Storage) apply(payload []byte, now int64, removed []removal) ([]removal, error) {
+	onEvict := s.onEvict != nil
+	p := &logPayload{ b: payload[1:] }
+
+	switch payload[0] {
+		case opSet:
+			key := p.field()
+			expiry := int64(p.uint64())
+			value := p.bytes()
+			if p.err != nil {
+				return removed, p.err
+			}
+			s.restored(key)
+
+			// Entries that expired while the process was down are dropped
+			if expiry != 0 && expiry <= now {
+				return s.shard(key).delete([]string{ key }, removed, onEvict), nil
+			}
+
+			data, err := s.unmarshal(value)
+			if err != nil {
+				s.logger.Warn("storage could not decode a logged value", "driver", "memory", "key", key, "error", err)
+				return s.shard(key).delete([]string{ key }, removed, onEvict), nil
+			}
+
+			entry := Entry{ data: data, expiry: expiry, size: len(key) + s.sizer(data) }
+			if s.maxBytes > 0 && entry.size > s.maxBytes {
+				return removed, nil
+			}
+
+			return s.put(key, entry, removed, onEvict), nil
+		case opDelete:
+			n := p.uvarint()
+			for i := uint64(0); i < n && p.err == nil; i++ {
+				key := p.field()
+				if p.err == nil {
+					removed = s.shard(key).delete([]string{ key }, removed, onEvict)
+				}
+			}
+
+			return removed, p.err
+		case opReset:
+			return s.reset(""), nil
+		case opResetNamespace:
+			namespace := p.field()
+			if p.err != nil {
+				return removed, p.err
+			}
+
+			return s.reset(namespace), nil
+	}
+
+	return removed, fmt.Errorf("unknown log operation %d", payload[0])
+}
+
+// logPayload decodes the fields of a payload, remembering the first error
+type logPayload struct {
+	b	[]byte
+	err	error
+}
+
+// errPayload is returned for a payload that is shorter than its fields say, which its checksum should have prevented
+var errPayload = errors.New("log record is malformed")
+
+func (p *logPayload) uvarint() uint64 {
+	v, n := binary.Uvarint(p.b)
+	if n <= 0 {
+		p.fail()
+		return 0
+	}
+	p.b = p.b[n:]
+
+	return v
+}
+
+func (p *logPayload) uint64() uint64 {
+	if len(p.b) < 8 {
+		p.fail()
+		return 0
+	}
+	v := binary.BigEndian.Uint64(p.b)
+	p.b = p.b[8:]
+
+	return v
+}
+
+func (p *logPayload) bytes() []byte {
+	n := p.uvarint()
+	if uint64(len(p.b)) < n {
+		p.fail()
+		return nil
+	}
+	v := p.b[:n]
+	p.b = p.b[n:]
+
+	return v
+}
+
+func (p *logPayload) field() string {
+	return string(p.bytes())
+}
+
+func (p *logPayload) fail() {
+	p.b = nil
+	if p.err == nil {
+		p.err = errPayload
+	}
+}
@@ -1,27 +1,122 @@
 package memory
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"hash/maphash"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/paul-norman/go-fiber-storage"
-	"github.com/paul-norman/go-fiber-storage/memory/internal"
 )
 
-// Storage interface that is implemented by storage providers
+// Storage interface that is implemented by storage providers, a view of the keys of one namespace
 type Storage struct {
-	mux			sync.RWMutex
-	db			map[string]Entry
-	gcInterval	time.Duration
-	done		chan struct{}
+	*core
+	namespace	string
+	expiries	storage.ExpirySubscribers
+}
+
+// core is shared by every namespace's view of the storage
+type core struct {
+	shards			[]*shard
+	seed			maphash.Seed
+	clock			storage.Clock
+	done			chan struct{}
+	maxBytes		int
+	// MaxEntries and MaxBytes, kept to by every shard between them
+	limits			*limits
+	// Shard that balance evicts from first, moved on each time so that no shard is favoured
+	evictNext		atomic.Uint32
+	sizer			func(value any) int
+	onEvict			func(key string, value any, reason EvictReason)
+	codec			storage.Codec
+	isolation		Isolation
+	logger			storage.Logger
+	// Where snapshots are written, empty when they are disabled
+	snapshotPath	string
+	snapshotMux		sync.Mutex
+	// Records every write when LogPath is set
+	log				*appendLog
+	// The storage returned by New, which Close stops
+	root			*Storage
+	views			map[string]*Storage
+	viewsMux		sync.Mutex
+	// Set once keys outside the default namespace may exist, until then Reset can drop whole shards
+	namespaced		atomic.Bool
 }
 
 type Entry struct {
 	data any
-	// max value is 4294967295 -> Sun Feb 07 2106 06:28:15 GMT+0000
-	expiry uint32
+	// unix time in milliseconds, 0 for none
+	expiry int64
+	// size of the key and value as measured by the sizer
+	size int
+}
+
+// Item is an entry as returned by Snapshot
+type Item struct {
+	Value		any
+	// Zero for entries that do not expire
+	ExpiresAt	time.Time
+}
+
+// EvictReason explains why an entry left the storage
+type EvictReason int
+
+const (
+	// The entry's expiry passed and the garbage collector removed it
+	Expired EvictReason = iota
+
+	// The entry was chosen by the eviction policy when MaxEntries was exceeded
+	Evicted
+
+	// The entry was removed by Delete or Reset
+	Deleted
+)
+
+// String returns the name of the reason
+func (r EvictReason) String() string {
+	switch r {
+		case Expired:
+			return "expired"
+		case Evicted:
+			return "evicted"
+		case Deleted:
+			return "deleted"
+	}
+
+	return "unknown"
+}
+
+// Stats counts the outcomes of Get and the evictions made to respect MaxEntries / MaxBytes, along with the current usage
+type Stats struct {
+	Hits		uint64
+	Misses		uint64
+	Evictions	uint64
+	// Number of entries stored, including expired entries not yet collected
+	Entries		int
+	// Size of the stored keys and values, as measured by Config.Sizer
+	Bytes		int
+}
+
+// HitRatio returns the fraction of Get calls that found a value, 0 before any calls
+func (s Stats) HitRatio() float64 {
+	if s.Hits + s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits + s.Misses)
+}
+
+// removal is an OnEvict call waiting until the lock is released
+type removal struct {
+	key		string
+	value	any
+	reason	EvictReason
 }
 
 // New creates a new memory storage
@@ -30,63 +125,148 @@ func New(config ...Config) *Storage {
 	cfg := configDefault(config...)
 
 	// Create storage
-	store := &Storage{
-		db:			make(map[string]Entry),
-		gcInterval:	cfg.GCInterval,
-		done:		make(chan struct{}),
+	c := &core{
+		shards:			make([]*shard, cfg.Shards),
+		seed:			maphash.MakeSeed(),
+		clock:			cfg.Clock,
+		done:			make(chan struct{}),
+		maxBytes:		cfg.MaxBytes,
+		limits:			&limits{ maxEntries: cfg.MaxEntries, maxBytes: cfg.MaxBytes },
+		sizer:			cfg.Sizer,
+		onEvict:		cfg.OnEvict,
+		codec:			cfg.Codec,
+		isolation:		cfg.Isolation,
+		logger:			cfg.Logger,
+		snapshotPath:	cfg.SnapshotPath,
+		views:			make(map[string]*Storage),
+	}
+	for i := range c.shards {
+		c.shards[i] = newShard(cfg, cfg.Shards, c.limits)
+	}
+
+	c.root = (&Storage{ core: c }).Namespace(cfg.Namespace)
+	store := c.root
+
+	// Restore the previous snapshot, a storage that cannot be restored starts empty rather than failing
+	var snapshots storage.Ticker
+	if cfg.SnapshotPath != "" {
+		if err := store.restore(); err != nil {
+			store.logger.Error("storage snapshot restore failed", "driver", "memory", "path", cfg.SnapshotPath, "error", err)
+		}
+		snapshots = cfg.Clock.NewTicker(cfg.SnapshotInterval)
 	}
 
-	// Start garbage collector
-	internal.StartTimeStampUpdater()
-	go store.gc()
+	// Replay the writes made since the snapshot and keep logging them
+	var syncs storage.Ticker
+	if cfg.LogPath != "" {
+		store.openLog(cfg)
+
+		if store.log != nil && cfg.LogSync == SyncEverySecond {
+			syncs = cfg.Clock.NewTicker(time.Second)
+		}
+	}
+
+	// Start garbage collector, the tickers are created first so that a fake clock can be advanced straight away
+	go store.gc(cfg.Clock.NewTicker(cfg.GCInterval), snapshots, syncs)
 
 	return store
 }
 
 // Get value by key
 func (s *Storage) Get(key string) *storage.Result {
+	return s.GetContext(context.Background(), key)
+}
+
+// Get value by key, the memory storage never blocks so the context is only checked before starting
+func (s *Storage) GetContext(ctx context.Context, key string) *storage.Result {
+	if err := ctx.Err(); err != nil {
+		return &storage.Result{ Value: nil, Error: err, Missed: false }
+	}
+
 	if len(key) <= 0 {
 		return &storage.Result{ Value: nil, Error: errors.New("storage keys cannot be zero length"), Missed: false }
 	}
 
-	s.mux.RLock()
-	v, ok := s.db[key]
-	s.mux.RUnlock()
+	key = s.key(key)
+	shard := s.shard(key)
+	v, ok := shard.get(key)
 
-	if !ok || v.expiry != 0 && v.expiry <= atomic.LoadUint32(&internal.Timestamp) {
+	if !ok || v.expired(s.clock.Now().UnixMilli()) {
+		shard.misses.Add(1)
 		return &storage.Result{ Value: nil, Error: nil, Missed: true }
 	}
 
-	return &storage.Result{ Value: v.data, Error: nil, Missed: false }
+	shard.hits.Add(1)
+
+	value, err := s.load(v.data)
+	if err != nil {
+		return &storage.Result{ Value: nil, Error: err, Missed: false }
+	}
+
+	return &storage.Result{ Value: value, Error: nil, Missed: false }
 }
 
 // Set key with value
 func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
+	return s.SetContext(context.Background(), key, value, expiry...)
+}
+
+// Set key with value, the memory storage never blocks so the context is only checked before starting
+func (s *Storage) SetContext(ctx context.Context, key string, value any, expiry ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if len(key) <= 0 {
 		return errors.New("storage keys cannot be zero length")
 	}
 
-	var exp time.Duration = 0
-	if len(expiry) > 0 {
-		exp = expiry[0]
+	exp, err := storage.Expiry(expiry...)
+	if err != nil {
+		return err
 	}
 
-	var expire uint32
-	if exp != 0 {
-		expire = uint32(exp.Seconds()) + atomic.LoadUint32(&internal.Timestamp)
+	data, err := s.store(value)
+	if err != nil {
+		return err
 	}
 
-	entry := Entry{ value, expire }
+	key = s.key(key)
+	entry := Entry{ data: data, expiry: storage.ExpiresAt(s.clock.Now(), exp), size: len(key) + s.sizer(data) }
 
-	s.mux.Lock()
-	s.db[key] = entry
-	s.mux.Unlock()
+	if s.maxBytes > 0 && entry.size > s.maxBytes {
+		return fmt.Errorf("value of %d bytes is larger than MaxBytes (%d bytes)", entry.size, s.maxBytes)
+	}
 
-	return nil
+	if s.log == nil {
+		s.notify(s.put(key, entry, nil, s.onEvict != nil))
+		return nil
+	}
+
+	// A value that cannot be logged would be lost on restart
+	encoded, err := s.marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return s.write(func(l *appendLog) error {
+		return l.set(key, encoded, entry.expiry)
+	}, func() []removal {
+		return s.put(key, entry, nil, s.onEvict != nil)
+	})
 }
 
 // Delete entries by key
 func (s *Storage) Delete(keys ...string) error {
+	return s.DeleteContext(context.Background(), keys...)
+}
+
+// Delete entries by key, the memory storage never blocks so the context is only checked before starting
+func (s *Storage) DeleteContext(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if len(keys) <= 0 {
 		return errors.New("at least one key is required for Delete")
 	}
@@ -97,71 +277,355 @@ func (s *Storage) Delete(keys ...string) error {
 		}
 	}
 
-	s.mux.Lock()
-	for _, v := range keys {
-		delete(s.db, v)
+	keys = s.keys(keys)
+
+	if s.log == nil {
+		s.notify(s.delete(keys))
+		return nil
 	}
-	s.mux.Unlock()
 
-	return nil
+	return s.write(func(l *appendLog) error {
+		return l.delete(keys)
+	}, func() []removal {
+		return s.delete(keys)
+	})
+}
+
+// delete removes keys from their shards
+func (s *Storage) delete(keys []string) []removal {
+	var deleted []removal
+
+	if len(s.shards) == 1 {
+		return s.shards[0].delete(keys, deleted, s.onEvict != nil)
+	}
+
+	for _, key := range keys {
+		deleted = s.shard(key).delete([]string{ key }, deleted, s.onEvict != nil)
+	}
+
+	return deleted
 }
 
-// Reset all keys
+// Reset all keys of this namespace
 func (s *Storage) Reset() error {
-	ndb := make(map[string]Entry)
+	return s.ResetContext(context.Background())
+}
 
-	s.mux.Lock()
-	s.db = ndb
-	s.mux.Unlock()
+// Reset all keys of this namespace, the memory storage never blocks so the context is only checked before starting
+func (s *Storage) ResetContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if s.log == nil {
+		s.notify(s.reset(s.namespace))
+		return nil
+	}
+
+	return s.write(func(l *appendLog) error {
+		return l.reset(s.namespace)
+	}, func() []removal {
+		return s.reset(s.namespace)
+	})
+}
+
+// reset removes the keys of a namespace from every shard
+func (s *Storage) reset(namespace string) []removal {
+	var deleted []removal
+	for _, shard := range s.shards {
+		if s.namespaced.Load() {
+			deleted = shard.resetNamespace(namespace, deleted, s.onEvict != nil)
+		} else {
+			deleted = shard.reset(deleted, s.onEvict != nil)
+		}
+	}
+
+	return deleted
+}
+
+// write appends a change to the log before applying it. The log stays locked until the change has been applied,
+// so that it records changes in the same order as the storage.
+func (s *Storage) write(record func(l *appendLog) error, apply func() []removal) error {
+	s.log.mux.Lock()
+	if err := record(s.log); err != nil {
+		s.log.mux.Unlock()
+		return err
+	}
+	removed := apply()
+	s.log.mux.Unlock()
+
+	s.notify(removed)
 
 	return nil
 }
 
-// Close the memory storage
+// openLog replays the log left by the last run (and one that a failed compaction left aside), then starts logging.
+// A log that cannot be replayed is left alone and the storage runs without one rather than failing.
+func (s *Storage) openLog(cfg Config) {
+	old := cfg.LogPath + ".old"
+	_, err := os.Stat(old)
+	leftover := err == nil
+
+	if err = s.replay(old, false); err == nil {
+		err = s.replay(cfg.LogPath, true)
+	}
+	if err == nil {
+		s.log, err = openLog(cfg.LogPath, cfg.LogSync, cfg.LogCompactSize)
+	}
+	if err != nil {
+		s.logger.Error("storage log could not be opened, writes are not being logged", "driver", "memory", "path", cfg.LogPath, "error", err)
+		return
+	}
+
+	// The leftover log is only removed once a snapshot holds its changes
+	if leftover {
+		if err = s.SaveSnapshot(); err != nil {
+			s.logger.Error("storage snapshot failed", "driver", "memory", "path", s.snapshotPath, "error", err)
+		}
+	}
+}
+
+// Close the memory storage, writing a final snapshot when SnapshotPath is set and closing the log.
+// Closing a view returned by Namespace does nothing.
 func (s *Storage) Close() error {
+	if s != s.root {
+		return nil
+	}
+
 	s.done <- struct{}{}
 
-	return nil
+	var err error
+	if s.snapshotPath != "" {
+		err = s.SaveSnapshot()
+	}
+
+	if s.log != nil {
+		if cerr := s.log.close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
 }
 
-func (s *Storage) gc() {
-	ticker := time.NewTicker(s.gcInterval)
+// gc removes expired entries one shard at a time, so only one shard is locked at once, and writes the periodic snapshots
+func (s *Storage) gc(ticker storage.Ticker, snapshots storage.Ticker, syncs storage.Ticker) {
 	defer ticker.Stop()
-	var expired []string
+	var removed []removal
+
+	// A nil channel never receives, so there are no snapshots, flushes or compactions without a ticker or log
+	var snapshot, flush <-chan time.Time
+	if snapshots != nil {
+		defer snapshots.Stop()
+		snapshot = snapshots.C()
+	}
+	if syncs != nil {
+		defer syncs.Stop()
+		flush = syncs.C()
+	}
+	var compact <-chan struct{}
+	if s.log != nil {
+		compact = s.log.compact
+	}
 
 	for {
 		select {
 		case <-s.done:
 			return
-		case <-ticker.C:
-			ts := atomic.LoadUint32(&internal.Timestamp)
-			expired = expired[:0]
-			
-			s.mux.RLock()
-			for id, v := range s.db {
-				if v.expiry != 0 && v.expiry < ts {
-					expired = append(expired, id)
-				}
+		case <-flush:
+			if err := s.log.flush(); err != nil {
+				s.logger.Error("storage log flush failed", "driver", "memory", "path", s.log.path, "error", err)
+			}
+		case <-snapshot:
+			if err := s.SaveSnapshot(); err != nil {
+				s.logger.Error("storage snapshot failed", "driver", "memory", "path", s.snapshotPath, "error", err)
+			}
+		case <-compact:
+			if err := s.SaveSnapshot(); err != nil {
+				s.logger.Error("storage snapshot failed", "driver", "memory", "path", s.snapshotPath, "error", err)
 			}
-			s.mux.RUnlock()
-
-			// Double-checked locking (we might have replaced the item in the meantime)
-			s.mux.Lock()
-			for i := range expired {
-				v := s.db[expired[i]]
-				if v.expiry != 0 && v.expiry <= ts {
-					delete(s.db, expired[i])
-				}
+		case <-ticker.C():
+			now := s.clock.Now().UnixMilli()
+
+			for _, shard := range s.shards {
+				removed = shard.gc(now, removed[:0], s.onEvict != nil || s.subscribed())
+				s.notify(removed)
 			}
-			s.mux.Unlock()
 		}
 	}
 }
 
-// Return database client
-func (s *Storage) Conn() map[string]entry {
-	s.mux.RLock()
-	defer s.mux.RUnlock()
+// Pin keys so that they are never evicted, keys may be pinned before they are set.
+// Pinned keys still expire and can be deleted.
+func (s *Storage) Pin(keys ...string) {
+	for _, key := range s.keys(keys) {
+		s.shard(key).pin(key)
+	}
+}
+
+// Unpin keys so that they can be evicted again, they count as just used
+func (s *Storage) Unpin(keys ...string) {
+	var evicted []removal
+	for _, key := range s.keys(keys) {
+		evicted = s.balance(key, s.shard(key).unpin(key, evicted, s.onEvict != nil), s.onEvict != nil)
+	}
+
+	s.notify(evicted)
+}
+
+// Stats returns the number of hits, misses and evictions since the storage was created, along with the current usage.
+// Namespaces share the storage, so every view reports the same totals.
+func (s *Storage) Stats() Stats {
+	var stats Stats
+
+	for _, shard := range s.shards {
+		entries, bytes := shard.usage()
+
+		stats.Hits += shard.hits.Load()
+		stats.Misses += shard.misses.Load()
+		stats.Evictions += shard.evictions.Load()
+		stats.Entries += entries
+		stats.Bytes += bytes
+	}
+
+	return stats
+}
+
+// put stores an entry in its shard, returning the entries evicted to make room for it
+func (s *Storage) put(key string, entry Entry, removed []removal, onEvict bool) []removal {
+	return s.balance(key, s.shard(key).set(key, entry, removed, onEvict), onEvict)
+}
+
+// balance evicts from every shard in turn while MaxEntries or MaxBytes is exceeded, other than the key just written.
+// The shard that was written to evicts first, this is only needed when it had nothing left to evict.
+func (s *Storage) balance(keep string, removed []removal, onEvict bool) []removal {
+	for s.limits.over() {
+		start := int(s.evictNext.Add(1))
+		evicted := false
+
+		for i := range s.shards {
+			var ok bool
+			removed, ok = s.shards[(start + i) % len(s.shards)].evictOne(keep, removed, onEvict)
+			evicted = evicted || ok
+		}
+
+		// Only pinned entries are left
+		if !evicted {
+			break
+		}
+	}
+
+	return removed
+}
+
+// shard returns the shard that a key belongs to
+func (s *Storage) shard(key string) *shard {
+	if len(s.shards) == 1 {
+		return s.shards[0]
+	}
 
-	return s.db
-}
\ No newline at end of file
+	return s.shards[maphash.String(s.seed, key) & uint64(len(s.shards) - 1)]
+}
+
+// notify calls OnEvict and the OnExpire subscribers of the entry's namespace, it is called without any locks so the
+// callbacks may use the storage
+func (s *Storage) notify(removals []removal) {
+	for _, e := range removals {
+		namespace, key := splitKey(e.key)
+
+		// Encoded values are decoded for the callbacks, copies are no longer held by the storage so are given as they are
+		value := e.value
+		if s.isolation == IsolateEncode {
+			var err error
+			if value, err = s.codec.Unmarshal(value.([]byte)); err != nil {
+				s.logger.Warn("storage could not decode a removed value", "driver", "memory", "key", key, "error", err)
+			}
+		}
+
+		if s.onEvict != nil {
+			s.onEvict(key, value, e.reason)
+		}
+
+		if e.reason == Expired {
+			if view := s.view(namespace); view != nil {
+				view.expiries.Notify(key, value)
+			}
+		}
+	}
+}
+
+// OnExpire calls fn with every entry removed by the garbage collector because its expiry passed, until cancel is called.
+// Entries are reported once, up to GCInterval after they expire, and are lost if the storage is closed first.
+// Expired entries that are evicted, deleted or replaced before the garbage collector runs are not reported.
+func (s *Storage) OnExpire(fn func(key string, value any)) (cancel func()) {
+	return s.expiries.Add(fn)
+}
+
+// Range calls fn with each entry of this namespace that has not expired, until fn returns false.
+// The expiry is zero for entries that do not expire. Values are returned as Get returns them.
+// Each shard is copied under its lock and fn is called once it is released, so fn may use the storage. Entries
+// changed while Range runs may or may not be seen, use Snapshot for a consistent copy.
+func (s *Storage) Range(fn func(key string, value any, expiresAt time.Time) bool) {
+	now := s.clock.Now().UnixMilli()
+	var entries []snapshotEntry
+
+	for _, shard := range s.shards {
+		entries = shard.copy(entries[:0], now)
+
+		for _, e := range entries {
+			item, key, ok := s.item(e)
+			if ok && !fn(key, item.Value, item.ExpiresAt) {
+				return
+			}
+		}
+	}
+}
+
+// Snapshot returns a copy of the entries of this namespace that have not expired, taken at a single point in time.
+// Every shard is locked for reading while the entries are copied, so writes wait until it is done.
+func (s *Storage) Snapshot() map[string]Item {
+	for _, shard := range s.shards {
+		shard.mux.RLock()
+	}
+
+	now := s.clock.Now().UnixMilli()
+	var entries []snapshotEntry
+	for _, shard := range s.shards {
+		entries = shard.copyLocked(entries, now)
+	}
+
+	for _, shard := range s.shards {
+		shard.mux.RUnlock()
+	}
+
+	items := make(map[string]Item)
+	for _, e := range entries {
+		if item, key, ok := s.item(e); ok {
+			items[key] = item
+		}
+	}
+
+	return items
+}
+
+// item converts a copied entry into the key and item given to callers, it is not ok if the entry belongs to another
+// namespace or its value cannot be decoded
+func (s *Storage) item(e snapshotEntry) (Item, string, bool) {
+	namespace, key := splitKey(e.key)
+	if namespace != s.namespace {
+		return Item{}, "", false
+	}
+
+	value, err := s.load(e.data)
+	if err != nil {
+		s.logger.Warn("storage could not decode a value", "driver", "memory", "key", key, "error", err)
+		return Item{}, "", false
+	}
+
+	item := Item{ Value: value }
+	if e.expiry != 0 {
+		item.ExpiresAt = time.UnixMilli(e.expiry)
+	}
+
+	return item, key, true
+}
@@ -1,127 +1,814 @@
 package memory
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/clocktest"
+	"github.com/paul-norman/go-fiber-storage/storagetest"
 )
 
 var testStore = New()
 
-func Test_Storage_Memory_Set(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
+func Test_Storage_Memory_Conformance(t *testing.T) {
+	shared := New()
+	defer shared.Close()
 
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	storagetest.Run(t, func() storage.Storage {
+		return New()
+	}, storagetest.Config{
+		Namespaced: func(namespace string) storage.Storage {
+			return shared.Namespace(namespace)
+		},
+	})
 }
 
-func Test_Storage_Memory_Set_Override(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
+// evictions records OnEvict calls
+type evictions struct {
+	mux		sync.Mutex
+	calls	[]string
+}
 
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+func (e *evictions) record(key string, value any, reason EvictReason) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
 
-	err = testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	e.calls = append(e.calls, key + ":" + reason.String())
 }
 
-func Test_Storage_Memory_Get(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
+func (e *evictions) list() []string {
+	e.mux.Lock()
+	defer e.mux.Unlock()
 
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	return append([]string{}, e.calls...)
+}
 
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, val, result)
+func Test_Storage_Memory_MaxEntries(t *testing.T) {
+	evicted := &evictions{}
+	store := New(Config{ MaxEntries: 3, OnEvict: evicted.record })
+	defer store.Close()
+
+	_ = store.Set("a", 1)
+	_ = store.Set("b", 2)
+	_ = store.Set("c", 3)
+
+	// Reading and overwriting count as uses
+	_ = store.Get("a")
+	_ = store.Set("b", 20)
+
+	_ = store.Set("d", 4)
+	utils.AssertEqual(t, true, store.Get("c").Miss())
+	utils.AssertEqual(t, true, store.Get("a").Hit())
+	utils.AssertEqual(t, true, store.Get("d").Hit())
+
+	_ = store.Set("e", 5)
+	utils.AssertEqual(t, true, store.Get("b").Miss())
+	utils.AssertEqual(t, []string{ "c:evicted", "b:evicted" }, evicted.list())
+}
+
+func Test_Storage_Memory_Pin(t *testing.T) {
+	evicted := &evictions{}
+	store := New(Config{ MaxEntries: 2, OnEvict: evicted.record })
+	defer store.Close()
+
+	// Keys may be pinned before they exist
+	store.Pin("a")
+	_ = store.Set("a", 1)
+	_ = store.Set("b", 2)
+	store.Pin("b")
+
+	// Only pinned keys remain, so the storage grows past the limit
+	_ = store.Set("c", 3)
+	_ = store.Set("d", 4)
+	utils.AssertEqual(t, true, store.Get("a").Hit())
+	utils.AssertEqual(t, true, store.Get("b").Hit())
+	utils.AssertEqual(t, true, store.Get("c").Miss())
+	utils.AssertEqual(t, true, store.Get("d").Hit())
+
+	// Unpinned keys can be evicted again
+	store.Unpin("a")
+	utils.AssertEqual(t, true, store.Get("d").Miss())
+	_ = store.Set("e", 5)
+	utils.AssertEqual(t, true, store.Get("a").Miss())
+	utils.AssertEqual(t, []string{ "c:evicted", "d:evicted", "a:evicted" }, evicted.list())
+
+	// Pinned keys can still be deleted
+	_ = store.Delete("b")
+	utils.AssertEqual(t, true, store.Get("b").Miss())
 }
 
-func Test_Storage_Memory_Set_Expiration(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-		exp = 1 * time.Second
-	)
+func Test_Storage_Memory_OnEvict(t *testing.T) {
+	evicted := &evictions{}
+	clock := clocktest.NewFake()
+	store := New(Config{ GCInterval: time.Second, OnEvict: evicted.record, Clock: clock })
+	defer store.Close()
 
-	err := testStore.Set(key, val, exp)
-	utils.AssertEqual(t, nil, err)
+	_ = store.Set("a", 1)
+	_ = store.Set("b", 2)
+	_ = store.Set("c", 3, time.Second)
+	_ = store.Delete("a", "missing")
+	utils.AssertEqual(t, []string{ "a:deleted" }, evicted.list())
+
+	// Expired entries are missed straight away, then removed by the next GC run
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, true, store.Get("c").Miss())
+
+	// The next tick is only taken once that GC run has finished
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, []string{ "a:deleted", "c:expired" }, evicted.list())
 
-	time.Sleep(1100 * time.Millisecond)
+	_ = store.Reset()
+	utils.AssertEqual(t, []string{ "a:deleted", "c:expired", "b:deleted" }, evicted.list())
 }
 
-func Test_Storage_Memory_Get_Expired(t *testing.T) {
-	var (
-		key = "john"
-	)
+func Test_Storage_Memory_OnExpire(t *testing.T) {
+	var _ storage.ExpiryNotifier = &Storage{}
 
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	clock := clocktest.NewFake()
+	store := New(Config{ GCInterval: time.Second, Clock: clock })
+	defer store.Close()
+
+	events, cancel := storage.ExpiryEvents(store, 10)
+
+	_ = store.Set("john", "doe", time.Second)
+	_ = store.Set("jane", "doe", time.Second)
+	_ = store.Set("jim", "doe")
+	_ = store.Delete("jane")
+
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, storage.ExpiryEvent{ Key: "john", Value: "doe" }, <-events)
+
+	// Nothing else expired
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, 0, len(events))
+
+	cancel()
+	_, open := <-events
+	utils.AssertEqual(t, false, open)
 }
 
-func Test_Storage_Memory_Get_NotExist(t *testing.T) {
+func Test_Storage_Memory_Expiry_Index(t *testing.T) {
+	evicted := &evictions{}
+	clock := clocktest.NewFake()
+	store := New(Config{ Shards: 1, GCInterval: time.Second, OnEvict: evicted.record, Clock: clock })
+	defer store.Close()
+
+	_ = store.Set("john", "doe", time.Second)
+	_ = store.Set("jane", "doe", time.Second)
+	_ = store.Set("jim", "doe")
+
+	// Setting a key again replaces its expiry, the earlier timer is ignored
+	_ = store.Set("jane", "doe", 3 * time.Second)
+	_ = store.Set("john", "doe", time.Second)
+
+	clock.Advance(time.Second)
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, []string{ "john:expired" }, evicted.list())
+
+	clock.Advance(time.Second)
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, []string{ "john:expired", "jane:expired" }, evicted.list())
+	utils.AssertEqual(t, true, store.Get("jim").Hit())
+
+	// Timers left behind by replaced keys are dropped rather than piling up
+	for i := 0; i < 100 * compactAfter; i++ {
+		_ = store.Set("jim", i, time.Hour + time.Duration(i) * time.Millisecond)
+		_ = store.Delete("jane")
+		_ = store.Set("jane", i, time.Hour)
+	}
+	utils.AssertEqual(t, true, store.shards[0].timers.len() <= 2 * compactAfter + 2)
 
-	result, err := testStore.Get("notexist")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	_ = store.Delete("jim")
+	_ = store.Reset()
+	utils.AssertEqual(t, 0, store.shards[0].timers.len())
 }
 
-func Test_Storage_Memory_Delete(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
+func Test_Storage_Memory_Snapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.snapshot")
+	clock := clocktest.NewFake()
+	store := New(Config{ SnapshotPath: path, Clock: clock })
+
+	_ = store.Set("john", "doe")
+	_ = store.Set("jane", map[string]any{ "id": 1.0 }, time.Hour)
+	_ = store.Set("jim", []byte("doe"), time.Minute)
+	_ = store.Set("gone", "doe", time.Millisecond)
+	clock.Advance(time.Millisecond)
+
+	// Close writes the final snapshot, leaving no temporary files behind
+	utils.AssertEqual(t, nil, store.Close())
+	files, _ := filepath.Glob(path + "*")
+	utils.AssertEqual(t, []string{ path }, files)
+
+	// "jim" expires while the process is down
+	clock.Advance(30 * time.Minute)
+	store = New(Config{ SnapshotPath: path, Clock: clock })
+	defer store.Close()
+
+	utils.AssertEqual(t, 2, store.Stats().Entries)
+	utils.AssertEqual(t, "doe", store.Get("john").Value)
+	utils.AssertEqual(t, map[string]any{ "id": 1.0 }, store.Get("jane").Value)
+	utils.AssertEqual(t, true, store.Get("jim").Miss())
+
+	// The expiry is kept rather than restarted
+	clock.Advance(30 * time.Minute)
+	utils.AssertEqual(t, true, store.Get("jane").Miss())
+}
 
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+func Test_Storage_Memory_Snapshot_Interval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.snapshot")
+	clock := clocktest.NewFake()
+	store := New(Config{ SnapshotPath: path, SnapshotInterval: time.Minute, Clock: clock, Logger: storage.NopLogger })
 
-	err = testStore.Delete(key)
-	utils.AssertEqual(t, nil, err)
+	_ = store.Set("john", "doe")
+	clock.Advance(time.Minute)
+	// The next tick is only taken once that snapshot has been written
+	clock.Advance(time.Minute)
 
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	restored := New(Config{ SnapshotPath: path, Clock: clock })
+	utils.AssertEqual(t, "doe", restored.Get("john").Value)
+	utils.AssertEqual(t, nil, restored.Close())
+
+	// Values the codec cannot encode are left out
+	_ = store.Set("func", func() {})
+	utils.AssertEqual(t, nil, store.SaveSnapshot())
+
+	restored = New(Config{ SnapshotPath: path, Clock: clock, Logger: storage.NopLogger })
+	utils.AssertEqual(t, 1, restored.Stats().Entries)
+	utils.AssertEqual(t, nil, restored.Close())
+
+	// Close still stops the storage when its snapshot fails
+	utils.AssertEqual(t, nil, os.RemoveAll(filepath.Dir(path)))
+	utils.AssertEqual(t, true, store.Close() != nil)
+	utils.AssertEqual(t, true, New().SaveSnapshot() != nil)
 }
 
-func Test_Storage_Memory_Reset(t *testing.T) {
-	var (
-		val = []byte("doe")
-	)
+func Test_Storage_Memory_Snapshot_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.snapshot")
+	store := New(Config{ SnapshotPath: path })
+	_ = store.Set("john", "doe")
+	utils.AssertEqual(t, nil, store.Close())
 
-	err := testStore.Set("john1", val, 0)
+	data, err := os.ReadFile(path)
 	utils.AssertEqual(t, nil, err)
 
-	err = testStore.Set("john2", val, 0)
-	utils.AssertEqual(t, nil, err)
+	for name, damaged := range map[string][]byte{
+		"truncated":	data[:len(data) - 3],
+		"flipped":		append(append([]byte{}, data[:len(data) - 6]...), data[len(data) - 6] ^ 0xff, 0, 0, 0, 0, 0),
+		"unknown":		[]byte("not a snapshot"),
+	} {
+		utils.AssertEqual(t, nil, os.WriteFile(path, damaged, 0o600), name)
+
+		// A damaged snapshot is logged and the storage starts empty
+		store = New(Config{ SnapshotPath: path, Logger: storage.NopLogger })
+		utils.AssertEqual(t, 0, store.Stats().Entries, name)
+		utils.AssertEqual(t, true, errors.Is(store.restore(), ErrSnapshotCorrupt), name)
+		store.done <- struct{}{}
+	}
+}
 
-	err = testStore.Reset()
-	utils.AssertEqual(t, nil, err)
+// crash stops a storage without the snapshot that Close would write
+func crash(store *Storage) {
+	store.done <- struct{}{}
+	_ = store.log.close()
+}
 
-	result, err := testStore.Get("john1")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+func Test_Storage_Memory_Log(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.log")
+	clock := clocktest.NewFake()
+	store := New(Config{ LogPath: path, LogSync: SyncAlways, Clock: clock })
+
+	_ = store.Set("john", "doe")
+	_ = store.Set("jane", "doe", time.Minute)
+	_ = store.Set("jim", "doe")
+	_ = store.Delete("jim")
+	_ = store.Reset()
+	_ = store.Set("john", []byte("doe"))
+	_ = store.Set("jane", 42, time.Minute)
+	_ = store.Set("jim", "doe", time.Hour)
+	_ = store.Delete("jim", "missing")
+
+	// Values that could not be replayed are refused
+	utils.AssertEqual(t, true, store.Set("func", func() {}) != nil)
+	utils.AssertEqual(t, true, store.Get("func").Miss())
+
+	crash(store)
+
+	store = New(Config{ LogPath: path, Clock: clock })
+	utils.AssertEqual(t, 2, store.Stats().Entries)
+	utils.AssertEqual(t, []byte("doe"), store.Get("john").Value)
+	utils.AssertEqual(t, 42, store.Get("jane").Value)
+
+	// SyncEverySecond flushes the writes made during the second
+	_ = store.Set("jim", "doe")
+	clock.Advance(time.Second)
+	clock.Advance(time.Second)
+	store.log.mux.Lock()
+	utils.AssertEqual(t, false, store.log.dirty)
+	store.log.mux.Unlock()
+	_ = store.Delete("jim")
+
+	// Entries that expired while the process was down are dropped
+	crash(store)
+	clock.Advance(time.Minute)
+
+	store = New(Config{ LogPath: path, Clock: clock })
+	defer store.Close()
+	utils.AssertEqual(t, 1, store.Stats().Entries)
+	utils.AssertEqual(t, true, store.Get("jane").Miss())
+}
+
+func Test_Storage_Memory_Log_Compaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.log")
+	store := New(Config{ LogPath: path })
 
-	result, err = testStore.Get("john2")
+	for i := 0; i < 100; i++ {
+		_ = store.Set("john", i)
+	}
+	before, _ := os.Stat(path)
+
+	// The snapshot holds the logged writes, so the log starts again
+	utils.AssertEqual(t, nil, store.SaveSnapshot())
+	after, _ := os.Stat(path)
+	utils.AssertEqual(t, true, after.Size() < before.Size())
+	_, err := os.Stat(path + ".old")
+	utils.AssertEqual(t, true, os.IsNotExist(err))
+
+	_ = store.Set("jane", "doe")
+	crash(store)
+
+	store = New(Config{ LogPath: path })
+	utils.AssertEqual(t, 99, store.Get("john").Value)
+	utils.AssertEqual(t, "doe", store.Get("jane").Value)
+	crash(store)
+
+	// A log left aside by a failed snapshot is replayed, then compacted away
+	utils.AssertEqual(t, nil, os.Rename(path, path + ".old"))
+	store = New(Config{ LogPath: path })
+	utils.AssertEqual(t, "doe", store.Get("jane").Value)
+	_, err = os.Stat(path + ".old")
+	utils.AssertEqual(t, true, os.IsNotExist(err))
+
+	// Passing LogCompactSize compacts the log in the background
+	crash(store)
+	store = New(Config{ LogPath: path, LogCompactSize: 1024 })
+	defer store.Close()
+
+	for i := 0; i < 100; i++ {
+		_ = store.Set("john", i)
+	}
+	for i := 0; i < 100; i++ {
+		if info, _ := os.Stat(path); info.Size() < 1024 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	info, _ := os.Stat(path)
+	utils.AssertEqual(t, true, info.Size() < 1024)
+}
+
+func Test_Storage_Memory_Log_Damaged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.log")
+	store := New(Config{ LogPath: path })
+	_ = store.Set("john", "doe")
+	_ = store.Set("jane", "doe")
+	crash(store)
+
+	// The process stopped part of the way through writing a record
+	data, err := os.ReadFile(path)
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	utils.AssertEqual(t, nil, os.WriteFile(path, data[:len(data) - 2], 0o600))
+
+	store = New(Config{ LogPath: path, Logger: storage.NopLogger })
+	utils.AssertEqual(t, "doe", store.Get("john").Value)
+	utils.AssertEqual(t, true, store.Get("jane").Miss())
+
+	// New records follow the last intact one
+	_ = store.Set("jim", "doe")
+	crash(store)
+
+	store = New(Config{ LogPath: path })
+	defer store.Close()
+	utils.AssertEqual(t, 2, store.Stats().Entries)
+	utils.AssertEqual(t, "doe", store.Get("jim").Value)
+}
+
+func Test_Storage_Memory_Namespace(t *testing.T) {
+	evicted := &evictions{}
+	clock := clocktest.NewFake()
+	store := New(Config{ MaxEntries: 3, GCInterval: time.Second, OnEvict: evicted.record, Clock: clock })
+	defer store.Close()
+
+	sessions := store.Namespace("sessions")
+	utils.AssertEqual(t, true, sessions == store.Namespace("sessions"))
+	utils.AssertEqual(t, true, store == store.Namespace(""))
+
+	// A default key cannot be mistaken for a key of another namespace
+	_ = store.Set("john", "default")
+	_ = store.Set(namespacedKey("sessions", "john"), "escaped")
+	_ = sessions.Set("john", "sessions")
+	utils.AssertEqual(t, "default", store.Get("john").Value)
+	utils.AssertEqual(t, "escaped", store.Get(namespacedKey("sessions", "john")).Value)
+	utils.AssertEqual(t, "sessions", sessions.Get("john").Value)
+	utils.AssertEqual(t, map[string]Item{ "john": { Value: "sessions" } }, sessions.Snapshot())
+
+	// Views share the limits, OnEvict is given the key within its namespace
+	_ = sessions.Set("jane", "sessions")
+	utils.AssertEqual(t, []string{ "john:evicted" }, evicted.list())
+	utils.AssertEqual(t, true, store.Get("john").Miss())
+	utils.AssertEqual(t, 3, sessions.Stats().Entries)
+
+	// Reset only removes the keys of its own namespace
+	utils.AssertEqual(t, nil, sessions.Reset())
+	utils.AssertEqual(t, true, sessions.Get("jane").Miss())
+	utils.AssertEqual(t, 1, store.Stats().Entries)
+
+	// Expiries are reported to the subscribers of their own namespace
+	events, cancel := storage.ExpiryEvents(sessions, 10)
+	defer cancel()
+	_ = store.Set("jim", "doe", time.Second)
+	_ = sessions.Set("jim", "doe", time.Second)
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, storage.ExpiryEvent{ Key: "jim", Value: "doe" }, <-events)
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, 0, len(events))
+
+	// Closing a view leaves the storage running
+	utils.AssertEqual(t, nil, sessions.Close())
+	_ = sessions.Set("john", "doe")
+	utils.AssertEqual(t, true, store.Namespace("sessions").Get("john").Hit())
+}
+
+func Test_Storage_Memory_Namespace_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.log")
+	store := New(Config{ LogPath: path, Namespace: "app" })
+	_ = store.Set("john", "doe")
+	_ = store.Namespace("sessions").Set("john", "doe")
+	utils.AssertEqual(t, nil, store.SaveSnapshot())
+
+	_ = store.Namespace("cache").Set("john", "doe")
+	_ = store.Namespace("sessions").Reset()
+	crash(store)
+
+	// The snapshot and log keep each key in its namespace
+	store = New(Config{ LogPath: path })
+	defer store.Close()
+	utils.AssertEqual(t, true, store.Get("john").Miss())
+	utils.AssertEqual(t, true, store.Namespace("app").Get("john").Hit())
+	utils.AssertEqual(t, true, store.Namespace("cache").Get("john").Hit())
+	utils.AssertEqual(t, true, store.Namespace("sessions").Get("john").Miss())
+}
+
+func Test_Storage_Memory_Isolation(t *testing.T) {
+	for _, isolation := range []Isolation{ IsolateCopy, IsolateEncode } {
+		t.Run(isolation.String(), func(t *testing.T) {
+			clock := clocktest.NewFake()
+			storagetest.Run(t, func() storage.Storage {
+				return New(Config{ Isolation: isolation, Clock: clock })
+			}, storagetest.Config{ Advance: clock.Advance })
+
+			store := New(Config{ Isolation: isolation })
+			defer store.Close()
+
+			// Changes made after Set do not reach the stored values
+			tags := []string{ "a", "b" }
+			counts := map[string]any{ "views": 1.0 }
+			_ = store.Set("tags", tags)
+			_ = store.Set("counts", counts)
+			tags[0] = "changed"
+			counts["views"] = 2.0
+
+			// Nor do changes made to the values returned by Get
+			got := store.Get("tags").Value.([]string)
+			utils.AssertEqual(t, []string{ "a", "b" }, got)
+			got[1] = "changed"
+			_ = append(got[:2], "appended")
+
+			utils.AssertEqual(t, []string{ "a", "b" }, store.Get("tags").Value)
+			utils.AssertEqual(t, map[string]any{ "views": 1.0 }, store.Get("counts").Value)
+		})
+	}
+
+	// Without isolation every caller shares the value
+	store := New()
+	defer store.Close()
+	tags := []string{ "a", "b" }
+	_ = store.Set("tags", tags)
+	tags[0] = "changed"
+	utils.AssertEqual(t, []string{ "changed", "b" }, store.Get("tags").Value)
+}
+
+func Test_Storage_Memory_Isolation_Encode(t *testing.T) {
+	evicted := &evictions{}
+	values := make(chan any, 1)
+	store := New(Config{ Isolation: IsolateEncode, OnEvict: func(key string, value any, reason EvictReason) {
+		evicted.record(key, value, reason)
+		values <- value
+	} })
+	defer store.Close()
+
+	// Values come back as the remote drivers return them
+	type user struct {
+		Name string
+	}
+	_ = store.Set("user", user{ Name: "john" })
+	utils.AssertEqual(t, map[string]any{ "Name": "john" }, store.Get("user").Value)
+
+	// The callbacks are given the decoded value
+	_ = store.Set("count", 42)
+	_ = store.Delete("count")
+	utils.AssertEqual(t, 42, <-values)
+
+	// Values the codec cannot encode are refused
+	utils.AssertEqual(t, true, store.Set("func", func() {}) != nil)
+}
+
+func Test_Storage_Memory_DeepCopy(t *testing.T) {
+	type node struct {
+		Name		string
+		Next		*node
+		Tags		map[string][]int
+		Any			any
+		private		[]int
+	}
+
+	// Shared and cyclic pointers keep their shape
+	a := &node{ Name: "a", Tags: map[string][]int{ "x": { 1 } }, Any: []any{ 1, "b" }, private: []int{ 1 } }
+	b := &node{ Name: "b", Next: a }
+	a.Next = b
+
+	c := deepCopy(a).(*node)
+	utils.AssertEqual(t, true, c != a && c.Next != b)
+	utils.AssertEqual(t, true, c.Next.Next == c)
+	utils.AssertEqual(t, "b", c.Next.Name)
+
+	c.Tags["x"][0] = 2
+	c.Any.([]any)[0] = 2
+	utils.AssertEqual(t, 1, a.Tags["x"][0])
+	utils.AssertEqual(t, 1, a.Any.([]any)[0])
+
+	// Unexported fields cannot be copied individually, so they are shared
+	utils.AssertEqual(t, true, &c.private[0] == &a.private[0])
+
+	// A pointer to a struct and one to its first field share an address but not a type
+	type inner struct {
+		Value	int
+	}
+	type outer struct {
+		In		inner
+	}
+	type holder struct {
+		O		*outer
+		I		*inner
+	}
+	o := &outer{ In: inner{ Value: 1 } }
+	h := deepCopy(holder{ O: o, I: &o.In }).(holder)
+	utils.AssertEqual(t, 1, h.O.In.Value)
+	utils.AssertEqual(t, 1, h.I.Value)
+	utils.AssertEqual(t, true, h.O != o && h.I != &o.In)
+
+	store := New(Config{ Isolation: IsolateCopy })
+	defer store.Close()
+	utils.AssertEqual(t, nil, store.Set("holder", holder{ O: o, I: &o.In }))
+
+	bytes := []byte("doe")
+	copied := deepCopy(bytes).([]byte)
+	copied[0] = 'j'
+	utils.AssertEqual(t, []byte("doe"), bytes)
+	utils.AssertEqual(t, nil, deepCopy(nil))
+	utils.AssertEqual(t, []int(nil), deepCopy([]int(nil)))
+}
+
+func Test_Storage_Memory_Policies(t *testing.T) {
+	for _, policy := range []Policy{ LRU, LFU, WTinyLFU, ARC } {
+		t.Run(policy.String(), func(t *testing.T) {
+			clock := clocktest.NewFake()
+			storagetest.Run(t, func() storage.Storage {
+				return New(Config{ MaxEntries: 10000, Policy: policy, Clock: clock })
+			}, storagetest.Config{ Advance: clock.Advance })
+
+			store := New(Config{ MaxEntries: 100, Policy: policy })
+			defer store.Close()
+
+			store.Pin("pinned")
+			_ = store.Set("pinned", true)
+			for i := 0; i < 1000; i++ {
+				_ = store.Set(fmt.Sprint("key:", i), i)
+				_ = store.Get(fmt.Sprint("key:", i % 10))
+			}
+
+			utils.AssertEqual(t, true, store.Get("pinned").Hit())
+			utils.AssertEqual(t, true, store.Get("key:999").Hit())
+			utils.AssertEqual(t, uint64(901), store.Stats().Evictions)
+		})
+	}
+}
+
+func Test_Storage_Memory_MaxBytes(t *testing.T) {
+	evicted := &evictions{}
+	store := New(Config{ MaxBytes: 100, OnEvict: evicted.record })
+	defer store.Close()
+
+	// Keys and values are both counted
+	_ = store.Set("a", make([]byte, 39))
+	_ = store.Set("b", make([]byte, 39))
+	utils.AssertEqual(t, 80, store.Stats().Bytes)
+
+	_ = store.Set("c", "01234567890123456789")
+	utils.AssertEqual(t, []string{ "a:evicted" }, evicted.list())
+	utils.AssertEqual(t, 61, store.Stats().Bytes)
+
+	// Growing a value can evict others
+	_ = store.Set("c", make([]byte, 79))
+	utils.AssertEqual(t, []string{ "a:evicted", "b:evicted" }, evicted.list())
+	utils.AssertEqual(t, 80, store.Stats().Bytes)
+
+	// Values that could never fit are refused
+	utils.AssertEqual(t, true, store.Set("d", make([]byte, 100)) != nil)
+	utils.AssertEqual(t, true, store.Get("c").Hit())
+
+	_ = store.Delete("c")
+	utils.AssertEqual(t, 0, store.Stats().Bytes)
+	utils.AssertEqual(t, 0, store.Stats().Entries)
+}
+
+func Test_Storage_Memory_Sizer(t *testing.T) {
+	type page struct {
+		Title	string
+		Body	[]byte
+		Tags	map[string]bool
+		Parent	*page
+	}
+
+	utils.AssertEqual(t, 0, DefaultSizer(nil))
+	utils.AssertEqual(t, 5, DefaultSizer("hello"))
+	utils.AssertEqual(t, 3, DefaultSizer([]byte("abc")))
+	utils.AssertEqual(t, 1, DefaultSizer(true))
+	utils.AssertEqual(t, 8, DefaultSizer(int64(1)))
+	utils.AssertEqual(t, 24 + 8 * 4, DefaultSizer([]int64{ 1, 2, 3, 4 }))
+	utils.AssertEqual(t, 24 + 2 * (16 + 3), DefaultSizer([]string{ "abc", "def" }))
+
+	// Large values are estimated as large, and cycles are not followed forever
+	small := &page{ Title: "home", Body: make([]byte, 10) }
+	large := &page{ Title: "home", Body: make([]byte, 2 << 20), Tags: map[string]bool{ "a": true } }
+	large.Parent = large
+	utils.AssertEqual(t, true, DefaultSizer(small) < 200)
+	utils.AssertEqual(t, true, DefaultSizer(large) > 2 << 20)
+
+	// The sizer can be replaced
+	store := New(Config{ MaxBytes: 10, Sizer: func(value any) int { return 4 } })
+	defer store.Close()
+	_ = store.Set("a", large)
+	_ = store.Set("b", large)
+	utils.AssertEqual(t, 10, store.Stats().Bytes)
+}
+
+func Test_Storage_Memory_Shards(t *testing.T) {
+	utils.AssertEqual(t, 1, shards(Config{ Shards: 1 }))
+	utils.AssertEqual(t, 8, shards(Config{ Shards: 5 }))
+	utils.AssertEqual(t, 1, shards(Config{ MaxEntries: 10 }))
+	utils.AssertEqual(t, 4, shards(Config{ MaxEntries: 10, Shards: 4 }))
+	utils.AssertEqual(t, true, shards(Config{}) >= 4)
+
+	clock := clocktest.NewFake()
+	storagetest.Run(t, func() storage.Storage {
+		return New(Config{ Shards: 16, Clock: clock })
+	}, storagetest.Config{ Advance: clock.Advance })
+
+	// Limits hold across the shards, the pinned key counts towards them
+	evicted := &evictions{}
+	store := New(Config{ Shards: 4, MaxEntries: 100, OnEvict: evicted.record })
+	defer store.Close()
+
+	store.Pin("pinned")
+	_ = store.Set("pinned", true)
+	for i := 0; i < 1000; i++ {
+		_ = store.Set(fmt.Sprint("key:", i), i)
+	}
+
+	stats := store.Stats()
+	utils.AssertEqual(t, 100, stats.Entries)
+	utils.AssertEqual(t, uint64(1001 - stats.Entries), stats.Evictions)
+	utils.AssertEqual(t, int(stats.Evictions), len(evicted.list()))
+	utils.AssertEqual(t, true, store.Get("pinned").Hit())
+	utils.AssertEqual(t, 1001 - int(stats.Evictions), len(store.Snapshot()))
+}
+
+func Test_Storage_Memory_Shards_Limits(t *testing.T) {
+	// More shards than MaxEntries, every shard must not be given an entry of its own
+	entries := New(Config{ Shards: 16, MaxEntries: 10 })
+	defer entries.Close()
+
+	for i := 0; i < 100; i++ {
+		_ = entries.Set(fmt.Sprint("key:", i), i)
+		utils.AssertEqual(t, true, entries.Stats().Entries <= 10)
+	}
+	utils.AssertEqual(t, 10, entries.Stats().Entries)
+	utils.AssertEqual(t, true, entries.Get("key:99").Hit())
+
+	bytes := New(Config{ Shards: 16, MaxBytes: 100, Sizer: func(value any) int { return 10 } })
+	defer bytes.Close()
+
+	for i := 0; i < 100; i++ {
+		_ = bytes.Set(fmt.Sprint("key:", i), i)
+		utils.AssertEqual(t, true, bytes.Stats().Bytes <= 100)
+	}
+	utils.AssertEqual(t, true, bytes.Get("key:99").Hit())
+
+	// Emptied shards are no longer counted
+	_ = entries.Reset()
+	for i := 0; i < 10; i++ {
+		_ = entries.Set(fmt.Sprint("key:", i), i)
+	}
+	utils.AssertEqual(t, 10, entries.Stats().Entries)
+	utils.AssertEqual(t, uint64(90), entries.Stats().Evictions)
+}
+
+func Test_Storage_Memory_Stats(t *testing.T) {
+	store := New()
+	defer store.Close()
+
+	utils.AssertEqual(t, 0.0, store.Stats().HitRatio())
+
+	_ = store.Set("john", "doe")
+	_ = store.Get("john")
+	_ = store.Get("john")
+	_ = store.Get("jane")
+
+	stats := store.Stats()
+	utils.AssertEqual(t, uint64(2), stats.Hits)
+	utils.AssertEqual(t, uint64(1), stats.Misses)
+	utils.AssertEqual(t, 2.0 / 3.0, stats.HitRatio())
 }
 
 func Test_Storage_Memory_Close(t *testing.T) {
 	utils.AssertEqual(t, nil, testStore.Close())
 }
 
-func Test_Storage_Memory_Conn(t *testing.T) {
-	utils.AssertEqual(t, true, testStore.Conn() != nil)
+func Test_Storage_Memory_Range(t *testing.T) {
+	clock := clocktest.NewFake()
+	store := New(Config{ Shards: 4, Isolation: IsolateCopy, Clock: clock })
+	defer store.Close()
+
+	expiresAt := clock.Now().Add(time.Minute).Truncate(time.Millisecond)
+	_ = store.Set("john", []string{ "doe" })
+	_ = store.Set("jane", "doe", time.Minute)
+	_ = store.Set("expired", "doe", time.Second)
+	_ = store.Namespace("sessions").Set("john", "sessions")
+	clock.Advance(time.Second)
+
+	// Expired entries and other namespaces are skipped, values are isolated as Get isolates them
+	seen := make(map[string]Item)
+	store.Range(func(key string, value any, expiresAt time.Time) bool {
+		seen[key] = Item{ Value: value, ExpiresAt: expiresAt }
+		// The callback may use the storage
+		_ = store.Get(key)
+		return true
+	})
+	utils.AssertEqual(t, map[string]Item{
+		"john":	{ Value: []string{ "doe" } },
+		"jane":	{ Value: "doe", ExpiresAt: expiresAt },
+	}, seen)
+	seen["john"].Value.([]string)[0] = "changed"
+	utils.AssertEqual(t, []string{ "doe" }, store.Get("john").Value)
+
+	// Returning false stops the iteration
+	calls := 0
+	store.Range(func(string, any, time.Time) bool {
+		calls++
+		return false
+	})
+	utils.AssertEqual(t, 1, calls)
+}
+
+func Test_Storage_Memory_Snapshot_Copy(t *testing.T) {
+	clock := clocktest.NewFake()
+	store := New(Config{ Isolation: IsolateEncode, Clock: clock })
+	defer store.Close()
+
+	_ = store.Set("john", "doe")
+	_ = store.Set("jane", "doe", time.Second)
+	_ = store.Namespace("sessions").Set("john", "sessions")
+
+	// Encoded values are decoded
+	items := store.Snapshot()
+	utils.AssertEqual(t, map[string]Item{
+		"john":	{ Value: "doe" },
+		"jane":	{ Value: "doe", ExpiresAt: clock.Now().Add(time.Second).Truncate(time.Millisecond) },
+	}, items)
+	utils.AssertEqual(t, map[string]Item{ "john": { Value: "sessions" } }, store.Namespace("sessions").Snapshot())
+
+	// The copy is not changed by later writes
+	_ = store.Delete("john")
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, 2, len(items))
+	utils.AssertEqual(t, 0, len(store.Snapshot()))
 }
 
 
@@ -144,7 +831,7 @@ func Benchmark_Storage_Memory(b *testing.B) {
 				d.Set(key, value, ttl)
 			}
 			for _, key := range keys {
-				_, _ = d.Get(key)
+				_ = d.Get(key)
 			}
 			for _, key := range keys {
 				d.Delete(key)
@@ -152,3 +839,79 @@ func Benchmark_Storage_Memory(b *testing.B) {
 		}
 	})
 }
+
+// A garbage collection pass only visits the keys that have expired, however many keys never expire
+// go test -v -run=^$ -bench=Benchmark_Storage_Memory_GC -benchmem
+func Benchmark_Storage_Memory_GC(b *testing.B) {
+	store := New(Config{ Shards: 1, GCInterval: time.Hour })
+	defer store.Close()
+
+	for i := 0; i < 100000; i++ {
+		_ = store.Set(fmt.Sprint("key:", i), i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	var removed []removal
+	for n := 0; n < b.N; n++ {
+		_ = store.Set("expiring", n, time.Millisecond)
+		removed = store.shards[0].gc(time.Now().Add(time.Second).UnixMilli(), removed[:0], false)
+	}
+}
+
+// The cost of each isolation mode for a typical cached value
+// go test -v -run=^$ -bench=Benchmark_Storage_Memory_Isolation -benchmem
+func Benchmark_Storage_Memory_Isolation(b *testing.B) {
+	value := map[string]any{ "id": 1.0, "name": "john", "roles": []any{ "admin", "user" } }
+
+	for _, isolation := range []Isolation{ IsolateNone, IsolateCopy, IsolateEncode } {
+		b.Run(isolation.String(), func(b *testing.B) {
+			d := New(Config{ Isolation: isolation })
+			defer d.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				_ = d.Set("john", value)
+				_ = d.Get("john")
+			}
+		})
+	}
+}
+
+// Throughput should scale with the number of CPUs when sharded, compare with the single shard results
+// go test -v -run=^$ -bench=Benchmark_Storage_Memory_Parallel -benchmem -cpu=1,2,4,8
+func Benchmark_Storage_Memory_Parallel(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = utils.UUID()
+	}
+	value := []byte("joe")
+
+	for _, shards := range []int{ 1, 0 } {
+		name := "sharded"
+		if shards == 1 {
+			name = "single"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			d := New(Config{ Shards: shards })
+			defer d.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i & 1023]
+					if i % 4 == 0 {
+						_ = d.Set(key, value, time.Minute)
+					} else {
+						_ = d.Get(key)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
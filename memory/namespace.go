@@ -0,0 +1,130 @@
+package memory
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+// Keys of the default namespace are stored as they are. Other keys are stored after a zero byte and the length prefixed
+// namespace, which no default key can be confused with as those starting with a zero byte are stored in the same way.
+const namespaceMarker = "\x00"
+
+// Namespace returns a view of the storage holding only the keys of the namespace, so several logical stores can share
+// one process. Views share the garbage collector, the limits, the eviction policy, Stats, snapshots and the log, but
+// each has its own keys, Reset and OnExpire subscribers. The same view is returned for the same namespace, and ""
+// is the namespace of the storage returned by New (unless Config.Namespace is set). Close does nothing on a view,
+// closing the storage returned by New closes every view.
+func (s *Storage) Namespace(namespace string) *Storage {
+	s.viewsMux.Lock()
+	defer s.viewsMux.Unlock()
+
+	if view, ok := s.views[namespace]; ok {
+		return view
+	}
+
+	if namespace != "" {
+		s.namespaced.Store(true)
+	}
+
+	view := &Storage{ core: s.core, namespace: namespace }
+	s.views[namespace] = view
+
+	return view
+}
+
+// view returns the view of a namespace, nil if none has been created
+func (s *Storage) view(namespace string) *Storage {
+	s.viewsMux.Lock()
+	defer s.viewsMux.Unlock()
+
+	return s.views[namespace]
+}
+
+// subscribed reports whether any view has OnExpire subscribers
+func (s *Storage) subscribed() bool {
+	s.viewsMux.Lock()
+	defer s.viewsMux.Unlock()
+
+	for _, view := range s.views {
+		if view.expiries.Len() > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// restored notes a stored key read back from a snapshot or log, which may belong to a namespace without a view yet
+func (s *Storage) restored(stored string) {
+	if strings.HasPrefix(stored, namespaceMarker) {
+		s.namespaced.Store(true)
+	}
+}
+
+// key returns the key that a key of this storage's namespace is stored under
+func (s *Storage) key(key string) string {
+	return namespacedKey(s.namespace, key)
+}
+
+// keys returns the stored keys for keys of this storage's namespace, only allocating when they differ
+func (s *Storage) keys(keys []string) []string {
+	for i, key := range keys {
+		if stored := s.key(key); stored != key {
+			converted := make([]string, len(keys))
+			copy(converted, keys[:i])
+			for j := i; j < len(keys); j++ {
+				converted[j] = s.key(keys[j])
+			}
+
+			return converted
+		}
+	}
+
+	return keys
+}
+
+// namespacedKey returns the key that a key of a namespace is stored under
+func namespacedKey(namespace string, key string) string {
+	if namespace == "" && !strings.HasPrefix(key, namespaceMarker) {
+		return key
+	}
+
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(namespace)))
+
+	var b strings.Builder
+	b.Grow(len(namespaceMarker) + n + len(namespace) + len(key))
+	b.WriteString(namespaceMarker)
+	b.Write(length[:n])
+	b.WriteString(namespace)
+	b.WriteString(key)
+
+	return b.String()
+}
+
+// splitKey returns the namespace and key of a stored key
+func splitKey(stored string) (namespace string, key string) {
+	if !strings.HasPrefix(stored, namespaceMarker) {
+		return "", stored
+	}
+
+	rest := stored[len(namespaceMarker):]
+
+	// Every stored key starting with the marker was written by namespacedKey, the check only guards against misuse
+	var length, shift uint64
+	n := 0
+	for n < len(rest) {
+		c := rest[n]
+		n++
+		length |= uint64(c & 0x7f) << shift
+		if c < 0x80 {
+			break
+		}
+		shift += 7
+	}
+	if uint64(len(rest) - n) < length {
+		return "", stored
+	}
+
+	return rest[n:n + int(length)], rest[n + int(length):]
+}
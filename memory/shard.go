@@ -0,0 +1,360 @@
+package memory
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/paul-norman/go-fiber-storage/memory/internal/eviction"
+)
+
+// shard is an independently locked part of the storage, each key belongs to exactly one shard
+type shard struct {
+	mux			sync.RWMutex
+	db			map[string]Entry
+	// MaxEntries and MaxBytes, shared with the other shards
+	limits		*limits
+	// size of every key and value, kept up to date under the lock
+	bytes		int
+	// Chooses the keys to evict, pinned keys are not given to it
+	policy		eviction.Policy
+	pinned		map[string]struct{}
+	// Expiry index of the keys with an expiry
+	timers		timers
+	hits		atomic.Uint64
+	misses		atomic.Uint64
+	evictions	atomic.Uint64
+	// keeps neighbouring shards' locks on separate cache lines
+	_			[64]byte
+}
+
+// limits are MaxEntries and MaxBytes along with the usage of every shard, so that the shards keep to them between them
+type limits struct {
+	maxEntries	int
+	maxBytes	int
+	entries		atomic.Int64
+	bytes		atomic.Int64
+}
+
+// bounded reports whether entries are evicted to respect MaxEntries or MaxBytes
+func (l *limits) bounded() bool {
+	return l.maxEntries > 0 || l.maxBytes > 0
+}
+
+// over reports whether MaxEntries or MaxBytes is exceeded
+func (l *limits) over() bool {
+	return (l.maxEntries > 0 && l.entries.Load() > int64(l.maxEntries)) || (l.maxBytes > 0 && l.bytes.Load() > int64(l.maxBytes))
+}
+
+// newShard creates a shard that keeps to the shared limits
+func newShard(cfg Config, shards int, l *limits) *shard {
+	return &shard{
+		db:			make(map[string]Entry),
+		limits:		l,
+		policy:		cfg.Policy.create(share(cfg.MaxEntries, shards)),
+		pinned:		make(map[string]struct{}),
+	}
+}
+
+// share divides a limit between the shards for sizing their eviction policies, rounding up so that none is left
+// without room
+func share(limit int, shards int) int {
+	if limit <= 0 {
+		return 0
+	}
+
+	return (limit + shards - 1) / shards
+}
+
+// get returns the entry for a key, whether or not it has expired
+func (s *shard) get(key string) (Entry, bool) {
+	if !s.bounded() {
+		s.mux.RLock()
+		v, ok := s.db[key]
+		s.mux.RUnlock()
+
+		return v, ok
+	}
+
+	// Reads are recorded by the eviction policy
+	s.mux.Lock()
+	v, ok := s.db[key]
+	if ok && s.tracked(key) {
+		s.policy.Hit(key)
+	}
+	s.mux.Unlock()
+
+	return v, ok
+}
+
+// set stores an entry, returning the entries evicted to make room for it
+func (s *shard) set(key string, entry Entry, removed []removal, onEvict bool) []removal {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	old, exists := s.db[key]
+	s.db[key] = entry
+	s.bytes += entry.size - old.size
+	s.limits.bytes.Add(int64(entry.size - old.size))
+	if !exists {
+		s.limits.entries.Add(1)
+	}
+
+	// The key's timer still matches when the expiry is unchanged
+	if !exists || old.expiry != entry.expiry {
+		if old.expiry != 0 {
+			s.forget()
+		}
+		if entry.expiry != 0 {
+			s.timers.add(key, entry.expiry)
+		}
+	}
+
+	if s.tracked(key) {
+		if exists {
+			s.policy.Hit(key)
+		} else {
+			s.policy.Add(key)
+		}
+	}
+
+	// Overwrites may grow a value past the byte budget
+	return s.evict(key, removed, onEvict)
+}
+
+// delete removes keys, all of which must belong to this shard
+func (s *shard) delete(keys []string, removed []removal, onEvict bool) []removal {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, key := range keys {
+		if entry, ok := s.db[key]; ok {
+			removed = s.remove(removed, key, entry, Deleted, onEvict)
+		}
+	}
+
+	return removed
+}
+
+// reset removes every entry, pinned keys stay pinned
+func (s *shard) reset(removed []removal, onEvict bool) []removal {
+	ndb := make(map[string]Entry)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if onEvict {
+		for key, entry := range s.db {
+			removed = append(removed, removal{ key, entry.data, Deleted })
+		}
+	}
+	s.limits.entries.Add(-int64(len(s.db)))
+	s.limits.bytes.Add(-int64(s.bytes))
+	s.db = ndb
+	s.bytes = 0
+	s.policy.Reset()
+	s.timers.reset()
+
+	return removed
+}
+
+// resetNamespace removes every entry of a namespace, pinned keys stay pinned
+func (s *shard) resetNamespace(namespace string, removed []removal, onEvict bool) []removal {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for key, entry := range s.db {
+		if ns, _ := splitKey(key); ns == namespace {
+			removed = s.remove(removed, key, entry, Deleted, onEvict)
+		}
+	}
+
+	return removed
+}
+
+// gc removes the entries that expired by now (unix milliseconds), visiting only those entries
+func (s *shard) gc(now int64, removed []removal, onEvict bool) []removal {
+	// Most passes find nothing due, so readers are only held up when there is work to do
+	s.mux.RLock()
+	due := s.timers.due(now)
+	s.mux.RUnlock()
+
+	if !due {
+		return removed
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for {
+		t, ok := s.timers.next(now)
+		if !ok {
+			break
+		}
+
+		// The key may have been removed or set again since the timer started
+		entry, ok := s.db[t.key]
+		if !ok || entry.expiry != t.expiry {
+			s.timers.skip()
+			continue
+		}
+
+		removed = s.remove(removed, t.key, entry, Expired, onEvict)
+	}
+
+	return removed
+}
+
+// copy appends the entries that have not expired by now (unix milliseconds)
+func (s *shard) copy(entries []snapshotEntry, now int64) []snapshotEntry {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return s.copyLocked(entries, now)
+}
+
+// copyLocked is copy for callers that already hold the lock
+func (s *shard) copyLocked(entries []snapshotEntry, now int64) []snapshotEntry {
+	for key, entry := range s.db {
+		if !entry.expired(now) {
+			entries = append(entries, snapshotEntry{ key: key, data: entry.data, expiry: entry.expiry })
+		}
+	}
+
+	return entries
+}
+
+// pin keeps a key away from the eviction policy
+func (s *shard) pin(key string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.pinned[key] = struct{}{}
+
+	if _, ok := s.db[key]; ok && s.bounded() {
+		s.policy.Remove(key, false)
+	}
+}
+
+// unpin gives a key back to the eviction policy, as just used
+func (s *shard) unpin(key string, removed []removal, onEvict bool) []removal {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	_, pinned := s.pinned[key]
+	delete(s.pinned, key)
+
+	if _, ok := s.db[key]; ok && pinned && s.tracked(key) {
+		s.policy.Add(key)
+	}
+
+	return s.evict(key, removed, onEvict)
+}
+
+// usage returns the number of entries and their size
+func (s *shard) usage() (int, int) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return len(s.db), s.bytes
+}
+
+// bounded reports whether entries are evicted to respect MaxEntries or MaxBytes
+func (s *shard) bounded() bool {
+	return s.limits.bounded()
+}
+
+// tracked reports whether the eviction policy holds the key, the lock must be held
+func (s *shard) tracked(key string) bool {
+	if !s.bounded() {
+		return false
+	}
+
+	_, pinned := s.pinned[key]
+
+	return !pinned
+}
+
+// evict removes the entries chosen by the policy until MaxEntries and MaxBytes are respected, the lock must be held.
+// The key that was just written is kept, the storage evicts from the other shards when this one runs out of entries.
+func (s *shard) evict(keep string, removed []removal, onEvict bool) []removal {
+	for s.limits.over() {
+		key, ok := s.policy.Victim(keep)
+		if !ok {
+			break
+		}
+
+		removed = s.remove(removed, key, s.db[key], Evicted, onEvict)
+		s.evictions.Add(1)
+	}
+
+	return removed
+}
+
+// evictOne removes the entry chosen by the policy if MaxEntries or MaxBytes is still exceeded, reporting whether it did
+func (s *shard) evictOne(keep string, removed []removal, onEvict bool) ([]removal, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if !s.limits.over() {
+		return removed, false
+	}
+
+	key, ok := s.policy.Victim(keep)
+	if !ok {
+		return removed, false
+	}
+
+	removed = s.remove(removed, key, s.db[key], Evicted, onEvict)
+	s.evictions.Add(1)
+
+	return removed, true
+}
+
+// remove deletes an entry, recording it for OnEvict, the lock must be held
+func (s *shard) remove(removed []removal, key string, entry Entry, reason EvictReason, onEvict bool) []removal {
+	if s.tracked(key) {
+		s.policy.Remove(key, reason == Evicted)
+	}
+	delete(s.db, key)
+	s.bytes -= entry.size
+	s.limits.entries.Add(-1)
+	s.limits.bytes.Add(-int64(entry.size))
+
+	// The garbage collector has already taken the timer of an expired entry
+	if entry.expiry != 0 && reason != Expired {
+		s.forget()
+	}
+
+	if onEvict {
+		removed = append(removed, removal{ key, entry.data, reason })
+	}
+
+	return removed
+}
+
+// forget leaves a timer that no longer matches its key in the expiry index, compacting the index when it is mostly stale.
+// The lock must be held.
+func (s *shard) forget() {
+	s.timers.forget()
+
+	if s.timers.wasteful() {
+		// A key deleted and set again with the same expiry has two matching timers, only one is kept
+		kept := make(map[string]struct{}, len(s.db))
+		s.timers.compact(func(t timer) bool {
+			entry, ok := s.db[t.key]
+			if !ok || entry.expiry != t.expiry {
+				return false
+			}
+			if _, dup := kept[t.key]; dup {
+				return false
+			}
+			kept[t.key] = struct{}{}
+			return true
+		})
+	}
+}
+
+// expired reports whether an entry's expiry has passed at now, in unix milliseconds
+func (e Entry) expired(now int64) bool {
+	return e.expiry != 0 && e.expiry <= now
+}
@@ -0,0 +1,137 @@
+package memory
+
+import "reflect"
+
+// Sizes the estimates assume for the parts of values that Go does not expose
+const (
+	pointerSize		= 8
+	sliceHeader		= 24
+	stringHeader	= 16
+	interfaceSize	= 16
+	mapOverhead		= 48
+	// each map entry also costs roughly a slot in a bucket
+	mapEntryOverhead = 8
+)
+
+// DefaultSizer measures []byte and string values exactly and numbers by their width.
+// Anything else (maps, slices, structs, pointers) is estimated by walking it with reflection,
+// counting headers, referenced memory and each distinct pointer once.
+func DefaultSizer(value any) int {
+	switch v := value.(type) {
+		case nil:
+			return 0
+		case []byte:
+			return len(v)
+		case string:
+			return len(v)
+		case bool, int8, uint8:
+			return 1
+		case int16, uint16:
+			return 2
+		case int32, uint32, float32:
+			return 4
+		case int, int64, uint, uint64, float64, complex64:
+			return 8
+		case complex128:
+			return 16
+	}
+
+	return estimate(reflect.ValueOf(value), make(map[uintptr]struct{}))
+}
+
+// estimate returns the memory held by a value, including what it points to
+func estimate(v reflect.Value, seen map[uintptr]struct{}) int {
+	switch v.Kind() {
+		case reflect.String:
+			return stringHeader + v.Len()
+		case reflect.Slice:
+			if v.IsNil() {
+				return sliceHeader
+			}
+			if _, ok := seen[v.Pointer()]; ok {
+				return sliceHeader
+			}
+			seen[v.Pointer()] = struct{}{}
+			return sliceHeader + elements(v, v.Cap(), seen)
+		case reflect.Array:
+			return elements(v, v.Len(), seen)
+		case reflect.Map:
+			if v.IsNil() {
+				return pointerSize
+			}
+			if _, ok := seen[v.Pointer()]; ok {
+				return pointerSize
+			}
+			seen[v.Pointer()] = struct{}{}
+			size := pointerSize + mapOverhead
+			iter := v.MapRange()
+			for iter.Next() {
+				size += estimate(iter.Key(), seen) + estimate(iter.Value(), seen) + mapEntryOverhead
+			}
+			return size
+		case reflect.Pointer:
+			if v.IsNil() {
+				return pointerSize
+			}
+			if _, ok := seen[v.Pointer()]; ok {
+				return pointerSize
+			}
+			seen[v.Pointer()] = struct{}{}
+			return pointerSize + estimate(v.Elem(), seen)
+		case reflect.Interface:
+			if v.IsNil() {
+				return interfaceSize
+			}
+			return interfaceSize + estimate(v.Elem(), seen)
+		case reflect.Struct:
+			size := 0
+			for i := 0; i < v.NumField(); i++ {
+				size += estimate(v.Field(i), seen)
+			}
+			// padding between fields
+			if padded := int(v.Type().Size()); padded > size {
+				return padded
+			}
+			return size
+	}
+
+	// Numbers, bools, channels, functions and unsafe pointers only count their own width
+	return int(v.Type().Size())
+}
+
+// elements sums the elements of a slice or array, fixed width elements are not walked one by one
+func elements(v reflect.Value, n int, seen map[uintptr]struct{}) int {
+	elem := v.Type().Elem()
+	if fixedWidth(elem) {
+		return n * int(elem.Size())
+	}
+
+	size := 0
+	for i := 0; i < v.Len(); i++ {
+		size += estimate(v.Index(i), seen)
+	}
+
+	// unused capacity
+	return size + (n - v.Len()) * int(elem.Size())
+}
+
+// fixedWidth reports whether values of the type never reference other memory
+func fixedWidth(t reflect.Type) bool {
+	switch t.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+			return true
+		case reflect.Array:
+			return fixedWidth(t.Elem())
+		case reflect.Struct:
+			for i := 0; i < t.NumField(); i++ {
+				if !fixedWidth(t.Field(i).Type) {
+					return false
+				}
+			}
+			return true
+	}
+
+	return false
+}
@@ -0,0 +1,315 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Snapshot files start with a magic number and a format version, followed by one record per entry:
+//
+//	key length (uvarint), key, expiry (int64 unix milliseconds, big endian, 0 for none), value length (uvarint), value
+//
+// A zero key length ends the records, followed by the CRC-32 (IEEE) of everything before it
+const (
+	snapshotMagic		= "FSMS"
+	snapshotVersion		= 1
+	// Larger lengths can only come from a damaged file, refusing them avoids a huge allocation before the checksum fails
+	maxSnapshotField	= 1 << 30
+)
+
+// ErrSnapshotCorrupt is logged when a snapshot cannot be restored because it is truncated or damaged
+var ErrSnapshotCorrupt = errors.New("memory snapshot is corrupt")
+
+// snapshotEntry is an entry copied out of a shard so that it can be encoded, or given to Range, without holding the lock
+type snapshotEntry struct {
+	key		string
+	data	any
+	expiry	int64
+}
+
+// SaveSnapshot writes every entry that has not expired to Config.SnapshotPath, replacing the previous snapshot atomically,
+// and compacts the log when LogPath is set. It is called every SnapshotInterval and by Close (and when the log passes
+// LogCompactSize), calling it directly is only needed to snapshot at a particular moment.
+func (s *Storage) SaveSnapshot() error {
+	if s.snapshotPath == "" {
+		return errors.New("memory storage has no SnapshotPath")
+	}
+
+	// Snapshots are written one at a time so that an older one never replaces a newer one
+	s.snapshotMux.Lock()
+	defer s.snapshotMux.Unlock()
+
+	// The writes logged so far are moved aside, the snapshot will hold them
+	rotated, err := s.rotateLog()
+	if err != nil {
+		return err
+	}
+
+	dir, base := filepath.Split(s.snapshotPath)
+	if dir == "" {
+		dir = "."
+	}
+
+	// The temporary file is in the same directory so that the rename cannot cross file systems
+	f, err := os.CreateTemp(dir, base + ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if err = s.writeSnapshot(f); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.snapshotPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	// The rename must reach the disk before the log it replaces is dropped
+	if err := syncDir(dir); err != nil {
+		return err
+	}
+
+	if rotated {
+		return os.Remove(s.log.path + ".old")
+	}
+
+	return nil
+}
+
+// syncDir flushes a directory's entries, so that a rename within it survives a crash. Windows cannot sync a
+// directory, there the error is ignored.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && runtime.GOOS != "windows" {
+		return err
+	}
+
+	return nil
+}
+
+// rotateLog moves the log aside so that a new one only holds the writes made after the snapshot starts.
+// A log left aside by a failed snapshot is kept instead, with the current log growing until a snapshot succeeds.
+func (s *Storage) rotateLog() (bool, error) {
+	if s.log == nil {
+		return false, nil
+	}
+
+	s.log.mux.Lock()
+	defer s.log.mux.Unlock()
+
+	if _, err := os.Stat(s.log.path + ".old"); err == nil {
+		return true, nil
+	}
+
+	return true, s.log.rotate()
+}
+
+// writeSnapshot encodes the entries one shard at a time, so only one shard is locked at once
+func (s *Storage) writeSnapshot(w io.Writer) error {
+	crc := crc32.NewIEEE()
+	buf := bufio.NewWriter(io.MultiWriter(w, crc))
+
+	if _, err := buf.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := buf.WriteByte(snapshotVersion); err != nil {
+		return err
+	}
+
+	now := s.clock.Now().UnixMilli()
+	var entries []snapshotEntry
+	var scratch [binary.MaxVarintLen64]byte
+
+	for _, shard := range s.shards {
+		entries = shard.copy(entries[:0], now)
+
+		for _, e := range entries {
+			value, err := s.marshal(e.data)
+			if err != nil {
+				// One value the codec cannot handle should not cost every other entry
+				s.logger.Warn("storage could not encode a value for the snapshot", "driver", "memory", "key", e.key, "error", err)
+				continue
+			}
+
+			buf.Write(scratch[:binary.PutUvarint(scratch[:], uint64(len(e.key)))])
+			buf.WriteString(e.key)
+			binary.BigEndian.PutUint64(scratch[:8], uint64(e.expiry))
+			buf.Write(scratch[:8])
+			buf.Write(scratch[:binary.PutUvarint(scratch[:], uint64(len(value)))])
+			if _, err = buf.Write(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := buf.WriteByte(0); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+
+	// The checksum is written after everything it covers
+	_, err := w.Write(crc.Sum(nil))
+
+	return err
+}
+
+// restore loads the entries of a snapshot that have not expired since it was written, a missing snapshot is not an error
+func (s *Storage) restore() error {
+	f, err := os.Open(s.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	crc := crc32.NewIEEE()
+	r := &snapshotReader{ r: bufio.NewReader(f), crc: crc }
+
+	header := make([]byte, len(snapshotMagic) + 1)
+	if err = r.full(header); err != nil {
+		return err
+	}
+	if string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return fmt.Errorf("%w: not a snapshot", ErrSnapshotCorrupt)
+	}
+	if header[len(snapshotMagic)] != snapshotVersion {
+		return fmt.Errorf("memory snapshot version %d is not supported", header[len(snapshotMagic)])
+	}
+
+	// Entries are only stored once the checksum proves the whole file is intact
+	type record struct {
+		key		string
+		expiry	int64
+		value	[]byte
+	}
+	var records []record
+	expiry := make([]byte, 8)
+
+	for {
+		key, err := r.bytes()
+		if err != nil {
+			return err
+		}
+		if len(key) == 0 {
+			break
+		}
+
+		if err = r.full(expiry); err != nil {
+			return err
+		}
+
+		value, err := r.bytes()
+		if err != nil {
+			return err
+		}
+
+		records = append(records, record{ key: string(key), expiry: int64(binary.BigEndian.Uint64(expiry)), value: value })
+	}
+
+	sum := crc.Sum(nil)
+	stored := make([]byte, len(sum))
+	if _, err = io.ReadFull(r.r, stored); err != nil || string(sum) != string(stored) {
+		return fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupt)
+	}
+
+	now := s.clock.Now().UnixMilli()
+	var evicted []removal
+
+	for _, e := range records {
+		// Entries that expired while the process was down are dropped
+		if e.expiry != 0 && e.expiry <= now {
+			continue
+		}
+
+		s.restored(e.key)
+
+		data, err := s.unmarshal(e.value)
+		if err != nil {
+			s.logger.Warn("storage could not decode a snapshot value", "driver", "memory", "key", e.key, "error", err)
+			continue
+		}
+
+		entry := Entry{ data: data, expiry: e.expiry, size: len(e.key) + s.sizer(data) }
+		if s.maxBytes > 0 && entry.size > s.maxBytes {
+			continue
+		}
+
+		evicted = s.put(e.key, entry, evicted[:0], s.onEvict != nil)
+		s.notify(evicted)
+	}
+
+	return nil
+}
+
+// snapshotReader reads length prefixed fields, adding everything it reads to the checksum
+type snapshotReader struct {
+	r	*bufio.Reader
+	crc	hash.Hash32
+}
+
+// full fills b
+func (r *snapshotReader) full(b []byte) error {
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+	}
+	r.crc.Write(b)
+
+	return nil
+}
+
+// bytes reads a uvarint length followed by that many bytes
+func (r *snapshotReader) bytes() ([]byte, error) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := 0
+
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotCorrupt, err)
+		}
+		if n == len(scratch) {
+			return nil, fmt.Errorf("%w: length overflow", ErrSnapshotCorrupt)
+		}
+		scratch[n] = c
+		n++
+		if c < 0x80 {
+			break
+		}
+	}
+	r.crc.Write(scratch[:n])
+
+	length, _ := binary.Uvarint(scratch[:n])
+	if length > maxSnapshotField {
+		return nil, fmt.Errorf("%w: length %d is too large", ErrSnapshotCorrupt, length)
+	}
+
+	b := make([]byte, length)
+	if err := r.full(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
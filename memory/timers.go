@@ -0,0 +1,116 @@
+package memory
+
+import "container/heap"
+
+// compactAfter is the number of stale timers a shard tolerates before they may be dropped together
+const compactAfter = 1024
+
+// timer is the expiry of a key (unix milliseconds) in the expiry index
+type timer struct {
+	expiry	int64
+	key		string
+}
+
+// timers is a min-heap of the expiries of a shard's keys, so the garbage collector only visits keys that have expired
+// and keys without an expiry cost nothing. Deleting or replacing a key leaves its timer behind: stale timers are skipped
+// when they come up, and dropped together once they make up half of the heap.
+type timers struct {
+	heap	timerHeap
+	stale	int
+}
+
+// add starts a timer for a key
+func (t *timers) add(key string, expiry int64) {
+	heap.Push(&t.heap, timer{ expiry: expiry, key: key })
+}
+
+// next removes and returns the earliest timer if it is due by now
+func (t *timers) next(now int64) (timer, bool) {
+	if !t.due(now) {
+		return timer{}, false
+	}
+
+	return heap.Pop(&t.heap).(timer), true
+}
+
+// due reports whether a timer is due by now
+func (t *timers) due(now int64) bool {
+	return len(t.heap) > 0 && t.heap[0].expiry <= now
+}
+
+// forget records that a timer left in the heap no longer matches its key
+func (t *timers) forget() {
+	t.stale++
+}
+
+// skip records that a stale timer has been removed from the heap
+func (t *timers) skip() {
+	// The count only decides when to compact, it must never go negative
+	if t.stale > 0 {
+		t.stale--
+	}
+}
+
+// wasteful reports whether enough of the heap is stale to be worth compacting
+func (t *timers) wasteful() bool {
+	return t.stale > compactAfter && t.stale * 2 > len(t.heap)
+}
+
+// compact drops the timers that are no longer live
+func (t *timers) compact(live func(timer) bool) {
+	kept := t.heap[:0]
+	for _, tm := range t.heap {
+		if live(tm) {
+			kept = append(kept, tm)
+		}
+	}
+
+	// Release the keys held by the dropped timers
+	for i := len(kept); i < len(t.heap); i++ {
+		t.heap[i] = timer{}
+	}
+
+	t.heap = kept
+	t.stale = 0
+	heap.Init(&t.heap)
+}
+
+// reset drops every timer
+func (t *timers) reset() {
+	t.heap = nil
+	t.stale = 0
+}
+
+// len returns the number of timers, stale or not
+func (t *timers) len() int {
+	return len(t.heap)
+}
+
+// timerHeap implements heap.Interface, ordered by expiry
+type timerHeap []timer
+
+func (h timerHeap) Len() int {
+	return len(h)
+}
+
+func (h timerHeap) Less(i, j int) bool {
+	return h[i].expiry < h[j].expiry
+}
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *timerHeap) Push(x any) {
+	*h = append(*h, x.(timer))
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	n := len(old)
+	tm := old[n - 1]
+	old[n - 1] = timer{}
+	*h = old[:n - 1]
+
+	return tm
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Config defines the config for storage.
+type Config struct {
+	// Storage that will be instrumented
+	//
+	// Required. Default is nil
+	Storage storage.Storage
+
+	// Namespace label that the figures are recorded under, wrappers sharing a namespace share their figures
+	//
+	// Optional. Default is "default"
+	Namespace string
+
+	// Registry that the figures are reported through
+	//
+	// Optional. Default is DefaultRegistry
+	Registry *Registry
+
+	// Upper bounds of the latency histogram buckets
+	//
+	// Optional. Default is DefaultBuckets
+	Buckets []time.Duration
+
+	// Function used to measure the size of values for the byte counters
+	//
+	// Optional. Default counts the length of []byte and string values and the width of numeric values
+	Sizer func(value any) int
+}
+
+// DefaultBuckets are the default latency histogram buckets
+var DefaultBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Storage:	nil,
+	Namespace:	"default",
+	Registry:	nil,
+	Buckets:	DefaultBuckets,
+	Sizer:		size,
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		cfg := ConfigDefault
+		cfg.Registry = DefaultRegistry
+		return cfg
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.Namespace == "" {
+		cfg.Namespace = ConfigDefault.Namespace
+	}
+
+	if cfg.Registry == nil {
+		cfg.Registry = DefaultRegistry
+	}
+
+	if len(cfg.Buckets) < 1 {
+		cfg.Buckets = ConfigDefault.Buckets
+	}
+
+	if cfg.Sizer == nil {
+		cfg.Sizer = ConfigDefault.Sizer
+	}
+
+	return cfg
+}
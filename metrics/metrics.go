@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Storage interface that is implemented by storage providers
+type Storage struct {
+	db			storage.Storage
+	collector	*collector
+	sizer		func(value any) int
+}
+
+// New creates a new instrumented storage around Config.Storage
+func New(config ...Config) *Storage {
+	// Set default config
+	cfg := configDefault(config...)
+
+	if cfg.Storage == nil {
+		panic(errors.New("metrics: a Storage to wrap is required"))
+	}
+
+	// Create storage
+	return &Storage{
+		db:			cfg.Storage,
+		collector:	cfg.Registry.collector(cfg.Namespace, cfg.Buckets),
+		sizer:		cfg.Sizer,
+	}
+}
+
+// Get value by key
+func (s *Storage) Get(key string) *storage.Result {
+	start := time.Now()
+	result := s.db.Get(key)
+
+	op := s.collector.operations[opGet]
+	op.observe(time.Since(start), result.Error)
+	if result.Error == nil {
+		if result.Missed {
+			op.misses.Add(1)
+		} else {
+			op.hits.Add(1)
+			op.bytes.Add(uint64(s.sizer(result.Value)))
+		}
+	}
+
+	return result
+}
+
+// Set key with value
+func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
+	start := time.Now()
+	err := s.db.Set(key, value, expiry...)
+
+	op := s.collector.operations[opSet]
+	op.observe(time.Since(start), err)
+	if err == nil {
+		op.bytes.Add(uint64(s.sizer(value)))
+	}
+
+	return err
+}
+
+// Delete entries by key
+func (s *Storage) Delete(keys ...string) error {
+	start := time.Now()
+	err := s.db.Delete(keys...)
+
+	s.collector.operations[opDelete].observe(time.Since(start), err)
+
+	return err
+}
+
+// Reset all keys
+func (s *Storage) Reset() error {
+	start := time.Now()
+	err := s.db.Reset()
+
+	s.collector.operations[opReset].observe(time.Since(start), err)
+
+	return err
+}
+
+// Close the wrapped storage, the figures recorded so far remain in the registry
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+// Return the wrapped storage
+func (s *Storage) Conn() storage.Storage {
+	return s.db
+}
+
+// Stats returns a snapshot of the figures recorded for this storage's namespace
+func (s *Storage) Stats() Stats {
+	return s.collector.stats()
+}
+
+// size is the default Sizer
+func size(value any) int {
+	switch v := value.(type) {
+		case []byte:
+			return len(v)
+		case string:
+			return len(v)
+		case bool, int8, uint8:
+			return 1
+		case int16, uint16:
+			return 2
+		case int32, uint32, float32:
+			return 4
+		case int, int64, uint, uint64, float64:
+			return 8
+	}
+
+	return 0
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage/memory"
+)
+
+var (
+	testRegistry = NewRegistry()
+	testStore    = New(Config{
+		Storage:   memory.New(),
+		Namespace: "sessions",
+		Registry:  testRegistry,
+	})
+)
+
+func Test_Metrics_Get(t *testing.T) {
+	err := testStore.Set("john", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+
+	before := testStore.Stats().Operations["get"]
+
+	utils.AssertEqual(t, true, testStore.Get("john").Hit())
+	utils.AssertEqual(t, true, testStore.Get("notexist").Miss())
+	utils.AssertEqual(t, true, testStore.Get("").Err() != nil)
+
+	get := testStore.Stats().Operations["get"]
+	utils.AssertEqual(t, before.Calls + 3, get.Calls)
+	utils.AssertEqual(t, before.Hits + 1, get.Hits)
+	utils.AssertEqual(t, before.Misses + 1, get.Misses)
+	utils.AssertEqual(t, before.Errors + 1, get.Errors)
+	utils.AssertEqual(t, before.Bytes + 3, get.Bytes)
+	utils.AssertEqual(t, get.Calls, get.Latency.Count)
+	utils.AssertEqual(t, len(DefaultBuckets), len(get.Latency.Counts))
+}
+
+func Test_Metrics_Set(t *testing.T) {
+	before := testStore.Stats().Operations["set"]
+
+	err := testStore.Set("john", []byte("doe"), 0)
+	utils.AssertEqual(t, nil, err)
+
+	err = testStore.Set("", "doe", 0)
+	utils.AssertEqual(t, true, err != nil)
+
+	set := testStore.Stats().Operations["set"]
+	utils.AssertEqual(t, before.Calls + 2, set.Calls)
+	utils.AssertEqual(t, before.Errors + 1, set.Errors)
+	utils.AssertEqual(t, before.Bytes + 3, set.Bytes)
+}
+
+func Test_Metrics_Delete_Reset(t *testing.T) {
+	err := testStore.Delete("john")
+	utils.AssertEqual(t, nil, err)
+
+	err = testStore.Reset()
+	utils.AssertEqual(t, nil, err)
+
+	stats := testStore.Stats()
+	utils.AssertEqual(t, true, stats.Operations["delete"].Calls >= 1)
+	utils.AssertEqual(t, true, stats.Operations["reset"].Calls >= 1)
+}
+
+func Test_Metrics_HitRatio(t *testing.T) {
+	registry := NewRegistry()
+	store := New(Config{
+		Storage:  memory.New(),
+		Registry: registry,
+	})
+
+	utils.AssertEqual(t, float64(0), store.Stats().HitRatio())
+
+	_ = store.Set("john", "doe")
+	for i := 0; i < 3; i++ {
+		_ = store.Get("john")
+	}
+	_ = store.Get("notexist")
+
+	utils.AssertEqual(t, 0.75, store.Stats().HitRatio())
+	utils.AssertEqual(t, "default", registry.Stats()[0].Namespace)
+}
+
+func Test_Metrics_Shared_Namespace(t *testing.T) {
+	registry := NewRegistry()
+	store1 := New(Config{ Storage: memory.New(), Namespace: "shared", Registry: registry })
+	store2 := New(Config{ Storage: memory.New(), Namespace: "shared", Registry: registry })
+
+	_ = store1.Get("john")
+	_ = store2.Get("john")
+
+	utils.AssertEqual(t, 1, len(registry.Stats()))
+	utils.AssertEqual(t, uint64(2), store1.Stats().Operations["get"].Misses)
+}
+
+func Test_Metrics_Prometheus(t *testing.T) {
+	_ = testStore.Get("notexist")
+
+	var buf bytes.Buffer
+	err := testRegistry.WritePrometheus(&buf)
+	utils.AssertEqual(t, nil, err)
+
+	out := buf.String()
+	utils.AssertEqual(t, true, strings.Contains(out, "# TYPE storage_operations_total counter\n"))
+	utils.AssertEqual(t, true, strings.Contains(out, `storage_misses_total{namespace="sessions",operation="get"} `))
+	utils.AssertEqual(t, true, strings.Contains(out, `storage_operation_duration_seconds_bucket{namespace="sessions",operation="get",le="0.0001"} `))
+	utils.AssertEqual(t, true, strings.Contains(out, `storage_operation_duration_seconds_bucket{namespace="sessions",operation="get",le="+Inf"} `))
+	utils.AssertEqual(t, true, strings.Contains(out, `storage_operation_duration_seconds_count{namespace="sessions",operation="set"} `))
+}
+
+func Test_Metrics_Handler(t *testing.T) {
+	app := fiber.New()
+	app.Get("/metrics", testRegistry.Handler())
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get(fiber.HeaderContentType))
+
+	body, err := io.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, strings.Contains(string(body), `storage_hits_total{namespace="sessions",operation="get"} `))
+}
+
+func Test_Metrics_Expvar(t *testing.T) {
+	store := New(Config{
+		Storage:   memory.New(),
+		Namespace: "expvar",
+	})
+	_ = store.Get("notexist")
+
+	published := expvar.Get("storage")
+	utils.AssertEqual(t, true, published != nil)
+
+	var stats map[string]Stats
+	err := json.Unmarshal([]byte(published.String()), &stats)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, uint64(1), stats["expvar"].Operations["get"].Misses)
+}
+
+func Test_Metrics_Close(t *testing.T) {
+	utils.AssertEqual(t, nil, testStore.Close())
+}
+
+// go test -v -run=^$ -bench=Benchmark_Metrics -benchmem -count=4
+func Benchmark_Metrics(b *testing.B) {
+	store := New(Config{
+		Storage:  memory.New(),
+		Registry: NewRegistry(),
+	})
+	_ = store.Set("john", "doe")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		_ = store.Get("john")
+	}
+}
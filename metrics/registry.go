@@ -0,0 +1,281 @@
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Operations that are recorded, in the order in which they are reported
+const (
+	opGet = iota
+	opSet
+	opDelete
+	opReset
+	opCount
+)
+
+var opNames = [opCount]string{ "get", "set", "delete", "reset" }
+
+// Stats is a snapshot of the figures recorded for a namespace
+type Stats struct {
+	Namespace	string
+	Operations	map[string]OperationStats
+}
+
+// HitRatio returns the proportion of successful Get calls that were hits (0 when there have been none)
+func (s Stats) HitRatio() float64 {
+	get := s.Operations["get"]
+	if get.Hits + get.Misses == 0 {
+		return 0
+	}
+
+	return float64(get.Hits) / float64(get.Hits + get.Misses)
+}
+
+// OperationStats are the figures recorded for a single operation.
+// Hits, Misses and Bytes read are only recorded for get, Bytes written for set.
+type OperationStats struct {
+	Calls	uint64
+	Hits	uint64
+	Misses	uint64
+	Errors	uint64
+	Bytes	uint64
+	Latency	Histogram
+}
+
+// Histogram of operation latencies
+type Histogram struct {
+	// Upper bounds of the buckets
+	Buckets	[]time.Duration
+	// Cumulative number of calls that took at most the matching bucket's upper bound
+	Counts	[]uint64
+	// Total number of calls
+	Count	uint64
+	// Total time spent in all calls
+	Sum		time.Duration
+}
+
+// Registry collects the figures of any number of instrumented storages and reports them
+type Registry struct {
+	mux			sync.RWMutex
+	collectors	map[string]*collector
+}
+
+// DefaultRegistry is used by storages that are not given a Registry, it is published to expvar as "storage"
+var DefaultRegistry = NewRegistry()
+
+func init() {
+	DefaultRegistry.Publish("storage")
+}
+
+// NewRegistry creates a new empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: make(map[string]*collector),
+	}
+}
+
+// Stats returns a snapshot of every namespace, sorted by namespace
+func (r *Registry) Stats() []Stats {
+	r.mux.RLock()
+	stats := make([]Stats, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		stats = append(stats, c.stats())
+	}
+	r.mux.RUnlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Namespace < stats[j].Namespace
+	})
+
+	return stats
+}
+
+// Publish the registry's stats to expvar under the given name (this panics if the name is already in use)
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		stats := map[string]Stats{}
+		for _, s := range r.Stats() {
+			stats[s.Namespace] = s
+		}
+		return stats
+	}))
+}
+
+// WritePrometheus writes every namespace's figures in the Prometheus text exposition format
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	stats := r.Stats()
+	out := bufio.NewWriter(w)
+
+	counters := []struct {
+		name	string
+		help	string
+		value	func(OperationStats) uint64
+	}{
+		{ "storage_operations_total", "Storage operations.", func(o OperationStats) uint64 { return o.Calls } },
+		{ "storage_hits_total", "Storage reads that found a value.", func(o OperationStats) uint64 { return o.Hits } },
+		{ "storage_misses_total", "Storage reads that found no value.", func(o OperationStats) uint64 { return o.Misses } },
+		{ "storage_errors_total", "Storage operations that returned an error.", func(o OperationStats) uint64 { return o.Errors } },
+		{ "storage_bytes_total", "Bytes read by get and written by set.", func(o OperationStats) uint64 { return o.Bytes } },
+	}
+
+	for _, counter := range counters {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		for _, s := range stats {
+			for _, name := range opNames {
+				fmt.Fprintf(out, "%s{namespace=%s,operation=%q} %d\n", counter.name, label(s.Namespace), name, counter.value(s.Operations[name]))
+			}
+		}
+	}
+
+	const histogram = "storage_operation_duration_seconds"
+	fmt.Fprintf(out, "# HELP %s Storage operation latency.\n# TYPE %s histogram\n", histogram, histogram)
+	for _, s := range stats {
+		for _, name := range opNames {
+			latency := s.Operations[name].Latency
+			for i, bound := range latency.Buckets {
+				fmt.Fprintf(out, "%s_bucket{namespace=%s,operation=%q,le=\"%g\"} %d\n", histogram, label(s.Namespace), name, bound.Seconds(), latency.Counts[i])
+			}
+			fmt.Fprintf(out, "%s_bucket{namespace=%s,operation=%q,le=\"+Inf\"} %d\n", histogram, label(s.Namespace), name, latency.Count)
+			fmt.Fprintf(out, "%s_sum{namespace=%s,operation=%q} %g\n", histogram, label(s.Namespace), name, latency.Sum.Seconds())
+			fmt.Fprintf(out, "%s_count{namespace=%s,operation=%q} %d\n", histogram, label(s.Namespace), name, latency.Count)
+		}
+	}
+
+	return out.Flush()
+}
+
+// Handler returns a Fiber handler that serves the registry in the Prometheus text exposition format
+//
+//	app.Get("/metrics", metrics.DefaultRegistry.Handler())
+func (r *Registry) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		return r.WritePrometheus(c)
+	}
+}
+
+// HTTPHandler returns a net/http handler that serves the registry in the Prometheus text exposition format
+func (r *Registry) HTTPHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WritePrometheus(w)
+	})
+}
+
+// collector returns the collector for the namespace, creating it if required
+func (r *Registry) collector(namespace string, buckets []time.Duration) *collector {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if c, ok := r.collectors[namespace]; ok {
+		return c
+	}
+
+	c := &collector{
+		namespace:	namespace,
+		buckets:	append([]time.Duration{}, buckets...),
+	}
+	sort.Slice(c.buckets, func(i, j int) bool {
+		return c.buckets[i] < c.buckets[j]
+	})
+	for i := range c.operations {
+		c.operations[i] = &operation{
+			buckets:	c.buckets,
+			counts:		make([]atomic.Uint64, len(c.buckets)),
+		}
+	}
+
+	r.collectors[namespace] = c
+
+	return c
+}
+
+// collector holds the live figures of a namespace
+type collector struct {
+	namespace	string
+	buckets		[]time.Duration
+	operations	[opCount]*operation
+}
+
+// stats copies the live figures
+func (c *collector) stats() Stats {
+	stats := Stats{
+		Namespace:	c.namespace,
+		Operations:	make(map[string]OperationStats, opCount),
+	}
+
+	for i, op := range c.operations {
+		counts := make([]uint64, len(op.counts))
+		var cumulative uint64
+		for j := range op.counts {
+			cumulative += op.counts[j].Load()
+			counts[j] = cumulative
+		}
+
+		stats.Operations[opNames[i]] = OperationStats{
+			Calls:	op.calls.Load(),
+			Hits:	op.hits.Load(),
+			Misses:	op.misses.Load(),
+			Errors:	op.errors.Load(),
+			Bytes:	op.bytes.Load(),
+			Latency: Histogram{
+				Buckets:	c.buckets,
+				Counts:		counts,
+				Count:		op.calls.Load(),
+				Sum:		time.Duration(op.sum.Load()),
+			},
+		}
+	}
+
+	return stats
+}
+
+// operation holds the live figures of an operation within a namespace
+type operation struct {
+	calls	atomic.Uint64
+	hits	atomic.Uint64
+	misses	atomic.Uint64
+	errors	atomic.Uint64
+	bytes	atomic.Uint64
+	sum		atomic.Int64
+	buckets	[]time.Duration
+	// Non-cumulative, calls slower than the last bucket are only counted in calls
+	counts	[]atomic.Uint64
+}
+
+// observe records a call
+func (o *operation) observe(elapsed time.Duration, err error) {
+	if err != nil {
+		o.errors.Add(1)
+	}
+
+	o.sum.Add(int64(elapsed))
+
+	i := sort.Search(len(o.buckets), func(i int) bool {
+		return elapsed <= o.buckets[i]
+	})
+	if i < len(o.counts) {
+		o.counts[i].Add(1)
+	}
+
+	// Counted last so that a concurrent snapshot never sees more bucket entries than calls
+	o.calls.Add(1)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label quotes a label value
+func label(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// ContextStorage is an optional interface for storage providers that accept a context for each operation
+type ContextStorage interface {
+	Storage
+
+	// Get the value for the given key, see Storage.Get
+	GetContext(ctx context.Context, key string) *Result
+
+	// Set the value for the given key, see Storage.Set
+	SetContext(ctx context.Context, key string, val any, expiry ...time.Duration) error
+
+	// Deletes the values for the given keys, see Storage.Delete
+	DeleteContext(ctx context.Context, keys ...string) error
+
+	// Removes all keys for the specified namespace, see Storage.Reset
+	ResetContext(ctx context.Context) error
+}
+
+// Names of the operations passed through a middleware chain
+const (
+	OpGet		= "Get"
+	OpSet		= "Set"
+	OpDelete	= "Delete"
+	OpReset		= "Reset"
+	OpClose		= "Close"
+)
+
+// Op describes a single operation as it passes through a middleware chain.
+// Middleware may read or modify any field before calling the next handler, and may inspect or replace Result / Err afterwards.
+type Op struct {
+	// Name of the operation (OpGet, OpSet etc.)
+	Name string
+
+	// Context of the call, context.Background() when a method without a context was used
+	Context context.Context
+
+	// Keys of the operation (a single key for Get and Set, none for Reset and Close)
+	Keys []string
+
+	// Value being written by Set
+	Value any
+
+	// Expiry being applied by Set, 0 means no expiration
+	Expiry time.Duration
+
+	// Result of Get, filled in by the storage (or by middleware that short-circuits the call)
+	Result *Result
+
+	// Error returned to the caller
+	Err error
+}
+
+// Key returns the first key of the operation, or an empty string if there are none
+func (op *Op) Key() string {
+	if len(op.Keys) < 1 {
+		return ""
+	}
+
+	return op.Keys[0]
+}
+
+// Handler performs an operation, recording the outcome in Op.Result / Op.Err
+type Handler func(op *Op)
+
+// Middleware wraps a Handler. Calling next passes the operation on towards the storage, not calling it short-circuits the operation.
+type Middleware func(next Handler) Handler
+
+// Chained is a storage wrapped in middleware by Use
+type Chained interface {
+	ContextStorage
+
+	// Unwrap returns the wrapped storage
+	Unwrap() Storage
+}
+
+// Chain is a Storage that passes every operation through a list of middleware before it reaches the wrapped storage.
+// It implements ContextStorage whether or not the wrapped storage does, falling back to the plain methods when required.
+type Chain struct {
+	db		Storage
+	handler	Handler
+}
+
+// NotifyingChain is the Chain returned by Use for a storage that implements ExpiryNotifier, which it forwards
+type NotifyingChain struct {
+	*Chain
+}
+
+// Use wraps the storage with the given middleware, the first middleware is the outermost and sees each operation first.
+// The result is a *NotifyingChain when the storage implements ExpiryNotifier and a *Chain otherwise, so it only
+// implements ExpiryNotifier when expiries can be reported.
+func Use(s Storage, mw ...Middleware) Chained {
+	c := &Chain{ db: s }
+
+	c.handler = c.call
+	for i := len(mw) - 1; i >= 0; i-- {
+		c.handler = mw[i](c.handler)
+	}
+
+	if _, ok := s.(ExpiryNotifier); ok {
+		return &NotifyingChain{ Chain: c }
+	}
+
+	return c
+}
+
+// Get value by key
+func (c *Chain) Get(key string) *Result {
+	return c.GetContext(context.Background(), key)
+}
+
+// Get value by key
+func (c *Chain) GetContext(ctx context.Context, key string) *Result {
+	op := &Op{ Name: OpGet, Context: ctx, Keys: []string{ key } }
+	c.handler(op)
+
+	if op.Result == nil {
+		return &Result{ Value: nil, Error: op.Err, Missed: op.Err == nil }
+	}
+
+	if op.Err != nil && op.Result.Error == nil {
+		return &Result{ Value: nil, Error: op.Err, Missed: false }
+	}
+
+	return op.Result
+}
+
+// Set key with value
+func (c *Chain) Set(key string, value any, expiry ...time.Duration) error {
+	return c.SetContext(context.Background(), key, value, expiry...)
+}
+
+// Set key with value
+func (c *Chain) SetContext(ctx context.Context, key string, value any, expiry ...time.Duration) error {
+	var exp time.Duration = 0
+	if len(expiry) > 0 {
+		exp = expiry[0]
+	}
+
+	op := &Op{ Name: OpSet, Context: ctx, Keys: []string{ key }, Value: value, Expiry: exp }
+	c.handler(op)
+
+	return op.Err
+}
+
+// Delete entries by key
+func (c *Chain) Delete(keys ...string) error {
+	return c.DeleteContext(context.Background(), keys...)
+}
+
+// Delete entries by key
+func (c *Chain) DeleteContext(ctx context.Context, keys ...string) error {
+	// Copied so that middleware rewriting keys cannot modify the caller's slice
+	op := &Op{ Name: OpDelete, Context: ctx, Keys: append([]string{}, keys...) }
+	c.handler(op)
+
+	return op.Err
+}
+
+// Reset all keys
+func (c *Chain) Reset() error {
+	return c.ResetContext(context.Background())
+}
+
+// Reset all keys
+func (c *Chain) ResetContext(ctx context.Context) error {
+	op := &Op{ Name: OpReset, Context: ctx }
+	c.handler(op)
+
+	return op.Err
+}
+
+// Close the wrapped storage
+func (c *Chain) Close() error {
+	op := &Op{ Name: OpClose, Context: context.Background() }
+	c.handler(op)
+
+	return op.Err
+}
+
+// Return the wrapped storage
+func (c *Chain) Unwrap() Storage {
+	return c.db
+}
+
+// OnExpire subscribes fn to the wrapped storage's expiries. Expiries are not operations so they do not pass through the
+// middleware, keys are reported as the wrapped storage holds them.
+func (c *NotifyingChain) OnExpire(fn func(key string, value any)) (cancel func()) {
+	return c.db.(ExpiryNotifier).OnExpire(fn)
+}
+
+// call is the final handler, it performs the operation on the wrapped storage
+func (c *Chain) call(op *Op) {
+	cs, hasContext := c.db.(ContextStorage)
+
+	if op.Context == nil {
+		op.Context = context.Background()
+	}
+
+	// Storages without context support cannot be interrupted, but should not be started once the context is done
+	if !hasContext && op.Name != OpClose {
+		if err := op.Context.Err(); err != nil {
+			op.Err = err
+			return
+		}
+	}
+
+	switch op.Name {
+		case OpGet:
+			if hasContext {
+				op.Result = cs.GetContext(op.Context, op.Key())
+			} else {
+				op.Result = c.db.Get(op.Key())
+			}
+			op.Err = op.Result.Error
+		case OpSet:
+			if hasContext {
+				op.Err = cs.SetContext(op.Context, op.Key(), op.Value, op.Expiry)
+			} else {
+				op.Err = c.db.Set(op.Key(), op.Value, op.Expiry)
+			}
+		case OpDelete:
+			if hasContext {
+				op.Err = cs.DeleteContext(op.Context, op.Keys...)
+			} else {
+				op.Err = c.db.Delete(op.Keys...)
+			}
+		case OpReset:
+			if hasContext {
+				op.Err = cs.ResetContext(op.Context)
+			} else {
+				op.Err = c.db.Reset()
+			}
+		case OpClose:
+			op.Err = c.db.Close()
+	}
+}
@@ -0,0 +1,252 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+// testStorage is a minimal map backed Storage (the drivers cannot be imported from here)
+type testStorage struct {
+	mux	sync.Mutex
+	db	map[string]any
+}
+
+// notifyingStorage is a testStorage that reports expiries
+type notifyingStorage struct {
+	*testStorage
+	notifier
+}
+
+func newTestStorage() *testStorage {
+	return &testStorage{ db: make(map[string]any) }
+}
+
+func (s *testStorage) Get(key string) *Result {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	v, ok := s.db[key]
+	return &Result{ Value: v, Error: nil, Missed: !ok }
+}
+
+func (s *testStorage) Set(key string, value any, expiry ...time.Duration) error {
+	if len(key) <= 0 {
+		return errors.New("storage keys cannot be zero length")
+	}
+
+	s.mux.Lock()
+	s.db[key] = value
+	s.mux.Unlock()
+
+	return nil
+}
+
+func (s *testStorage) Delete(keys ...string) error {
+	s.mux.Lock()
+	for _, key := range keys {
+		delete(s.db, key)
+	}
+	s.mux.Unlock()
+
+	return nil
+}
+
+func (s *testStorage) Reset() error {
+	s.mux.Lock()
+	s.db = make(map[string]any)
+	s.mux.Unlock()
+
+	return nil
+}
+
+func (s *testStorage) Close() error {
+	return nil
+}
+
+func Test_Middleware_Order(t *testing.T) {
+	var calls []string
+
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(op *Op) {
+				calls = append(calls, name + ":" + op.Name)
+				next(op)
+				calls = append(calls, name + ":done")
+			}
+		}
+	}
+
+	store := Use(newTestStorage(), record("outer"), record("inner"))
+
+	err := store.Set("john", "doe")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, []string{ "outer:Set", "inner:Set", "inner:done", "outer:done" }, calls)
+}
+
+func Test_Middleware_Observe(t *testing.T) {
+	var ops []Op
+
+	observe := func(next Handler) Handler {
+		return func(op *Op) {
+			next(op)
+			ops = append(ops, *op)
+		}
+	}
+
+	store := Use(newTestStorage(), observe)
+
+	_ = store.Set("john", "doe", time.Minute)
+	_ = store.Get("john")
+	_ = store.Get("notexist")
+	_ = store.Delete("john", "jane")
+	_ = store.Reset()
+	_ = store.Close()
+
+	utils.AssertEqual(t, 6, len(ops))
+	utils.AssertEqual(t, OpSet, ops[0].Name)
+	utils.AssertEqual(t, "doe", ops[0].Value)
+	utils.AssertEqual(t, time.Minute, ops[0].Expiry)
+	utils.AssertEqual(t, true, ops[1].Result.Hit())
+	utils.AssertEqual(t, true, ops[2].Result.Miss())
+	utils.AssertEqual(t, []string{ "john", "jane" }, ops[3].Keys)
+	utils.AssertEqual(t, OpReset, ops[4].Name)
+	utils.AssertEqual(t, OpClose, ops[5].Name)
+}
+
+func Test_Middleware_Modify(t *testing.T) {
+	backend := newTestStorage()
+
+	prefix := func(next Handler) Handler {
+		return func(op *Op) {
+			for i := range op.Keys {
+				op.Keys[i] = "tenant:" + op.Keys[i]
+			}
+			if s, ok := op.Value.(string); ok {
+				op.Value = strings.ToUpper(s)
+			}
+			next(op)
+		}
+	}
+
+	store := Use(backend, prefix)
+
+	err := store.Set("john", "doe")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "DOE", backend.Get("tenant:john").Val())
+	utils.AssertEqual(t, true, backend.Get("john").Miss())
+
+	str, err, _ := store.Get("john").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "DOE", str)
+
+	// The caller's keys are left untouched
+	keys := []string{ "john" }
+	err = store.Delete(keys...)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "john", keys[0])
+	utils.AssertEqual(t, true, backend.Get("tenant:john").Miss())
+}
+
+func Test_Middleware_Short_Circuit(t *testing.T) {
+	backend := newTestStorage()
+	denied := errors.New("access denied")
+
+	deny := func(next Handler) Handler {
+		return func(op *Op) {
+			if strings.HasPrefix(op.Key(), "admin:") {
+				op.Err = denied
+				return
+			}
+			if op.Name == OpGet && op.Key() == "static" {
+				op.Result = &Result{ Value: "cached", Error: nil, Missed: false }
+				return
+			}
+			next(op)
+		}
+	}
+
+	store := Use(backend, deny)
+
+	err := store.Set("admin:john", "doe")
+	utils.AssertEqual(t, denied, err)
+	utils.AssertEqual(t, 0, len(backend.db))
+
+	result := store.Get("admin:john")
+	utils.AssertEqual(t, denied, result.Err())
+	utils.AssertEqual(t, false, result.Miss())
+
+	str, err, _ := store.Get("static").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "cached", str)
+}
+
+func Test_Middleware_Context(t *testing.T) {
+	type ctxKey struct{}
+
+	var seen any
+	capture := func(next Handler) Handler {
+		return func(op *Op) {
+			seen = op.Context.Value(ctxKey{})
+			next(op)
+		}
+	}
+
+	store := Use(newTestStorage(), capture)
+
+	// A Chain always provides the optional context methods
+	var cs ContextStorage = store
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request-1")
+	err := cs.SetContext(ctx, "john", "doe")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "request-1", seen)
+
+	// The wrapped storage has no context support, so a cancelled context stops the call before it starts
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := cs.GetContext(cancelled, "john")
+	utils.AssertEqual(t, context.Canceled, result.Err())
+
+	err = cs.DeleteContext(cancelled, "john")
+	utils.AssertEqual(t, context.Canceled, err)
+
+	utils.AssertEqual(t, true, cs.Get("john").Hit())
+}
+
+func Test_Middleware_None(t *testing.T) {
+	backend := newTestStorage()
+	store := Use(backend)
+
+	err := store.Set("john", "doe")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "doe", store.Get("john").Val())
+	utils.AssertEqual(t, Storage(backend), store.Unwrap())
+	utils.AssertEqual(t, true, store.Set("", "doe") != nil)
+}
+
+func Test_Middleware_OnExpire(t *testing.T) {
+	// Chains only implement ExpiryNotifier when the wrapped storage can report expiries
+	_, ok := Use(newTestStorage()).(ExpiryNotifier)
+	utils.AssertEqual(t, false, ok)
+
+	backend := &notifyingStorage{ testStorage: newTestStorage() }
+	chain, ok := Use(backend).(ExpiryNotifier)
+	utils.AssertEqual(t, true, ok)
+
+	var got []string
+	cancel := chain.OnExpire(func(key string, value any) {
+		got = append(got, key)
+	})
+
+	backend.Notify("john", "doe")
+	cancel()
+	backend.Notify("jane", "doe")
+	utils.AssertEqual(t, []string{ "john" }, got)
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"sync"
+)
+
+// ExpiryNotifier is an optional interface for storage providers that report entries removed because their expiry passed
+type ExpiryNotifier interface {
+	// OnExpire calls fn for every entry that expires until the returned cancel function is called.
+	// The value is nil when the storage cannot recover it, see each driver for when fn is called and how reliably.
+	OnExpire(fn func(key string, value any)) (cancel func())
+}
+
+// ExpiryEvent is an entry removed because its expiry passed
+type ExpiryEvent struct {
+	Key		string
+	Value	any
+}
+
+// ExpiryEvents subscribes to n and delivers its expired entries on a channel with the given buffer.
+// Delivery waits for room in the buffer, so a slow reader delays the storage's expiry work rather than losing events.
+// The channel is closed once cancel has been called.
+func ExpiryEvents(n ExpiryNotifier, buffer int) (events <-chan ExpiryEvent, cancel func()) {
+	ch := make(chan ExpiryEvent, buffer)
+	done := make(chan struct{})
+	var mux sync.RWMutex
+	closed := false
+
+	unsubscribe := n.OnExpire(func(key string, value any) {
+		mux.RLock()
+		defer mux.RUnlock()
+
+		if closed {
+			return
+		}
+
+		select {
+			case ch <- ExpiryEvent{ Key: key, Value: value }:
+			case <-done:
+		}
+	})
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			unsubscribe()
+
+			// Release any sender waiting for room before closing the channel
+			close(done)
+
+			mux.Lock()
+			closed = true
+			close(ch)
+			mux.Unlock()
+		})
+	}
+
+	return ch, cancel
+}
+
+// ExpirySubscribers is a set of OnExpire callbacks, drivers use it to implement ExpiryNotifier.
+// The zero value is ready to use.
+type ExpirySubscribers struct {
+	mux		sync.RWMutex
+	next	int
+	fns		map[int]func(key string, value any)
+}
+
+// Add subscribes fn until the returned function is called
+func (s *ExpirySubscribers) Add(fn func(key string, value any)) (cancel func()) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.fns == nil {
+		s.fns = make(map[int]func(key string, value any))
+	}
+
+	id := s.next
+	s.next++
+	s.fns[id] = fn
+
+	return func() {
+		s.mux.Lock()
+		defer s.mux.Unlock()
+
+		delete(s.fns, id)
+	}
+}
+
+// Len returns the number of subscribers, drivers can skip the work of recovering expired entries when it is 0
+func (s *ExpirySubscribers) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	return len(s.fns)
+}
+
+// Notify calls every subscriber with the expired entry, it must be called without holding any of the storage's locks
+func (s *ExpirySubscribers) Notify(key string, value any) {
+	s.mux.RLock()
+	fns := make([]func(key string, value any), 0, len(s.fns))
+	for _, fn := range s.fns {
+		fns = append(fns, fn)
+	}
+	s.mux.RUnlock()
+
+	for _, fn := range fns {
+		fn(key, value)
+	}
+}
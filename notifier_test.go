@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+// notifier is the smallest ExpiryNotifier, as a driver would implement it
+type notifier struct {
+	ExpirySubscribers
+}
+
+func (n *notifier) OnExpire(fn func(key string, value any)) func() {
+	return n.Add(fn)
+}
+
+func Test_ExpirySubscribers(t *testing.T) {
+	n := &notifier{}
+	utils.AssertEqual(t, 0, n.Len())
+
+	var got []string
+	cancel := n.OnExpire(func(key string, value any) {
+		got = append(got, key + "=" + value.(string))
+	})
+	utils.AssertEqual(t, 1, n.Len())
+
+	n.Notify("john", "doe")
+	utils.AssertEqual(t, []string{ "john=doe" }, got)
+
+	cancel()
+	cancel()
+	utils.AssertEqual(t, 0, n.Len())
+
+	n.Notify("jane", "doe")
+	utils.AssertEqual(t, []string{ "john=doe" }, got)
+}
+
+func Test_ExpiryEvents(t *testing.T) {
+	n := &notifier{}
+	events, cancel := ExpiryEvents(n, 1)
+
+	n.Notify("john", "doe")
+	utils.AssertEqual(t, ExpiryEvent{ Key: "john", Value: "doe" }, <-events)
+
+	// A sender waiting for room is released by cancel
+	n.Notify("jane", "doe")
+	sent := make(chan struct{})
+	go func() {
+		n.Notify("jim", "doe")
+		close(sent)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-sent
+	utils.AssertEqual(t, 0, n.Len())
+
+	// Buffered events can still be read before the channel reports that it is closed
+	utils.AssertEqual(t, "jane", (<-events).Key)
+	_, open := <-events
+	utils.AssertEqual(t, false, open)
+}
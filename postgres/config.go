@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/paul-norman/go-fiber-storage"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -71,6 +72,17 @@ type Config struct {
 	// Optional. Default is ""
 	Namespace string
 
+	// Logger for failures that happen in the background: garbage collection errors, expired values that cannot be
+	// decoded and a `value` column that is not a BYTEA
+	//
+	// Optional. Default is storage.DefaultLogger
+	Logger storage.Logger
+
+	// Clock used for expiry and garbage collection, a clocktest.Fake lets tests expire keys without waiting
+	//
+	// Optional. Default is storage.SystemClock
+	Clock storage.Clock
+
 	////////////////////////////////////
 	// Adaptor related config options //
 	////////////////////////////////////
@@ -106,6 +118,8 @@ var ConfigDefault = Config{
 	MaxIdleConns:		100,
 	ConnMaxLifetime:	1 * time.Second,
 	Namespace:			"",
+	Logger:				storage.DefaultLogger,
+	Clock:				storage.SystemClock,
 }
 
 func (c *Config) getDSN() string {
@@ -167,7 +181,7 @@ func configDefault(config ...Config) Config {
 		cfg.Table = ConfigDefault.Table
 	}
 
-	if int(cfg.GCInterval.Seconds()) <= 0 {
+	if cfg.GCInterval <= 0 {
 		cfg.GCInterval = ConfigDefault.GCInterval
 	}
 
@@ -183,5 +197,13 @@ func configDefault(config ...Config) Config {
 		cfg.ConnMaxLifetime = ConfigDefault.ConnMaxLifetime
 	}
 
+	if cfg.Logger == nil {
+		cfg.Logger = ConfigDefault.Logger
+	}
+
+	if cfg.Clock == nil {
+		cfg.Clock = ConfigDefault.Clock
+	}
+
 	return cfg
 }
\ No newline at end of file
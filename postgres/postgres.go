@@ -1,6 +1,8 @@
 package postgres
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
@@ -15,15 +17,18 @@ import (
 // Storage interface that is implemented by storage providers
 type Storage struct {
 	db			*sqlx.DB
-	gcInterval	time.Duration
+	clock		storage.Clock
 	done		chan struct{}
 	namespace	string
+	logger		storage.Logger
+	expiries	storage.ExpirySubscribers
 
 	sqlSelect	string
 	sqlInsert	string
 	sqlDelete	string
 	sqlReset	string
 	sqlGC		string
+	sqlGCReturning	string
 }
 
 type Store struct {
@@ -47,6 +52,9 @@ var (
 		`CREATE INDEX IF NOT EXISTS namespace ON %s (namespace);`,
 		`CREATE INDEX IF NOT EXISTS expiry ON %s (expiry);`,
 	}
+	// Expiries were stored in seconds before millisecond precision, no millisecond timestamp is this small
+	migrateCheckQuery = "SELECT 1 FROM %s WHERE namespace = $1 AND expiry > 0 AND expiry < 100000000000 LIMIT 1;"
+	migrateQuery = "UPDATE %s SET expiry = expiry * 1000 WHERE namespace = $1 AND expiry > 0 AND expiry < 100000000000;"
 	checkSchemaQuery = `SELECT DATA_TYPE FROM INFORMATION_SCHEMA.COLUMNS
 		WHERE table_name = '%s' AND COLUMN_NAME = 'value';`
 )
@@ -92,75 +100,97 @@ func New(config ...Config) *Storage {
 		}
 	}
 
+	// Convert any expiries in the namespace stored in seconds to milliseconds
+	if err := migrate(db, cfg.Table, cfg.Namespace); err != nil {
+		db.Close()
+		panic(err)
+	}
+
 	// Create storage
 	store := &Storage{
 		db:			db,
-		gcInterval:	cfg.GCInterval,
+		clock:		cfg.Clock,
 		done:		make(chan struct{}),
 		namespace:	cfg.Namespace,
+		logger:		cfg.Logger,
 		sqlSelect:	fmt.Sprintf(`SELECT key, value, expiry FROM %s WHERE key = $1 AND namespace = $2`, cfg.Table),
 		sqlInsert:	fmt.Sprintf("INSERT INTO %s (key, value, expiry, namespace) VALUES ($1, $2, $3, $4) ON CONFLICT (key) DO UPDATE SET value = $5, expiry = $6", cfg.Table),
 		sqlDelete:	fmt.Sprintf("DELETE FROM %s WHERE namespace = ? AND key IN (?)", cfg.Table),
 		sqlReset:	fmt.Sprintf("DELETE FROM %s WHERE namespace = $1", cfg.Table),
 		sqlGC:		fmt.Sprintf("DELETE FROM %s WHERE namespace = $1 AND expiry <= $2 AND expiry != 0", cfg.Table),
+		sqlGCReturning:	fmt.Sprintf("DELETE FROM %s WHERE namespace = $1 AND expiry <= $2 AND expiry != 0 RETURNING key, value", cfg.Table),
 	}
 
 	store.checkSchema(cfg.Table)
 
-	// Start garbage collector
-	go store.gcTicker()
+	// Start garbage collector, the ticker is created first so that a fake clock can be advanced straight away
+	go store.gcTicker(cfg.Clock.NewTicker(cfg.GCInterval))
 
 	return store
 }
 
 // Get value by key
 func (s *Storage) Get(key string) *storage.Result {
+	return s.GetContext(context.Background(), key)
+}
+
+// Get value by key
+func (s *Storage) GetContext(ctx context.Context, key string) *storage.Result {
 	if len(key) <= 0 {
 		return &storage.Result{ Value: nil, Error: errors.New("storage keys cannot be zero length"), Missed: false }
 	}
 
 	var store Store
-	if err := s.db.Get(&store, s.sqlSelect, key, s.namespace); err != nil {
+	if err := s.db.GetContext(ctx, &store, s.sqlSelect, key, s.namespace); err == sql.ErrNoRows {
+		return &storage.Result{ Value: nil, Error: nil, Missed: true }
+	} else if err != nil {
 		return &storage.Result{ Value: nil, Error: err, Missed: false }
 	}
-	if len(store.Key) == 0 || (store.Expiry != 0 && store.Expiry <= time.Now().Unix()) {
+	if len(store.Key) == 0 || (store.Expiry != 0 && store.Expiry <= s.clock.Now().UnixMilli()) {
 		return &storage.Result{ Value: nil, Error: nil, Missed: true }
 	}
 
-	var decoded interface{}
-	err := json.Unmarshal(store.Value, &decoded)
+	decoded, err := decode(store.Value)
 
 	return &storage.Result{ Value: decoded, Error: err, Missed: false }
 }
 
 // Set key with value
 func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
+	return s.SetContext(context.Background(), key, value, expiry...)
+}
+
+// Set key with value
+func (s *Storage) SetContext(ctx context.Context, key string, value any, expiry ...time.Duration) error {
 	if len(key) <= 0 {
 		return errors.New("storage keys cannot be zero length")
 	}
 
-	var exp time.Duration = 0
-	if len(expiry) > 0 {
-		exp = expiry[0]
+	exp, err := storage.Expiry(expiry...)
+	if err != nil {
+		return err
 	}
 
-	expSeconds := int64(0)
-	if exp != 0 {
-		expSeconds = time.Now().Add(exp).Unix()
-	}
+	// Stored as unix milliseconds so that sub-second expiries are honoured
+	expMillis := storage.ExpiresAt(s.clock.Now(), exp)
 
 	val, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.db.Exec(s.sqlInsert, key, val, expSeconds, s.namespace, val, expSeconds)
+	_, err = s.db.ExecContext(ctx, s.sqlInsert, key, val, expMillis, s.namespace, val, expMillis)
 
 	return err
 }
 
 // Delete entries by key
 func (s *Storage) Delete(keys ...string) error {
+	return s.DeleteContext(context.Background(), keys...)
+}
+
+// Delete entries by key
+func (s *Storage) DeleteContext(ctx context.Context, keys ...string) error {
 	if len(keys) <= 0 {
 		return errors.New("at least one key is required for Delete")
 	}
@@ -177,14 +207,19 @@ func (s *Storage) Delete(keys ...string) error {
 	}
 
 	query = s.db.Rebind(query)
-	_, err = s.db.Exec(query, args...)
+	_, err = s.db.ExecContext(ctx, query, args...)
 
 	return err
 }
 
 // Reset all entries in the namespace
 func (s *Storage) Reset() error {
-	_, err := s.db.Exec(s.sqlReset, s.namespace)
+	return s.ResetContext(context.Background())
+}
+
+// Reset all entries in the namespace
+func (s *Storage) ResetContext(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.sqlReset, s.namespace)
 
 	return err
 }
@@ -201,24 +236,56 @@ func (s *Storage) Conn() *sqlx.DB {
 	return s.db
 }
 
-// gcTicker starts the gc ticker
-func (s *Storage) gcTicker() {
-	ticker := time.NewTicker(s.gcInterval)
+// gcTicker runs gc on every tick
+func (s *Storage) gcTicker(ticker storage.Ticker) {
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-s.done:
 			return
-		case t := <-ticker.C:
+		case t := <-ticker.C():
 			s.gc(t)
 		}
 	}
 }
 
-// gc deletes all expired entries
+// gc deletes all expired entries, returning them when there are OnExpire subscribers
 func (s *Storage) gc(t time.Time) {
-	_, _ = s.db.Exec(s.sqlGC, s.namespace, t.Unix())
+	if s.expiries.Len() == 0 {
+		if _, err := s.db.Exec(s.sqlGC, s.namespace, t.UnixMilli()); err != nil {
+			s.logger.Error("storage gc failed", "driver", "postgres", "namespace", s.namespace, "error", err)
+		}
+		return
+	}
+
+	// Each row is only returned to the garbage collector that deleted it, so concurrent garbage collectors report each entry once
+	var expired []Store
+	if err := s.db.Select(&expired, s.sqlGCReturning, s.namespace, t.UnixMilli()); err != nil {
+		s.logger.Error("storage gc failed", "driver", "postgres", "namespace", s.namespace, "error", err)
+		return
+	}
+
+	s.notifyExpired(expired)
+}
+
+// notifyExpired passes the entries removed by gc to the OnExpire subscribers
+func (s *Storage) notifyExpired(expired []Store) {
+	for _, e := range expired {
+		value, err := decode(e.Value)
+		if err != nil {
+			s.logger.Warn("storage could not decode an expired value", "driver", "postgres", "namespace", s.namespace, "key", e.Key, "error", err)
+		}
+
+		s.expiries.Notify(e.Key, value)
+	}
+}
+
+// OnExpire calls fn with every entry in this namespace that the garbage collector removes because its expiry passed,
+// until cancel is called. Entries are reported once, up to GCInterval after they expire, by the storage that removed them,
+// so every storage sharing the table should subscribe. Entries removed while there are no subscribers are not reported.
+func (s *Storage) OnExpire(fn func(key string, value any)) (cancel func()) {
+	return s.expiries.Add(fn)
 }
 
 func (s *Storage) checkSchema(tableName string) {
@@ -230,6 +297,30 @@ func (s *Storage) checkSchema(tableName string) {
 	}
 
 	if strings.ToLower(string(data)) != "bytea" {
-		fmt.Printf(checkSchemaMsg, string(data))
+		s.logger.Warn(fmt.Sprintf(checkSchemaMsg, string(data)), "driver", "postgres", "table", tableName)
 	}
-}
\ No newline at end of file
+}
+
+// migrate converts the expiries of a namespace that earlier versions stored in seconds to milliseconds.
+// The rows are checked first, so the update (and its locks) only happens while there are rows left to convert.
+func migrate(db *sqlx.DB, table string, namespace string) error {
+	var found int
+	err := db.QueryRow(fmt.Sprintf(migrateCheckQuery, table), namespace).Scan(&found)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf(migrateQuery, table), namespace)
+
+	return err
+}
+
+// decode restores a value written by Set
+func decode(data []byte) (any, error) {
+	var decoded any
+	err := json.Unmarshal(data, &decoded)
+
+	return decoded, err
+}
@@ -1,13 +1,16 @@
 package postgres
 
 import (
-	"context"
+	"database/sql"
+	"encoding/base64"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/gofiber/utils"
-	"github.com/jmoiron/sqlx"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/clocktest"
+	"github.com/paul-norman/go-fiber-storage/storagetest"
 )
 
 var testStore = New(Config{
@@ -17,136 +20,96 @@ var testStore = New(Config{
 	Reset:    true,
 })
 
-func Test_Postgres_Set(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-}
-
-func Test_Postgres_Set_Override(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	err = testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-}
-
-func Test_Postgres_Get(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, val, result)
-}
-
-func Test_Postgres_Set_Expiration(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-		exp = 1 * time.Second
-	)
-
-	err := testStore.Set(key, val, exp)
-	utils.AssertEqual(t, nil, err)
-
-	time.Sleep(1100 * time.Millisecond)
-}
-
-func Test_Postgres_Get_Expired(t *testing.T) {
-	var (
-		key = "john"
-	)
-
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
-}
-
-func Test_Postgres_Get_NotExist(t *testing.T) {
-
-	result, err := testStore.Get("notexist")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
-}
-
-func Test_Postgres_Delete(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	err = testStore.Delete(key)
-	utils.AssertEqual(t, nil, err)
-
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+func Test_Postgres_Conformance(t *testing.T) {
+	// Expiry is checked against the fake clock, so the tests do not wait
+	clock := clocktest.NewFake()
+
+	storagetest.Run(t, func() storage.Storage {
+		return New(Config{
+			Database:	os.Getenv("POSTGRES_DATABASE"),
+			Username:	os.Getenv("POSTGRES_USERNAME"),
+			Password:	os.Getenv("POSTGRES_PASSWORD"),
+			Table:		"fiber_storage_conformance",
+			Reset:		true,
+			Clock:		clock,
+		})
+	}, storagetest.Config{
+		Namespaced: func(namespace string) storage.Storage {
+			return New(Config{
+				Database:	os.Getenv("POSTGRES_DATABASE"),
+				Username:	os.Getenv("POSTGRES_USERNAME"),
+				Password:	os.Getenv("POSTGRES_PASSWORD"),
+				Table:		"fiber_storage_conformance",
+				Namespace:	namespace,
+			})
+		},
+		Advance:	clock.Advance,
+		// Values are stored as JSON, which returns []byte values as base64 strings and slices as []any
+		Skip:		map[string]string{
+			"Types/Bytes":			"[]byte values are returned as base64 strings",
+			"Types/BoolSlice":		"slices are returned as []any",
+			"Types/IntSlice":		"slices are returned as []any",
+			"Types/Int64Slice":		"slices are returned as []any",
+			"Types/Uint64Slice":	"slices are returned as []any",
+			"Types/Float32Slice":	"slices are returned as []any",
+			"Types/Float64Slice":	"slices are returned as []any",
+			"Types/StringSlice":	"slices are returned as []any",
+		},
+	})
 }
 
-func Test_Postgres_Reset(t *testing.T) {
-	var (
-		val = []byte("doe")
-	)
-
-	err := testStore.Set("john1", val, 0)
-	utils.AssertEqual(t, nil, err)
+func Test_Postgres_OnExpire(t *testing.T) {
+	var _ storage.ExpiryNotifier = &Storage{}
+
+	clock := clocktest.NewFake()
+	store := New(Config{
+		Database:	os.Getenv("POSTGRES_DATABASE"),
+		Username:	os.Getenv("POSTGRES_USERNAME"),
+		Password:	os.Getenv("POSTGRES_PASSWORD"),
+		Table:		"fiber_storage_expire",
+		Reset:		true,
+		GCInterval:	time.Second,
+		Clock:		clock,
+	})
+	defer store.Close()
 
-	err = testStore.Set("john2", val, 0)
-	utils.AssertEqual(t, nil, err)
+	events, cancel := storage.ExpiryEvents(store, 10)
+	defer cancel()
 
-	err = testStore.Reset()
-	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, nil, store.Set("john", "doe", time.Second))
+	utils.AssertEqual(t, nil, store.Set("jim", "doe"))
 
-	result, err := testStore.Get("john1")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, storage.ExpiryEvent{ Key: "john", Value: "doe" }, <-events)
 
-	result, err = testStore.Get("john2")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	// The next tick is only taken once that garbage collection has finished
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, 0, len(events))
+	utils.AssertEqual(t, true, store.Get("jim").Hit())
 }
 
 func Test_Postgres_GC(t *testing.T) {
 	var (
-		testVal = []byte("doe")
+		testVal = "doe"
 	)
 
 	// This key should expire
-	err := testStore.Set("john", testVal, time.Nanosecond)
+	err := testStore.Set("john", testVal, time.Millisecond)
 	utils.AssertEqual(t, nil, err)
 
-	testStore.gc(time.Now())
-	row := testStore.db.QueryRow(context.Background(), testStore.sqlSelect, "john")
-	err = row.Scan(nil, nil)
-	utils.AssertEqual(t, sqlx.ErrNoRows, err)
+	testStore.gc(time.Now().Add(time.Millisecond))
+	row := testStore.db.QueryRow(testStore.sqlSelect, "john", testStore.namespace)
+	err = row.Scan(nil, nil, nil)
+	utils.AssertEqual(t, sql.ErrNoRows, err)
 
 	// This key should not expire
 	err = testStore.Set("john", testVal, 0)
 	utils.AssertEqual(t, nil, err)
 
 	testStore.gc(time.Now())
-	val, err := testStore.Get("john")
+	val, err, _ := testStore.Get("john").String()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, testVal, val)
-
 }
 
 func Test_Postgres_Non_UTF8(t *testing.T) {
@@ -155,9 +118,10 @@ func Test_Postgres_Non_UTF8(t *testing.T) {
 	err := testStore.Set("0xF6", val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStore.Get("0xF6")
+	// Values are stored as JSON, which encodes []byte values as base64
+	result, err, _ := testStore.Get("0xF6").Bytes()
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, val, result)
+	utils.AssertEqual(t, []byte(base64.StdEncoding.EncodeToString(val)), result)
 }
 
 func Test_SslRequiredMode(t *testing.T) {
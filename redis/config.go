@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"runtime"
 
+	"github.com/paul-norman/go-fiber-storage"
 	redis "github.com/redis/go-redis/v9"
 )
 
@@ -56,6 +57,12 @@ type Config struct {
 	// Optional. Default is ""
 	Namespace string
 
+	// Logger for failures that happen in the background: failed reconnects, and expiry notifications that cannot be
+	// subscribed to or enabled on the server
+	//
+	// Optional. Default is storage.DefaultLogger
+	Logger storage.Logger
+
 	// Reset clears any existing keys in existing Collection
 	//
 	// Optional. Default is false
@@ -81,6 +88,7 @@ var ConfigDefault = Config{
 	Addresses:		[]string{},
 	Database:		0,
 	Namespace:		"",
+	Logger:			storage.DefaultLogger,
 	Reset:			false,
 	TLSConfig:		nil,
 	PoolSize:		10 * runtime.GOMAXPROCS(0),
@@ -98,7 +106,7 @@ func (c *Config) getUniversalOptions() *redis.UniversalOptions {
 		c.Password	= options.Password
 		c.Database	= options.DB
 		c.Addresses	= []string{ options.Addr }
-	} else if len(c.Addresses) > 0 {
+	} else if len(c.Addresses) == 0 {
 		// Fallback to Host and Port values if Addrs is empty
 		c.Addresses = []string{ fmt.Sprintf("%s:%d", c.Host, c.Port) }
 	}
@@ -140,5 +148,9 @@ func configDefault(config ...Config) Config {
 		cfg.PoolSize = ConfigDefault.PoolSize
 	}
 
+	if cfg.Logger == nil {
+		cfg.Logger = ConfigDefault.Logger
+	}
+
 	return cfg
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ go 1.19
 
 require (
 	github.com/gofiber/utils v1.1.0
+	github.com/google/uuid v1.3.0
 	github.com/redis/go-redis/v9 v9.0.5
 )
 
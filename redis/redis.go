@@ -3,9 +3,13 @@ package redis
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/paul-norman/go-fiber-storage"
 	redis "github.com/redis/go-redis/v9"
 )
@@ -14,6 +18,13 @@ import (
 type Storage struct {
 	db redis.UniversalClient
 	namespace string
+	logger storage.Logger
+	database int
+	expiries storage.ExpirySubscribers
+
+	// Subscription to expired key notifications, only open while there are OnExpire subscribers
+	mux sync.Mutex
+	pubsub *redis.PubSub
 }
 
 // New creates a new redis storage
@@ -24,7 +35,8 @@ func New(config ...Config) *Storage {
 	// Create new redis universal client
 	db := cfg.DB
 	if db == nil {
-		db = redis.NewUniversalClient(cfg.getUniversalOptions())		
+		db = redis.NewUniversalClient(cfg.getUniversalOptions())
+		db.AddHook(&reconnectHook{ logger: cfg.Logger })
 	}
 
 	// Test connection
@@ -39,6 +51,12 @@ func New(config ...Config) *Storage {
 		}
 	}
 	
+	// Expiry notifications are published per database
+	database := cfg.Database
+	if client, ok := db.(interface{ Options() *redis.Options }); ok {
+		database = client.Options().DB
+	}
+
 	if len(cfg.Namespace) > 0 {
 		cfg.Namespace = strings.TrimRight(cfg.Namespace, "/\\ :_-") + ":"
 	}
@@ -47,18 +65,25 @@ func New(config ...Config) *Storage {
 	return &Storage{
 		db: db,
 		namespace: cfg.Namespace,
+		logger: cfg.Logger,
+		database: database,
 	}
 }
 
 // Get value by key
 func (s *Storage) Get(key string) *storage.Result {
+	return s.GetContext(context.Background(), key)
+}
+
+// Get value by key
+func (s *Storage) GetContext(ctx context.Context, key string) *storage.Result {
 	if len(key) <= 0 {
 		return &storage.Result{ Value: nil, Error: errors.New("storage keys cannot be zero length"), Missed: false }
 	}
 
 	key = s.namespace + key
 
-	val, err := s.db.Get(context.Background(), key).Result()
+	val, err := s.db.Get(ctx, key).Result()
 	if err == redis.Nil {
 		return &storage.Result{ Value: nil, Error: nil, Missed: true }
 	}
@@ -68,22 +93,38 @@ func (s *Storage) Get(key string) *storage.Result {
 
 // Set key with value
 func (s *Storage) Set(key string, value any, expiry ...time.Duration) error {
+	return s.SetContext(context.Background(), key, value, expiry...)
+}
+
+// Set key with value
+func (s *Storage) SetContext(ctx context.Context, key string, value any, expiry ...time.Duration) error {
 	if len(key) <= 0 {
 		return errors.New("storage keys cannot be zero length")
 	}
 
-	var exp time.Duration = 0
-	if len(expiry) > 0 {
-		exp = expiry[0]
+	// Sub-second expiries are sent with PX, so they keep their millisecond precision
+	exp, err := storage.Expiry(expiry...)
+	if err != nil {
+		return err
+	}
+
+	// go-redis writes a uuid.UUID as its 16 raw bytes, which Get could not tell apart from any other 16 character string
+	if id, ok := value.(uuid.UUID); ok {
+		value = id.String()
 	}
 
 	key = s.namespace + key
 
-	return s.db.Set(context.Background(), key, value, exp).Err()
+	return s.db.Set(ctx, key, value, exp).Err()
 }
 
 // Delete entries by key
 func (s *Storage) Delete(keys ...string) error {
+	return s.DeleteContext(context.Background(), keys...)
+}
+
+// Delete entries by key
+func (s *Storage) DeleteContext(ctx context.Context, keys ...string) error {
 	if len(keys) <= 0 {
 		return errors.New("at least one key is required for Delete")
 	}
@@ -96,22 +137,27 @@ func (s *Storage) Delete(keys ...string) error {
 		keys[k] = v
 	}
 	
-	return s.db.Del(context.Background(), keys...).Err()
+	return s.db.Del(ctx, keys...).Err()
 }
 
 // Reset all entries in the namespace
 func (s *Storage) Reset() error {
+	return s.ResetContext(context.Background())
+}
+
+// Reset all entries in the namespace
+func (s *Storage) ResetContext(ctx context.Context) error {
 	if s.namespace == "" {
-		return s.db.FlushDB(context.Background()).Err()
+		return s.db.FlushDB(ctx).Err()
 	} else {
-		iter := s.db.Scan(context.Background(), 0, s.namespace + "*", 0).Iterator()
-		for iter.Next(context.Background()) {
-			if err := s.db.Del(context.Background(), iter.Val()).Err(); err != nil {
-				panic(err)
+		iter := s.db.Scan(ctx, 0, s.namespace + "*", 0).Iterator()
+		for iter.Next(ctx) {
+			if err := s.db.Del(ctx, iter.Val()).Err(); err != nil {
+				return err
 			}
 		}
 		if err := iter.Err(); err != nil {
-			panic(err)
+			return err
 		}
 	}
 
@@ -120,10 +166,116 @@ func (s *Storage) Reset() error {
 
 // Close the database
 func (s *Storage) Close() error {
+	s.mux.Lock()
+	if s.pubsub != nil {
+		_ = s.pubsub.Close()
+		s.pubsub = nil
+	}
+	s.mux.Unlock()
+
 	return s.db.Close()
 }
 
+// OnExpire calls fn with every key in this namespace that redis expires until cancel is called, the value is always nil
+// as redis has already removed it. Redis reports a key once it finds it expired (when it is accessed, or by its background
+// sweep), so reports can lag behind the expiry. Keyspace notifications are not stored: keys that expire while the
+// subscription is reconnecting are not reported, and every subscribed storage is told about every key.
+// notify-keyspace-events must include "Ex", it is added when the server allows CONFIG SET and a warning is logged otherwise.
+// Cluster nodes only publish their own keys and the subscription listens to one node, so a cluster's expiry is not fully reported.
+func (s *Storage) OnExpire(fn func(key string, value any)) (cancel func()) {
+	unsubscribe := s.expiries.Add(fn)
+
+	s.mux.Lock()
+	if s.pubsub == nil {
+		s.pubsub = s.listen()
+	}
+	s.mux.Unlock()
+
+	return func() {
+		unsubscribe()
+
+		s.mux.Lock()
+		defer s.mux.Unlock()
+
+		if s.expiries.Len() == 0 && s.pubsub != nil {
+			_ = s.pubsub.Close()
+			s.pubsub = nil
+		}
+	}
+}
+
+// listen subscribes to expired key notifications, returning once the subscription is active
+func (s *Storage) listen() *redis.PubSub {
+	ctx := context.Background()
+	s.enableNotifications(ctx)
+
+	pubsub := s.db.Subscribe(ctx, fmt.Sprintf("__keyevent@%d__:expired", s.database))
+
+	// The subscription is retried in the background when this fails
+	if _, err := pubsub.Receive(ctx); err != nil {
+		s.logger.Warn("storage could not subscribe to expiry notifications", "driver", "redis", "error", err)
+	}
+
+	go func() {
+		for msg := range pubsub.Channel() {
+			if strings.HasPrefix(msg.Payload, s.namespace) {
+				s.expiries.Notify(strings.TrimPrefix(msg.Payload, s.namespace), nil)
+			}
+		}
+	}()
+
+	return pubsub
+}
+
+// enableNotifications adds "Ex" to notify-keyspace-events unless redis already publishes expired key events
+func (s *Storage) enableNotifications(ctx context.Context) {
+	config, err := s.db.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err == nil {
+		flags := config["notify-keyspace-events"]
+		if strings.Contains(flags, "E") && strings.ContainsAny(flags, "xA") {
+			return
+		}
+
+		if !strings.Contains(flags, "E") {
+			flags += "E"
+		}
+		if !strings.ContainsAny(flags, "xA") {
+			flags += "x"
+		}
+
+		err = s.db.ConfigSet(ctx, "notify-keyspace-events", flags).Err()
+	}
+
+	if err != nil {
+		s.logger.Warn("storage could not enable expiry notifications, notify-keyspace-events must include Ex", "driver", "redis", "error", err)
+	}
+}
+
 // Return database client
 func (s *Storage) Conn() redis.UniversalClient {
 	return s.db
-}
\ No newline at end of file
+}
+
+// reconnectHook reports failed connection attempts, which go-redis otherwise retries silently
+type reconnectHook struct {
+	logger storage.Logger
+}
+
+func (h *reconnectHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			h.logger.Warn("storage reconnect failed", "driver", "redis", "addr", addr, "error", err)
+		}
+
+		return conn, err
+	}
+}
+
+func (h *reconnectHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *reconnectHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
@@ -1,122 +1,116 @@
 package redis
 
 import (
-	"crypto/tls"
-	"log"
+	"fmt"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/redis/redistest"
+	"github.com/paul-norman/go-fiber-storage/storagetest"
 )
 
-var testStore = New(Config{
-	Reset: true,
-})
-
-func Test_Redis_Set(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-}
+var (
+	testServer	*redistest.Server
+	testStore	*Storage
+)
 
-func Test_Redis_Set_Override(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
+func TestMain(m *testing.M) {
+	testServer = redistest.NewServer()
+	testStore = New(Config{
+		Host:	testServer.Host,
+		Port:	testServer.Port,
+		Reset:	true,
+	})
 
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	code := m.Run()
 
-	err = testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	testServer.Close()
+	os.Exit(code)
 }
 
-func Test_Redis_Get(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, val, result)
+func Test_Redis_Conformance(t *testing.T) {
+	storagetest.Run(t, func() storage.Storage {
+		return New(Config{
+			Host:	testServer.Host,
+			Port:	testServer.Port,
+			Reset:	true,
+		})
+	}, storagetest.Config{
+		Namespaced: func(namespace string) storage.Storage {
+			return New(Config{
+				Host:		testServer.Host,
+				Port:		testServer.Port,
+				Namespace:	namespace,
+			})
+		},
+		// Redis expires keys itself, so the server is moved on rather than a clock
+		Advance:	testServer.FastForward,
+	})
 }
 
-func Test_Redis_Set_Expiration(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-		exp = 1 * time.Second
-	)
+func Test_Redis_OnExpire(t *testing.T) {
+	var _ storage.ExpiryNotifier = &Storage{}
 
-	err := testStore.Set(key, val, exp)
-	utils.AssertEqual(t, nil, err)
+	store := New(Config{
+		Host:		testServer.Host,
+		Port:		testServer.Port,
+		Namespace:	"expire",
+	})
+	defer store.Close()
 
-	time.Sleep(1100 * time.Millisecond)
-}
+	events, cancel := storage.ExpiryEvents(store, 10)
+	defer cancel()
 
-func Test_Redis_Get_Expired(t *testing.T) {
-	var (
-		key = "john"
-	)
+	// Keys outside the namespace are not reported, notifications arrive in order so it would be first
+	utils.AssertEqual(t, nil, testStore.Set("john", "doe", time.Second))
+	testServer.FastForward(time.Second)
 
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
-}
+	utils.AssertEqual(t, nil, store.Set("john", "doe", time.Second))
+	utils.AssertEqual(t, nil, store.Set("jane", "doe"))
+	testServer.FastForward(time.Second)
 
-func Test_Redis_Get_NotExist(t *testing.T) {
-	result, err := testStore.Get("notexist")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	select {
+		case event := <-events:
+			utils.AssertEqual(t, storage.ExpiryEvent{ Key: "john", Value: nil }, event)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expiry was not reported")
+	}
+	utils.AssertEqual(t, true, store.Get("jane").Hit())
+	utils.AssertEqual(t, nil, store.Reset())
 }
 
-func Test_Redis_Delete(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
+func Test_Redis_Expiry_Precision(t *testing.T) {
+	// Sub-second expiries are sent in milliseconds
+	err := testStore.Set("john", "doe", 1500 * time.Millisecond)
 	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, testStore.Get("john").Hit())
 
-	err = testStore.Delete(key)
-	utils.AssertEqual(t, nil, err)
+	testServer.FastForward(time.Second)
+	utils.AssertEqual(t, true, testStore.Get("john").Hit())
 
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	testServer.FastForward(500 * time.Millisecond)
+	utils.AssertEqual(t, true, testStore.Get("john").Miss())
 }
 
-func Test_Redis_Reset(t *testing.T) {
-	var (
-		val = []byte("doe")
-	)
-
-	err := testStore.Set("john1", val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	err = testStore.Set("john2", val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	err = testStore.Reset()
-	utils.AssertEqual(t, nil, err)
+func Test_Redis_Reset_Namespace(t *testing.T) {
+	store := New(Config{
+		Host:		testServer.Host,
+		Port:		testServer.Port,
+		Namespace:	"sessions",
+	})
+	defer store.Close()
 
-	result, err := testStore.Get("john1")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	utils.AssertEqual(t, nil, testStore.Set("john", "doe", 0))
+	for i := 0; i < 25; i++ {
+		utils.AssertEqual(t, nil, store.Set(fmt.Sprintf("john%d", i), "doe", 0))
+	}
 
-	result, err = testStore.Get("john2")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	// The keys are removed a page of SCAN results at a time
+	utils.AssertEqual(t, nil, store.Reset())
+	utils.AssertEqual(t, []string{ "john" }, testServer.Keys())
 }
 
 func Test_Redis_Close(t *testing.T) {
@@ -129,7 +123,7 @@ func Test_Redis_Conn(t *testing.T) {
 
 func Test_Redis_Initalize_WithURL(t *testing.T) {
 	testStoreUrl := New(Config{
-		ConnectionURI: "redis://localhost:6379",
+		ConnectionURI: testServer.URL,
 	})
 	var (
 		key = "clark"
@@ -139,7 +133,7 @@ func Test_Redis_Initalize_WithURL(t *testing.T) {
 	err := testStoreUrl.Set(key, val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStoreUrl.Get(key)
+	result, err, _ := testStoreUrl.Get(key).Bytes()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, val, result)
 
@@ -150,28 +144,12 @@ func Test_Redis_Initalize_WithURL(t *testing.T) {
 }
 
 func Test_Redis_Initalize_WithURL_TLS(t *testing.T) {
-	cer, err := tls.LoadX509KeyPair("./tests/tls/client.crt", "./tests/tls/client.key")
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	tlsCfg := &tls.Config{
-		MinVersion:               tls.VersionTLS12,
-		CurvePreferences:         []tls.CurveID{tls.CurveP521, tls.CurveP384, tls.CurveP256},
-		PreferServerCipherSuites: true,
-		InsecureSkipVerify:       true,
-		Certificates:             []tls.Certificate{cer},
-		CipherSuites: []uint16{
-			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
-			tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
-			tls.TLS_RSA_WITH_AES_256_CBC_SHA,
-		},
-	}
+	tlsServer := redistest.NewTLSServer()
+	defer tlsServer.Close()
 
 	testStoreUrl := New(Config{
-		ConnectionURI:	"redis://localhost:6380",
-		TLSConfig:		tlsCfg,
+		ConnectionURI:	tlsServer.URL,
+		TLSConfig:		tlsServer.ClientTLSConfig(),
 	})
 
 	var (
@@ -179,10 +157,10 @@ func Test_Redis_Initalize_WithURL_TLS(t *testing.T) {
 		val = []byte("kent")
 	)
 
-	err = testStoreUrl.Set(key, val, 0)
+	err := testStoreUrl.Set(key, val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStoreUrl.Get(key)
+	result, err, _ := testStoreUrl.Get(key).Bytes()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, val, result)
 
@@ -195,7 +173,7 @@ func Test_Redis_Initalize_WithURL_TLS(t *testing.T) {
 func Test_Redis_Universal_Addrs(t *testing.T) {
 	// This should failover and create a Single Node connection.
 	testStoreUniversal := New(Config{
-		Addresses: []string{"localhost:6379"},
+		Addresses: []string{ testServer.Addr },
 	})
 
 	var (
@@ -206,7 +184,7 @@ func Test_Redis_Universal_Addrs(t *testing.T) {
 	err := testStoreUniversal.Set(key, val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStoreUniversal.Get(key)
+	result, err, _ := testStoreUniversal.Get(key).Bytes()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, val, result)
 
@@ -221,7 +199,7 @@ func Test_Redis_Universal_With_URL_Undefined(t *testing.T) {
 	// The URL should get ignored since it's empty
 	testStoreUniversal := New(Config{
 		ConnectionURI:	"",
-		Addresses:		[]string{"localhost:6379"},
+		Addresses:		[]string{ testServer.Addr },
 	})
 
 	var (
@@ -232,7 +210,7 @@ func Test_Redis_Universal_With_URL_Undefined(t *testing.T) {
 	err := testStoreUniversal.Set(key, val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStoreUniversal.Get(key)
+	result, err, _ := testStoreUniversal.Get(key).Bytes()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, val, result)
 
@@ -246,8 +224,8 @@ func Test_Redis_Universal_With_URL_Defined(t *testing.T) {
 	// This should failover to creating a regular *redis.Client
 	// The Addresses field should get ignored since URL is defined
 	testStoreUniversal := New(Config{
-		ConnectionURI:   "redis://localhost:6379",
-		Addresses: 		[]string{"localhost:6355"},
+		ConnectionURI:	testServer.URL,
+		Addresses:		[]string{"localhost:6355"},
 	})
 
 	var (
@@ -258,7 +236,7 @@ func Test_Redis_Universal_With_URL_Defined(t *testing.T) {
 	err := testStoreUniversal.Set(key, val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStoreUniversal.Get(key)
+	result, err, _ := testStoreUniversal.Get(key).Bytes()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, val, result)
 
@@ -274,7 +252,7 @@ func Test_Redis_Universal_With_HostPort(t *testing.T) {
 	testStoreUniversal := New(Config{
 		Host:		"localhost",
 		Port:		6388,
-		Addresses:	[]string{"localhost:6379"},
+		Addresses:	[]string{ testServer.Addr },
 	})
 
 	var (
@@ -285,7 +263,7 @@ func Test_Redis_Universal_With_HostPort(t *testing.T) {
 	err := testStoreUniversal.Set(key, val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStoreUniversal.Get(key)
+	result, err, _ := testStoreUniversal.Get(key).Bytes()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, val, result)
 
@@ -299,7 +277,7 @@ func Test_Redis_Universal_With_HostPort_And_URL(t *testing.T) {
 	// This should failover to creating a regular *redis.Client
 	// The Host and Port should get ignored since Addrs is defined
 	testStoreUniversal := New(Config{
-		ConnectionURI:	"redis://localhost:6379",
+		ConnectionURI:	testServer.URL,
 		Host:			"localhost",
 		Port:			6388,
 		Addresses:		[]string{"localhost:6399"},
@@ -313,7 +291,7 @@ func Test_Redis_Universal_With_HostPort_And_URL(t *testing.T) {
 	err := testStoreUniversal.Set(key, val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStoreUniversal.Get(key)
+	result, err, _ := testStoreUniversal.Get(key).Bytes()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, val, result)
 
@@ -324,14 +302,11 @@ func Test_Redis_Universal_With_HostPort_And_URL(t *testing.T) {
 }
 
 func Test_Redis_Cluster(t *testing.T) {
+	// More than one address creates a cluster client, the test server reports itself as a cluster owning every slot
 	testStoreUniversal := New(Config{
 		Addresses: []string{
-			"localhost:7000",
-			"localhost:7001",
-			"localhost:7002",
-			"localhost:7003",
-			"localhost:7004",
-			"localhost:7005",
+			testServer.Addr,
+			testServer.Addr,
 		},
 	})
 
@@ -343,7 +318,7 @@ func Test_Redis_Cluster(t *testing.T) {
 	err := testStoreUniversal.Set(key, val, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStoreUniversal.Get(key)
+	result, err, _ := testStoreUniversal.Get(key).Bytes()
 	utils.AssertEqual(t, nil, err)
 	utils.AssertEqual(t, val, result)
 
@@ -0,0 +1,992 @@
+// Package redistest provides an in-process redis server for tests, so that they do not depend on a real server.
+//
+// It speaks enough of RESP2 for the commands used by the redis storage (and most simple clients):
+// PING, ECHO, AUTH, SELECT, CLIENT, QUIT, GET, SET (EX, PX, KEEPTTL, NX, XX), DEL, EXISTS, EXPIRE, PEXPIRE,
+// TTL, PTTL, KEYS, SCAN (MATCH, COUNT), DBSIZE, FLUSHDB, FLUSHALL, COMMAND, CLUSTER SLOTS, CONFIG GET / SET
+// (notify-keyspace-events only), SUBSCRIBE, UNSUBSCRIBE and PUBLISH.
+//
+// Keyspace notifications for expired keys are published as configured by notify-keyspace-events, when an expired key
+// is found by a command or by FastForward (there is no background expiry).
+//
+//	srv := redistest.NewServer()
+//	defer srv.Close()
+//
+//	store := redis.New(redis.Config{ Host: srv.Host, Port: srv.Port })
+package redistest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of databases available to SELECT, as in a default redis configuration
+const databases = 16
+
+// Server is an in-process redis server listening on a random local port
+type Server struct {
+	// Address of the server, i.e. "127.0.0.1:49152"
+	Addr string
+
+	// Host and Port of the server, for configs that take them separately
+	Host string
+	Port int
+
+	// URL of the server, i.e. "redis://127.0.0.1:49152" (or "rediss://" for TLS servers)
+	URL string
+
+	listener	net.Listener
+	certificate	*x509.Certificate
+
+	mux			sync.Mutex
+	dbs			[databases]map[string]*entry
+	seq			uint64
+	conns		map[net.Conn]struct{}
+	subscribers	map[*client]struct{}
+	notify		string
+	closed		bool
+	wg			sync.WaitGroup
+}
+
+// entry is a stored value along with its expiry, the zero time meaning none
+type entry struct {
+	value	string
+	expiry	time.Time
+
+	// Position of the key in SCAN order, kept when the value is replaced
+	seq		uint64
+}
+
+// NewServer starts a server, it must be stopped with Close
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("redistest: failed to listen: %v", err))
+	}
+
+	return start(listener, nil, "redis")
+}
+
+// NewTLSServer starts a server that only accepts TLS connections, using a self-signed certificate (see ClientTLSConfig)
+func NewTLSServer() *Server {
+	certificate, cert, err := selfSigned()
+	if err != nil {
+		panic(fmt.Sprintf("redistest: failed to create a certificate: %v", err))
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{ Certificates: []tls.Certificate{ certificate }, MinVersion: tls.VersionTLS12 })
+	if err != nil {
+		panic(fmt.Sprintf("redistest: failed to listen: %v", err))
+	}
+
+	return start(listener, cert, "rediss")
+}
+
+func start(listener net.Listener, cert *x509.Certificate, scheme string) *Server {
+	addr := listener.Addr().(*net.TCPAddr)
+
+	s := &Server{
+		Addr:			addr.String(),
+		Host:			addr.IP.String(),
+		Port:			addr.Port,
+		URL:			scheme + "://" + addr.String(),
+		listener:		listener,
+		certificate:	cert,
+		conns:			make(map[net.Conn]struct{}),
+		subscribers:	make(map[*client]struct{}),
+	}
+
+	for i := range s.dbs {
+		s.dbs[i] = make(map[string]*entry)
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// ClientTLSConfig returns a TLS config that trusts the server's certificate, or nil if the server does not use TLS
+func (s *Server) ClientTLSConfig() *tls.Config {
+	if s.certificate == nil {
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(s.certificate)
+
+	return &tls.Config{ RootCAs: pool, ServerName: s.Host, MinVersion: tls.VersionTLS12 }
+}
+
+// Close stops the server and closes all client connections
+func (s *Server) Close() {
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		return
+	}
+	s.closed = true
+	_ = s.listener.Close()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mux.Unlock()
+
+	s.wg.Wait()
+}
+
+// Keys returns the unexpired keys of database 0, sorted
+func (s *Server) Keys() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.keys(0, "*")
+}
+
+// Value returns the value stored for key in database 0
+func (s *Server) Value(key string) (string, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	e := s.get(0, key)
+	if e == nil {
+		return "", false
+	}
+
+	return e.value, true
+}
+
+// FastForward moves every expiry in all databases closer by d, so that TTLs can be tested without waiting.
+// Keys that have expired are removed, publishing their keyspace notifications.
+func (s *Server) FastForward(d time.Duration) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, db := range s.dbs {
+		for _, e := range db {
+			if !e.expiry.IsZero() {
+				e.expiry = e.expiry.Add(-d)
+			}
+		}
+	}
+
+	for i, db := range s.dbs {
+		for key := range db {
+			s.get(i, key)
+		}
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mux.Lock()
+		if s.closed {
+			s.mux.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mux.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// client is the per connection state
+type client struct {
+	db			int
+	quit		bool
+	channels	map[string]struct{}
+
+	// Guards w, messages are written to subscribers by the goroutines of other clients
+	mux			sync.Mutex
+	w			*bufio.Writer
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	r := bufio.NewReader(conn)
+	c := &client{ w: bufio.NewWriter(conn) }
+
+	defer func() {
+		s.mux.Lock()
+		delete(s.conns, conn)
+		delete(s.subscribers, c)
+		s.mux.Unlock()
+		_ = conn.Close()
+	}()
+
+	for !c.quit {
+		args, err := readCommand(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.error("ERR Protocol error: " + err.Error())
+				_ = c.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		s.dispatch(c, args)
+
+		// Pipelined commands are answered together
+		if r.Buffered() == 0 {
+			if err := c.flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	_ = c.flush()
+}
+
+func (c *client) flush() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.w.Flush()
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings, or as an inline command
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, errors.New("invalid multibulk length")
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("expected '$', got '%.1s'", line)
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errors.New("invalid bulk length")
+		}
+
+		buf := make([]byte, size + 2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Reply helpers
+
+func (c *client) simple(s string) {
+	c.w.WriteString("+" + s + "\r\n")
+}
+
+func (c *client) error(s string) {
+	c.w.WriteString("-" + s + "\r\n")
+}
+
+func (c *client) integer(n int64) {
+	c.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (c *client) bulk(s string) {
+	c.w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (c *client) null() {
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *client) array(n int) {
+	c.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+func (c *client) bulks(values []string) {
+	c.array(len(values))
+	for _, v := range values {
+		c.bulk(v)
+	}
+}
+
+// command describes a supported command, the key positions are reported by COMMAND for cluster clients
+type command struct {
+	arity		int
+	readonly	bool
+	firstKey	int
+	lastKey		int
+	run			func(s *Server, c *client, args []string)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":			{ -1, true, 0, 0, cmdPing },
+		"echo":			{ 2, true, 0, 0, cmdEcho },
+		"auth":			{ -2, false, 0, 0, cmdOK },
+		"client":		{ -2, false, 0, 0, cmdOK },
+		"quit":			{ 1, false, 0, 0, cmdQuit },
+		"select":		{ 2, false, 0, 0, cmdSelect },
+		"get":			{ 2, true, 1, 1, cmdGet },
+		"set":			{ -3, false, 1, 1, cmdSet },
+		"del":			{ -2, false, 1, -1, cmdDel },
+		"exists":		{ -2, true, 1, -1, cmdExists },
+		"expire":		{ 3, false, 1, 1, cmdExpire },
+		"pexpire":		{ 3, false, 1, 1, cmdExpire },
+		"ttl":			{ 2, true, 1, 1, cmdTTL },
+		"pttl":			{ 2, true, 1, 1, cmdTTL },
+		"keys":			{ 2, true, 0, 0, cmdKeys },
+		"scan":			{ -2, true, 0, 0, cmdScan },
+		"dbsize":		{ 1, true, 0, 0, cmdDBSize },
+		"flushdb":		{ -1, false, 0, 0, cmdFlushDB },
+		"flushall":		{ -1, false, 0, 0, cmdFlushAll },
+		"command":		{ -1, true, 0, 0, cmdCommand },
+		"cluster":		{ -2, true, 0, 0, cmdCluster },
+		"config":		{ -2, false, 0, 0, cmdConfig },
+		"subscribe":	{ -2, false, 0, 0, cmdSubscribe },
+		"unsubscribe":	{ -1, false, 0, 0, cmdUnsubscribe },
+		"publish":		{ 3, false, 0, 0, cmdPublish },
+	}
+}
+
+// subscribedCommands are the only commands a client may send while it is subscribed to a channel
+var subscribedCommands = map[string]bool{ "subscribe": true, "unsubscribe": true, "ping": true, "quit": true }
+
+func (s *Server) dispatch(c *client, args []string) {
+	name := strings.ToLower(args[0])
+
+	cmd, ok := commands[name]
+	if !ok {
+		c.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	// Subscribers only send subscription commands, so they never publish to themselves while locked here
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if len(c.channels) > 0 && !subscribedCommands[name] {
+		c.error(fmt.Sprintf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", name))
+		return
+	}
+
+	cmd.run(s, c, args)
+}
+
+// get returns the unexpired entry for key, removing it if it has expired
+func (s *Server) get(db int, key string) *entry {
+	e, ok := s.dbs[db][key]
+	if !ok {
+		return nil
+	}
+
+	if !e.expiry.IsZero() && !e.expiry.After(time.Now()) {
+		delete(s.dbs[db], key)
+		s.expired(db, key)
+		return nil
+	}
+
+	return e
+}
+
+// expired publishes the keyspace notifications enabled by notify-keyspace-events for an expired key
+func (s *Server) expired(db int, key string) {
+	if !strings.ContainsAny(s.notify, "xA") {
+		return
+	}
+
+	if strings.Contains(s.notify, "E") {
+		s.publish(fmt.Sprintf("__keyevent@%d__:expired", db), key)
+	}
+
+	if strings.Contains(s.notify, "K") {
+		s.publish(fmt.Sprintf("__keyspace@%d__:%s", db, key), "expired")
+	}
+}
+
+// publish sends a message to every client subscribed to channel, returning the number of clients
+func (s *Server) publish(channel string, message string) int {
+	n := 0
+	for sub := range s.subscribers {
+		if _, ok := sub.channels[channel]; !ok {
+			continue
+		}
+
+		sub.mux.Lock()
+		sub.bulks([]string{ "message", channel, message })
+		_ = sub.w.Flush()
+		sub.mux.Unlock()
+		n++
+	}
+
+	return n
+}
+
+// keys returns the sorted unexpired keys matching pattern
+func (s *Server) keys(db int, pattern string) []string {
+	keys := []string{}
+	for key := range s.dbs[db] {
+		if s.get(db, key) != nil && match(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func cmdPing(s *Server, c *client, args []string) {
+	// Subscribed clients are answered in the form of a message
+	if len(c.channels) > 0 {
+		message := ""
+		if len(args) > 1 {
+			message = args[1]
+		}
+		c.bulks([]string{ "pong", message })
+		return
+	}
+
+	if len(args) > 1 {
+		c.bulk(args[1])
+		return
+	}
+	c.simple("PONG")
+}
+
+func cmdEcho(s *Server, c *client, args []string) {
+	c.bulk(args[1])
+}
+
+func cmdOK(s *Server, c *client, args []string) {
+	c.simple("OK")
+}
+
+func cmdQuit(s *Server, c *client, args []string) {
+	c.simple("OK")
+	c.quit = true
+}
+
+func cmdSelect(s *Server, c *client, args []string) {
+	db, err := strconv.Atoi(args[1])
+	if err != nil || db < 0 || db >= databases {
+		c.error("ERR DB index is out of range")
+		return
+	}
+
+	c.db = db
+	c.simple("OK")
+}
+
+func cmdGet(s *Server, c *client, args []string) {
+	e := s.get(c.db, args[1])
+	if e == nil {
+		c.null()
+		return
+	}
+
+	c.bulk(e.value)
+}
+
+func cmdSet(s *Server, c *client, args []string) {
+	key, value := args[1], args[2]
+
+	var expiry time.Time
+	var nx, xx, keepTTL bool
+
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); opt {
+			case "nx":
+				nx = true
+			case "xx":
+				xx = true
+			case "keepttl":
+				keepTTL = true
+			case "ex", "px":
+				if i + 1 >= len(args) {
+					c.error("ERR syntax error")
+					return
+				}
+				i++
+				n, err := strconv.ParseInt(args[i], 10, 64)
+				if err != nil || n <= 0 {
+					c.error("ERR invalid expire time in 'set' command")
+					return
+				}
+				unit := time.Second
+				if opt == "px" {
+					unit = time.Millisecond
+				}
+				expiry = time.Now().Add(time.Duration(n) * unit)
+			default:
+				c.error("ERR syntax error")
+				return
+		}
+	}
+
+	existing := s.get(c.db, key)
+	if (nx && existing != nil) || (xx && existing == nil) {
+		c.null()
+		return
+	}
+
+	if existing == nil {
+		s.seq++
+		existing = &entry{ seq: s.seq }
+		s.dbs[c.db][key] = existing
+	} else if keepTTL {
+		expiry = existing.expiry
+	}
+
+	existing.value = value
+	existing.expiry = expiry
+	c.simple("OK")
+}
+
+func cmdDel(s *Server, c *client, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if s.get(c.db, key) != nil {
+			delete(s.dbs[c.db], key)
+			n++
+		}
+	}
+
+	c.integer(n)
+}
+
+func cmdExists(s *Server, c *client, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if s.get(c.db, key) != nil {
+			n++
+		}
+	}
+
+	c.integer(n)
+}
+
+func cmdExpire(s *Server, c *client, args []string) {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.error("ERR value is not an integer or out of range")
+		return
+	}
+
+	e := s.get(c.db, args[1])
+	if e == nil {
+		c.integer(0)
+		return
+	}
+
+	unit := time.Second
+	if strings.ToLower(args[0]) == "pexpire" {
+		unit = time.Millisecond
+	}
+
+	e.expiry = time.Now().Add(time.Duration(n) * unit)
+	c.integer(1)
+}
+
+func cmdTTL(s *Server, c *client, args []string) {
+	e := s.get(c.db, args[1])
+	switch {
+		case e == nil:
+			c.integer(-2)
+		case e.expiry.IsZero():
+			c.integer(-1)
+		case strings.ToLower(args[0]) == "pttl":
+			c.integer(time.Until(e.expiry).Milliseconds())
+		default:
+			// Rounded like redis, so a key set with EX 10 reports 10 straight away
+			c.integer(int64((time.Until(e.expiry) + 500 * time.Millisecond) / time.Second))
+	}
+}
+
+func cmdKeys(s *Server, c *client, args []string) {
+	c.bulks(s.keys(c.db, args[1]))
+}
+
+// cmdScan pages through the keys in the order they were created, the cursor being the position to continue from.
+// Like redis, keys that exist for the whole iteration are returned even if others are added or deleted meanwhile.
+func cmdScan(s *Server, c *client, args []string) {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		c.error("ERR invalid cursor")
+		return
+	}
+
+	pattern, count := "*", 10
+	for i := 2; i < len(args); i++ {
+		if i + 1 >= len(args) {
+			c.error("ERR syntax error")
+			return
+		}
+
+		switch strings.ToLower(args[i]) {
+			case "match":
+				pattern = args[i + 1]
+			case "count":
+				count, err = strconv.Atoi(args[i + 1])
+				if err != nil || count < 1 {
+					c.error("ERR syntax error")
+					return
+				}
+			case "type":
+				// Every value is a string
+				if strings.ToLower(args[i + 1]) != "string" {
+					pattern = ""
+				}
+			default:
+				c.error("ERR syntax error")
+				return
+		}
+		i++
+	}
+
+	remaining := []*scanned{}
+	for key := range s.dbs[c.db] {
+		if e := s.get(c.db, key); e != nil && e.seq >= cursor {
+			remaining = append(remaining, &scanned{ key: key, seq: e.seq })
+		}
+	}
+	sort.Slice(remaining, func(i, j int) bool { return remaining[i].seq < remaining[j].seq })
+
+	// Like redis, COUNT limits the keys examined rather than the keys returned
+	next := uint64(0)
+	if len(remaining) > count {
+		next = remaining[count].seq
+		remaining = remaining[:count]
+	}
+
+	found := []string{}
+	for _, r := range remaining {
+		if pattern != "" && match(pattern, r.key) {
+			found = append(found, r.key)
+		}
+	}
+
+	c.array(2)
+	c.bulk(strconv.FormatUint(next, 10))
+	c.bulks(found)
+}
+
+// scanned is a key visited by SCAN
+type scanned struct {
+	key	string
+	seq	uint64
+}
+
+func cmdDBSize(s *Server, c *client, args []string) {
+	c.integer(int64(len(s.keys(c.db, "*"))))
+}
+
+func cmdFlushDB(s *Server, c *client, args []string) {
+	s.dbs[c.db] = make(map[string]*entry)
+	c.simple("OK")
+}
+
+func cmdFlushAll(s *Server, c *client, args []string) {
+	for i := range s.dbs {
+		s.dbs[i] = make(map[string]*entry)
+	}
+	c.simple("OK")
+}
+
+// cmdCommand describes the supported commands, cluster clients use it to find the keys of each command
+func cmdCommand(s *Server, c *client, args []string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	c.array(len(names))
+	for _, name := range names {
+		cmd := commands[name]
+
+		c.array(6)
+		c.bulk(name)
+		c.integer(int64(cmd.arity))
+		if cmd.readonly {
+			c.bulks([]string{ "readonly" })
+		} else {
+			c.bulks([]string{ "write" })
+		}
+		c.integer(int64(cmd.firstKey))
+		c.integer(int64(cmd.lastKey))
+		if cmd.firstKey > 0 {
+			c.integer(1)
+		} else {
+			c.integer(0)
+		}
+	}
+}
+
+// cmdCluster reports the server as a cluster of one that owns every slot
+func cmdCluster(s *Server, c *client, args []string) {
+	if strings.ToLower(args[1]) != "slots" {
+		c.error("ERR unsupported CLUSTER subcommand")
+		return
+	}
+
+	c.array(1)
+	c.array(3)
+	c.integer(0)
+	c.integer(16383)
+	c.array(2)
+	c.bulk(s.Host)
+	c.integer(int64(s.Port))
+}
+
+// cmdConfig supports CONFIG GET and SET for notify-keyspace-events, other parameters are reported as unknown
+func cmdConfig(s *Server, c *client, args []string) {
+	switch strings.ToLower(args[1]) {
+		case "get":
+			if len(args) != 3 {
+				c.error("ERR wrong number of arguments for 'config|get' command")
+				return
+			}
+
+			if match(strings.ToLower(args[2]), "notify-keyspace-events") {
+				c.bulks([]string{ "notify-keyspace-events", s.notify })
+				return
+			}
+			c.array(0)
+		case "set":
+			if len(args) != 4 {
+				c.error("ERR wrong number of arguments for 'config|set' command")
+				return
+			}
+
+			if strings.ToLower(args[2]) != "notify-keyspace-events" {
+				c.error(fmt.Sprintf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", args[2]))
+				return
+			}
+
+			if strings.Trim(args[3], "KEg$lshzxetmdA") != "" {
+				c.error("ERR Invalid argument for CONFIG SET 'notify-keyspace-events'")
+				return
+			}
+
+			s.notify = args[3]
+			c.simple("OK")
+		default:
+			c.error("ERR unsupported CONFIG subcommand")
+	}
+}
+
+func cmdSubscribe(s *Server, c *client, args []string) {
+	if c.channels == nil {
+		c.channels = make(map[string]struct{})
+	}
+
+	for _, channel := range args[1:] {
+		c.channels[channel] = struct{}{}
+
+		c.array(3)
+		c.bulk("subscribe")
+		c.bulk(channel)
+		c.integer(int64(len(c.channels)))
+	}
+
+	s.subscribers[c] = struct{}{}
+}
+
+func cmdUnsubscribe(s *Server, c *client, args []string) {
+	channels := args[1:]
+	if len(channels) == 0 {
+		for channel := range c.channels {
+			channels = append(channels, channel)
+		}
+		sort.Strings(channels)
+	}
+
+	if len(channels) == 0 {
+		c.array(3)
+		c.bulk("unsubscribe")
+		c.null()
+		c.integer(0)
+		return
+	}
+
+	for _, channel := range channels {
+		delete(c.channels, channel)
+
+		c.array(3)
+		c.bulk("unsubscribe")
+		c.bulk(channel)
+		c.integer(int64(len(c.channels)))
+	}
+
+	if len(c.channels) == 0 {
+		delete(s.subscribers, c)
+	}
+}
+
+func cmdPublish(s *Server, c *client, args []string) {
+	c.integer(int64(s.publish(args[1], args[2])))
+}
+
+// match reports whether key matches a redis glob pattern (*, ?, [abc], [^a-z] and \ escapes)
+func match(pattern, key string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+			case '*':
+				for len(pattern) > 0 && pattern[0] == '*' {
+					pattern = pattern[1:]
+				}
+				if len(pattern) == 0 {
+					return true
+				}
+				for i := 0; i <= len(key); i++ {
+					if match(pattern, key[i:]) {
+						return true
+					}
+				}
+				return false
+			case '?':
+				if len(key) == 0 {
+					return false
+				}
+			case '[':
+				if len(key) == 0 {
+					return false
+				}
+				end := strings.IndexByte(pattern[1:], ']')
+				if end < 0 {
+					// An unterminated class matches a literal '['
+					if key[0] != '[' {
+						return false
+					}
+					break
+				}
+				class := pattern[1:end + 1]
+				negate := strings.HasPrefix(class, "^")
+				if negate {
+					class = class[1:]
+				}
+				if inClass(class, key[0]) == negate {
+					return false
+				}
+				pattern = pattern[end + 1:]
+			case '\\':
+				if len(pattern) > 1 {
+					pattern = pattern[1:]
+				}
+				fallthrough
+			default:
+				if len(key) == 0 || pattern[0] != key[0] {
+					return false
+				}
+		}
+		pattern = pattern[1:]
+		key = key[1:]
+	}
+
+	return len(key) == 0
+}
+
+// inClass reports whether b is in a glob character class such as "a-z0"
+func inClass(class string, b byte) bool {
+	for i := 0; i < len(class); i++ {
+		if i + 2 < len(class) && class[i + 1] == '-' {
+			if class[i] <= b && b <= class[i + 2] {
+				return true
+			}
+			i += 2
+			continue
+		}
+		if class[i] == b {
+			return true
+		}
+	}
+
+	return false
+}
+
+// selfSigned creates a certificate for 127.0.0.1 and localhost that is valid for a day
+func selfSigned() (tls.Certificate, *x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:			big.NewInt(1),
+		Subject:				pkix.Name{ Organization: []string{ "redistest" } },
+		NotBefore:				time.Now().Add(-time.Hour),
+		NotAfter:				time.Now().Add(24 * time.Hour),
+		KeyUsage:				x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:			[]x509.ExtKeyUsage{ x509.ExtKeyUsageServerAuth },
+		IPAddresses:			[]net.IP{ net.ParseIP("127.0.0.1") },
+		DNSNames:				[]string{ "localhost" },
+		IsCA:					true,
+		BasicConstraintsValid:	true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+
+	return tls.Certificate{ Certificate: [][]byte{ der }, PrivateKey: key, Leaf: cert }, cert, nil
+}
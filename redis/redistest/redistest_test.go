@@ -0,0 +1,127 @@
+package redistest
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+// send writes a raw command and returns the first line of the reply
+func send(t *testing.T, conn net.Conn, r *bufio.Reader, command string) string {
+	t.Helper()
+
+	_, err := conn.Write([]byte(command))
+	utils.AssertEqual(t, nil, err)
+
+	line, err := readLine(r)
+	utils.AssertEqual(t, nil, err)
+
+	return line
+}
+
+func Test_Redistest_Protocol(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	utils.AssertEqual(t, nil, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// Inline and multibulk commands
+	utils.AssertEqual(t, "+PONG", send(t, conn, r, "PING\r\n"))
+	utils.AssertEqual(t, "+OK", send(t, conn, r, "*3\r\n$3\r\nSET\r\n$4\r\njohn\r\n$3\r\ndoe\r\n"))
+	utils.AssertEqual(t, "$3", send(t, conn, r, "GET john\r\n"))
+	utils.AssertEqual(t, "doe", send(t, conn, r, ""))
+	utils.AssertEqual(t, "$-1", send(t, conn, r, "GET jane\r\n"))
+	utils.AssertEqual(t, "$-1", send(t, conn, r, "SET john smith NX\r\n"))
+	utils.AssertEqual(t, "-ERR unknown command 'HELLO'", send(t, conn, r, "HELLO 3\r\n"))
+
+	// Databases are separate
+	utils.AssertEqual(t, "+OK", send(t, conn, r, "SELECT 1\r\n"))
+	utils.AssertEqual(t, ":0", send(t, conn, r, "EXISTS john\r\n"))
+	utils.AssertEqual(t, "+OK", send(t, conn, r, "SELECT 0\r\n"))
+	utils.AssertEqual(t, ":1", send(t, conn, r, "DEL john jane\r\n"))
+	utils.AssertEqual(t, []string{}, srv.Keys())
+}
+
+func Test_Redistest_Expiry(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	utils.AssertEqual(t, nil, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	utils.AssertEqual(t, "+OK", send(t, conn, r, "SET john doe EX 10\r\n"))
+	utils.AssertEqual(t, ":10", send(t, conn, r, "TTL john\r\n"))
+	utils.AssertEqual(t, "+OK", send(t, conn, r, "SET jane doe\r\n"))
+	utils.AssertEqual(t, ":-1", send(t, conn, r, "TTL jane\r\n"))
+	utils.AssertEqual(t, ":-2", send(t, conn, r, "TTL jim\r\n"))
+
+	srv.FastForward(10 * time.Second)
+
+	_, ok := srv.Value("john")
+	utils.AssertEqual(t, false, ok)
+	utils.AssertEqual(t, []string{ "jane" }, srv.Keys())
+}
+
+func Test_Redistest_Notifications(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr)
+	utils.AssertEqual(t, nil, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	sub, err := net.Dial("tcp", srv.Addr)
+	utils.AssertEqual(t, nil, err)
+	defer sub.Close()
+	sr := bufio.NewReader(sub)
+
+	utils.AssertEqual(t, "*3", send(t, sub, sr, "SUBSCRIBE __keyevent@0__:expired\r\n"))
+	for _, line := range []string{ "$9", "subscribe", "$22", "__keyevent@0__:expired", ":1" } {
+		utils.AssertEqual(t, line, send(t, sub, sr, ""))
+	}
+
+	// Only subscription commands are allowed while subscribed
+	utils.AssertEqual(t, "-ERR Can't execute 'get': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", send(t, sub, sr, "GET john\r\n"))
+
+	// Nothing is published until notifications are enabled
+	utils.AssertEqual(t, "+OK", send(t, conn, r, "SET john doe PX 10\r\n"))
+	srv.FastForward(time.Second)
+	utils.AssertEqual(t, "+OK", send(t, conn, r, "CONFIG SET notify-keyspace-events Ex\r\n"))
+	utils.AssertEqual(t, "*2", send(t, conn, r, "CONFIG GET notify-*\r\n"))
+	utils.AssertEqual(t, "$22", send(t, conn, r, ""))
+	utils.AssertEqual(t, "notify-keyspace-events", send(t, conn, r, ""))
+	utils.AssertEqual(t, "$2", send(t, conn, r, ""))
+	utils.AssertEqual(t, "Ex", send(t, conn, r, ""))
+
+	utils.AssertEqual(t, "+OK", send(t, conn, r, "SET jane doe PX 10\r\n"))
+	srv.FastForward(time.Second)
+	utils.AssertEqual(t, "*3", send(t, sub, sr, ""))
+	for _, line := range []string{ "$7", "message", "$22", "__keyevent@0__:expired", "$4", "jane" } {
+		utils.AssertEqual(t, line, send(t, sub, sr, ""))
+	}
+
+	utils.AssertEqual(t, ":1", send(t, conn, r, "PUBLISH __keyevent@0__:expired jim\r\n"))
+	utils.AssertEqual(t, "*3", send(t, sub, sr, ""))
+}
+
+func Test_Redistest_Match(t *testing.T) {
+	utils.AssertEqual(t, true, match("*", "anything"))
+	utils.AssertEqual(t, true, match("sessions:*", "sessions:john"))
+	utils.AssertEqual(t, false, match("sessions:*", "users:john"))
+	utils.AssertEqual(t, true, match("j?hn", "john"))
+	utils.AssertEqual(t, true, match("j[aeiou]hn", "john"))
+	utils.AssertEqual(t, false, match("j[^o]hn", "john"))
+	utils.AssertEqual(t, true, match("user[0-9]", "user7"))
+	utils.AssertEqual(t, true, match(`a\*b`, "a*b"))
+	utils.AssertEqual(t, false, match(`a\*b`, "axb"))
+	utils.AssertEqual(t, true, match("a/*", "a/b/c"))
+}
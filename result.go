@@ -898,6 +898,10 @@ func (r *Result) UUID() (uuid.UUID, error, bool) {
 	}
 
 	switch value := r.Value.(type) {
+		case uuid.UUID:
+			return value, nil, false
+		case [16]byte:
+			return uuid.UUID(value), nil, false
 		case []byte:
 			token, err := uuid.ParseBytes(value)
 			if err != nil {
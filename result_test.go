@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/gofiber/utils"
+	"github.com/google/uuid"
+)
+
+func Test_Result_UUID(t *testing.T) {
+	id := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+
+	for _, value := range []any{ id, [16]byte(id), id.String(), []byte(id.String()) } {
+		token, err, miss := (&Result{ Value: value }).UUID()
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, false, miss)
+		utils.AssertEqual(t, id, token)
+	}
+
+	// 16 characters are not mistaken for the raw binary form
+	for _, value := range []any{ "session-abcdefgh", []byte("session-abcdefgh") } {
+		_, err, _ := (&Result{ Value: value }).UUID()
+		utils.AssertEqual(t, true, err != nil)
+	}
+}
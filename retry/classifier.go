@@ -0,0 +1,103 @@
+package retry
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+)
+
+// Classifier reports whether an error is transient, and so worth retrying
+type Classifier func(err error) bool
+
+// DefaultClassifier recognises the transient errors of every driver in this repository
+var DefaultClassifier = Any(Network, Redis, Postgres, MySQL, Memcache)
+
+// Any combines classifiers, an error is retried if any of them recognise it.
+// Context cancellation and deadlines are never retried.
+func Any(classifiers ...Classifier) Classifier {
+	return func(err error) bool {
+		if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return false
+		}
+
+		for _, classifier := range classifiers {
+			if classifier(err) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Network recognises timeouts, refused / reset connections and connections closed mid-reply
+func Network(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, driver.ErrBadConn)
+}
+
+// Redis recognises replies from a server that is loading, busy, failing over or resharding
+func Redis(err error) bool {
+	prefix, _, _ := strings.Cut(err.Error(), " ")
+
+	switch prefix {
+		case "LOADING", "BUSY", "TRYAGAIN", "CLUSTERDOWN", "MASTERDOWN", "READONLY":
+			return true
+	}
+
+	return false
+}
+
+// Postgres recognises serialization failures, deadlocks, lock timeouts, lost connections and server restarts
+func Postgres(err error) bool {
+	var pqErr interface{ SQLState() string }
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	state := pqErr.SQLState()
+
+	switch state {
+		case "40001", "40P01", "55P03", "53300", "57P01", "57P02", "57P03":
+			return true
+	}
+
+	// Class 08, connection exceptions
+	return strings.HasPrefix(state, "08")
+}
+
+// MySQL recognises deadlocks, lock wait timeouts, too many connections and lost connections
+func MySQL(err error) bool {
+	msg := err.Error()
+
+	if msg == "invalid connection" {
+		return true
+	}
+
+	for _, code := range []string{ "1040", "1205", "1213", "2006", "2013" } {
+		if strings.HasPrefix(msg, "Error " + code + ":") || strings.HasPrefix(msg, "Error " + code + " (") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Memcache recognises server errors, such as running out of memory (timeouts are recognised by Network)
+func Memcache(err error) bool {
+	return strings.HasPrefix(err.Error(), "memcache: server error")
+}
@@ -0,0 +1,135 @@
+package retry
+
+import (
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Policy controls how often, and how quickly, an operation is retried
+type Policy struct {
+	// Total number of attempts, including the first, 1 disables retries
+	//
+	// Optional. Default is 3
+	Attempts int
+
+	// Delay before the first retry
+	//
+	// Optional. Default is 50 * time.Millisecond
+	Backoff time.Duration
+
+	// Upper limit for the delay between attempts
+	//
+	// Optional. Default is 1 * time.Second
+	MaxBackoff time.Duration
+
+	// Factor the delay grows by after each retry
+	//
+	// Optional. Default is 2
+	Multiplier float64
+
+	// Fraction of each delay that is randomised (0.2 gives ±20%), a negative value disables jitter
+	//
+	// Optional. Default is 0.2
+	Jitter float64
+}
+
+// Config defines the config for storage.
+type Config struct {
+	// Storage whose operations will be retried
+	//
+	// Required. Default is nil
+	Storage storage.Storage
+
+	// Policy for every operation without an entry in Operations
+	//
+	// Optional. Default is DefaultPolicy
+	Policy Policy
+
+	// Policies for individual operations (storage.OpGet etc), unset fields are taken from Policy
+	//
+	// Optional. Default is none
+	Operations map[string]Policy
+
+	// Decides whether an error is worth retrying
+	//
+	// Optional. Default is DefaultClassifier
+	Classifier Classifier
+
+	// Reports whether a write (Set, Delete or Reset) may be repeated, Get is always retried.
+	// Writes made with a context from WithIdempotent are retried regardless.
+	//
+	// Optional. Default is nil (writes are not retried)
+	Idempotent func(op *storage.Op) bool
+}
+
+// DefaultPolicy is used for any unset Policy fields
+var DefaultPolicy = Policy{
+	Attempts:	3,
+	Backoff:	50 * time.Millisecond,
+	MaxBackoff:	1 * time.Second,
+	Multiplier:	2,
+	Jitter:		0.2,
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Storage:	nil,
+	Policy:		DefaultPolicy,
+	Operations:	nil,
+	Classifier:	DefaultClassifier,
+	Idempotent:	nil,
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		return ConfigDefault
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	cfg.Policy = cfg.Policy.inherit(ConfigDefault.Policy)
+
+	if len(cfg.Operations) > 0 {
+		operations := make(map[string]Policy, len(cfg.Operations))
+		for name, policy := range cfg.Operations {
+			operations[name] = policy.inherit(cfg.Policy)
+		}
+		cfg.Operations = operations
+	}
+
+	if cfg.Classifier == nil {
+		cfg.Classifier = ConfigDefault.Classifier
+	}
+
+	return cfg
+}
+
+// inherit fills the unset fields of the policy from another
+func (p Policy) inherit(from Policy) Policy {
+	if p.Attempts <= 0 {
+		p.Attempts = from.Attempts
+	}
+
+	if p.Backoff <= 0 {
+		p.Backoff = from.Backoff
+	}
+
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = from.MaxBackoff
+	}
+
+	if p.Multiplier <= 0 {
+		p.Multiplier = from.Multiplier
+	}
+
+	if p.Jitter == 0 {
+		p.Jitter = from.Jitter
+	}
+
+	return p
+}
@@ -0,0 +1,142 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// idempotentKey marks contexts whose writes may be retried
+type idempotentKey struct{}
+
+// New wraps Config.Storage so that operations failing with transient errors are retried
+func New(config ...Config) storage.Chained {
+	// Set default config
+	cfg := configDefault(config...)
+
+	if cfg.Storage == nil {
+		panic(errors.New("retry: a Storage to wrap is required"))
+	}
+
+	return storage.Use(cfg.Storage, Middleware(cfg))
+}
+
+// Middleware returns the retry middleware so that it can be combined with others in storage.Use (Config.Storage is ignored)
+func Middleware(config ...Config) storage.Middleware {
+	// Set default config
+	cfg := configDefault(config...)
+
+	return func(next storage.Handler) storage.Handler {
+		return func(op *storage.Op) {
+			if op.Name == storage.OpClose || !cfg.idempotent(op) {
+				next(op)
+				return
+			}
+
+			// Inner middleware may rewrite the operation (i.e. prefixing its keys or starting a span), every attempt
+			// starts from the operation as it was given
+			keys := append([]string{}, op.Keys...)
+			ctx, value, expiry := op.Context, op.Value, op.Expiry
+
+			next(op)
+
+			policy := cfg.policy(op.Name)
+			delay := policy.Backoff
+
+			for attempt := 1; attempt < policy.Attempts && cfg.Classifier(failure(op)); attempt++ {
+				if !wait(ctx, policy.jitter(delay)) {
+					return
+				}
+
+				op.Context = ctx
+				op.Keys = append([]string{}, keys...)
+				op.Value = value
+				op.Expiry = expiry
+				op.Result = nil
+				op.Err = nil
+				next(op)
+
+				delay = time.Duration(float64(delay) * policy.Multiplier)
+				if delay > policy.MaxBackoff {
+					delay = policy.MaxBackoff
+				}
+			}
+		}
+	}
+}
+
+// WithIdempotent marks writes made with the returned context as safe to retry
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// AllWrites is an Idempotent func that allows every write to be retried
+func AllWrites(op *storage.Op) bool {
+	return true
+}
+
+// idempotent reports whether the operation may be repeated
+func (cfg Config) idempotent(op *storage.Op) bool {
+	if op.Name == storage.OpGet {
+		return true
+	}
+
+	if op.Context != nil {
+		if marked, _ := op.Context.Value(idempotentKey{}).(bool); marked {
+			return true
+		}
+	}
+
+	return cfg.Idempotent != nil && cfg.Idempotent(op)
+}
+
+// policy returns the policy for the named operation
+func (cfg Config) policy(name string) Policy {
+	if policy, ok := cfg.Operations[name]; ok {
+		return policy
+	}
+
+	return cfg.Policy
+}
+
+// jitter randomises the delay by up to ±Jitter of its length
+func (p Policy) jitter(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return delay
+	}
+
+	return delay + time.Duration(float64(delay) * p.Jitter * (2 * rand.Float64() - 1))
+}
+
+// failure returns the error of an attempt, Get errors may only be on the result
+func failure(op *storage.Op) error {
+	if op.Err == nil && op.Result != nil {
+		return op.Result.Error
+	}
+
+	return op.Err
+}
+
+// wait sleeps before the next attempt, it gives up straight away if the context would expire first
+func wait(ctx context.Context, delay time.Duration) bool {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+		return false
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+		case <-timer.C:
+			return true
+		case <-ctx.Done():
+			return false
+	}
+}
@@ -0,0 +1,187 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/memory"
+)
+
+var errLoading = errors.New("LOADING Redis is loading the dataset in memory")
+
+// failing fails the first n operations with err, counting every attempt
+func failing(n int32, err error, attempts *int32) storage.Middleware {
+	return func(next storage.Handler) storage.Handler {
+		return func(op *storage.Op) {
+			if atomic.AddInt32(attempts, 1) <= n {
+				op.Err = err
+				return
+			}
+			next(op)
+		}
+	}
+}
+
+// fast is a policy that keeps the tests quick
+var fast = Policy{ Attempts: 3, Backoff: time.Millisecond, Jitter: -1 }
+
+func Test_Retry_Required(t *testing.T) {
+	defer func() {
+		utils.AssertEqual(t, true, recover() != nil)
+	}()
+
+	_ = New()
+}
+
+func Test_Retry_Get(t *testing.T) {
+	var attempts int32
+	store := storage.Use(memory.New(), Middleware(Config{ Policy: fast }), failing(2, errLoading, &attempts))
+
+	_ = store.Unwrap().Set("john", "doe")
+	val, err, _ := store.Get("john").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "doe", val)
+	utils.AssertEqual(t, int32(3), attempts)
+
+	// Attempts are limited
+	attempts = 0
+	utils.AssertEqual(t, errLoading, storage.Use(memory.New(), Middleware(Config{ Policy: fast }), failing(5, errLoading, &attempts)).Get("john").Err())
+	utils.AssertEqual(t, int32(3), attempts)
+}
+
+func Test_Retry_Rewritten(t *testing.T) {
+	var attempts int32
+	backend := memory.New()
+
+	// Inner middleware that rewrites the keys, each attempt must see the original keys
+	prefix := func(next storage.Handler) storage.Handler {
+		return func(op *storage.Op) {
+			for i, key := range op.Keys {
+				op.Keys[i] = "ns:" + key
+			}
+			next(op)
+		}
+	}
+
+	store := storage.Use(backend, Middleware(Config{ Policy: fast }), prefix, failing(2, errLoading, &attempts))
+
+	_ = backend.Set("ns:john", "doe")
+	val, err, _ := store.Get("john").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "doe", val)
+	utils.AssertEqual(t, int32(3), attempts)
+}
+
+func Test_Retry_Permanent(t *testing.T) {
+	var attempts int32
+	permanent := errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	store := storage.Use(memory.New(), Middleware(Config{ Policy: fast }), failing(1, permanent, &attempts))
+
+	utils.AssertEqual(t, permanent, store.Get("john").Err())
+	utils.AssertEqual(t, int32(1), attempts)
+}
+
+func Test_Retry_Writes(t *testing.T) {
+	var attempts int32
+	store := storage.Use(memory.New(), Middleware(Config{ Policy: fast }), failing(1, errLoading, &attempts))
+
+	// Not retried by default
+	utils.AssertEqual(t, errLoading, store.Set("john", "doe"))
+	utils.AssertEqual(t, int32(1), attempts)
+
+	// Marked as idempotent
+	attempts = 0
+	utils.AssertEqual(t, nil, store.SetContext(WithIdempotent(context.Background()), "john", "doe"))
+	utils.AssertEqual(t, int32(2), attempts)
+
+	// Allowed by the config
+	attempts = 0
+	store = storage.Use(memory.New(), Middleware(Config{ Policy: fast, Idempotent: AllWrites }), failing(1, errLoading, &attempts))
+	utils.AssertEqual(t, nil, store.Delete("john"))
+	utils.AssertEqual(t, int32(2), attempts)
+}
+
+func Test_Retry_Operations(t *testing.T) {
+	var attempts int32
+	store := storage.Use(memory.New(), Middleware(Config{
+		Policy:		fast,
+		Operations:	map[string]Policy{ storage.OpGet: { Attempts: 5 } },
+	}), failing(4, errLoading, &attempts))
+
+	utils.AssertEqual(t, true, store.Get("john").Miss())
+	utils.AssertEqual(t, int32(5), attempts)
+}
+
+func Test_Retry_Deadline(t *testing.T) {
+	var attempts int32
+	store := storage.Use(memory.New(), Middleware(Config{
+		Policy: Policy{ Attempts: 5, Backoff: 100 * time.Millisecond, Jitter: -1 },
+	}), failing(5, errLoading, &attempts))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	utils.AssertEqual(t, errLoading, store.GetContext(ctx, "john").Err())
+	utils.AssertEqual(t, int32(1), attempts)
+	utils.AssertEqual(t, true, time.Since(start) < 50 * time.Millisecond)
+}
+
+func Test_Retry_Backoff(t *testing.T) {
+	policy := Policy{ Jitter: 0.5 }.inherit(DefaultPolicy)
+	utils.AssertEqual(t, 3, policy.Attempts)
+	utils.AssertEqual(t, 0.5, policy.Jitter)
+
+	for i := 0; i < 100; i++ {
+		delay := policy.jitter(100 * time.Millisecond)
+		utils.AssertEqual(t, true, delay >= 50 * time.Millisecond && delay <= 150 * time.Millisecond)
+	}
+}
+
+// sqlState imitates the errors of postgres drivers
+type sqlState string
+
+func (s sqlState) Error() string {
+	return "pq: " + string(s)
+}
+
+func (s sqlState) SQLState() string {
+	return string(s)
+}
+
+func Test_Retry_Classifiers(t *testing.T) {
+	cases := []struct {
+		err		error
+		retry	bool
+	}{
+		{ nil, false },
+		{ context.Canceled, false },
+		{ fmt.Errorf("get: %w", context.DeadlineExceeded), false },
+		{ io.ErrUnexpectedEOF, true },
+		{ fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true },
+		{ errLoading, true },
+		{ errors.New("TRYAGAIN Multiple keys request during rehashing of slot"), true },
+		{ errors.New("ERR syntax error"), false },
+		{ sqlState("40P01"), true },
+		{ sqlState("08006"), true },
+		{ sqlState("23505"), false },
+		{ errors.New("Error 1213 (40001): Deadlock found when trying to get lock"), true },
+		{ errors.New("Error 1205: Lock wait timeout exceeded"), true },
+		{ errors.New("Error 1062 (23000): Duplicate entry"), false },
+		{ errors.New("invalid connection"), true },
+		{ errors.New("memcache: server error: out of memory"), true },
+		{ errors.New("memcache: cache miss"), false },
+	}
+
+	for _, c := range cases {
+		utils.AssertEqual(t, c.retry, DefaultClassifier(c.err), fmt.Sprint(c.err))
+	}
+}
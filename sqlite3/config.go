@@ -3,6 +3,7 @@ package sqlite3
 import (
 	"time"
 
+	"github.com/paul-norman/go-fiber-storage"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -38,6 +39,16 @@ type Config struct {
 	// Optional. Default is ""
 	Namespace string
 
+	// Logger for failures that happen in the background: garbage collection errors and expired values that cannot be decoded
+	//
+	// Optional. Default is storage.DefaultLogger
+	Logger storage.Logger
+
+	// Clock used for expiry and garbage collection, a clocktest.Fake lets tests expire keys without waiting
+	//
+	// Optional. Default is storage.SystemClock
+	Clock storage.Clock
+
 	// //////////////////////////////////
 	// Adaptor related config options //
 	// //////////////////////////////////
@@ -66,6 +77,8 @@ var ConfigDefault = Config{
 	Reset:				false,
 	GCInterval:			10 * time.Second,
 	Namespace:			"",
+	Logger:				storage.DefaultLogger,
+	Clock:				storage.SystemClock,
 
 	// Adaptor related config options
 	MaxOpenConns:		100,
@@ -92,7 +105,7 @@ func configDefault(config ...Config) Config {
 		cfg.Table = ConfigDefault.Table
 	}
 
-	if int(cfg.GCInterval.Seconds()) <= 0 {
+	if cfg.GCInterval <= 0 {
 		cfg.GCInterval = ConfigDefault.GCInterval
 	}
 
@@ -108,5 +121,13 @@ func configDefault(config ...Config) Config {
 		cfg.ConnMaxLifetime = ConfigDefault.ConnMaxLifetime
 	}
 
+	if cfg.Logger == nil {
+		cfg.Logger = ConfigDefault.Logger
+	}
+
+	if cfg.Clock == nil {
+		cfg.Clock = ConfigDefault.Clock
+	}
+
 	return cfg
 }
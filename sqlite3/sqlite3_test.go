@@ -1,159 +1,151 @@
 package sqlite3
 
 import (
+	"database/sql"
+	"encoding/base64"
 	"testing"
 	"time"
 
 	"github.com/gofiber/utils"
-	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/clocktest"
+	"github.com/paul-norman/go-fiber-storage/storagetest"
 )
 
 var testStore = New(Config{
 	Reset: true,
 })
 
-func Test_SQLite3_Set(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-}
-
-func Test_SQLite3_Set_Override(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
-
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	err = testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+func Test_SQLite3_Conformance(t *testing.T) {
+	// Expiry is checked against the fake clock, so the tests do not wait
+	clock := clocktest.NewFake()
+
+	storagetest.Run(t, func() storage.Storage {
+		return New(Config{
+			Table:	"fiber_storage_conformance",
+			Reset:	true,
+			Clock:	clock,
+		})
+	}, storagetest.Config{
+		Namespaced: func(namespace string) storage.Storage {
+			return New(Config{
+				Table:		"fiber_storage_conformance",
+				Namespace:	namespace,
+			})
+		},
+		Advance:	clock.Advance,
+		// Values are stored as JSON, which returns []byte values as base64 strings and slices as []any
+		Skip:		map[string]string{
+			"Types/Bytes":			"[]byte values are returned as base64 strings",
+			"Types/BoolSlice":		"slices are returned as []any",
+			"Types/IntSlice":		"slices are returned as []any",
+			"Types/Int64Slice":		"slices are returned as []any",
+			"Types/Uint64Slice":	"slices are returned as []any",
+			"Types/Float32Slice":	"slices are returned as []any",
+			"Types/Float64Slice":	"slices are returned as []any",
+			"Types/StringSlice":	"slices are returned as []any",
+		},
+	})
 }
 
-func Test_SQLite3_Get(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
+func Test_SQLite3_OnExpire(t *testing.T) {
+	var _ storage.ExpiryNotifier = &Storage{}
 
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	clock := clocktest.NewFake()
+	store := New(Config{
+		Table:		"fiber_storage_expire",
+		Reset:		true,
+		GCInterval:	time.Second,
+		Clock:		clock,
+	})
+	defer store.Close()
 
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, val, result)
-}
+	events, cancel := storage.ExpiryEvents(store, 10)
+	defer cancel()
 
-func Test_SQLite3_Set_Expiration(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-		exp = 1 * time.Second
-	)
+	utils.AssertEqual(t, nil, store.Set("john", "doe", time.Second))
+	utils.AssertEqual(t, nil, store.Set("jim", "doe"))
 
-	err := testStore.Set(key, val, exp)
-	utils.AssertEqual(t, nil, err)
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, storage.ExpiryEvent{ Key: "john", Value: "doe" }, <-events)
 
-	time.Sleep(1100 * time.Millisecond)
+	// The next tick is only taken once that garbage collection has finished
+	clock.Advance(time.Second)
+	utils.AssertEqual(t, 0, len(events))
+	utils.AssertEqual(t, true, store.Get("jim").Hit())
 }
 
-func Test_SQLite3_Get_Expired(t *testing.T) {
+func Test_SQLite3_GC(t *testing.T) {
 	var (
-		key = "john"
+		testVal = "doe"
 	)
 
-	result, err := testStore.Get(key)
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
-}
-
-func Test_SQLite3_Get_NotExist(t *testing.T) {
-
-	result, err := testStore.Get("notexist")
+	// This key should expire
+	err := testStore.Set("john", testVal, time.Millisecond)
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
-}
-
-func Test_SQLite3_Delete(t *testing.T) {
-	var (
-		key = "john"
-		val = []byte("doe")
-	)
 
-	err := testStore.Set(key, val, 0)
-	utils.AssertEqual(t, nil, err)
+	testStore.gc(time.Now().Add(time.Millisecond))
+	row := testStore.db.QueryRow(testStore.sqlSelect, "john", testStore.namespace)
+	err = row.Scan(nil, nil, nil)
+	utils.AssertEqual(t, sql.ErrNoRows, err)
 
-	err = testStore.Delete(key)
+	// This key should not expire
+	err = testStore.Set("john", testVal, 0)
 	utils.AssertEqual(t, nil, err)
 
-	result, err := testStore.Get(key)
+	testStore.gc(time.Now())
+	val, err, _ := testStore.Get("john").String()
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	utils.AssertEqual(t, testVal, val)
 }
 
-func Test_SQLite3_Reset(t *testing.T) {
-	var (
-		val = []byte("doe")
-	)
-
-	err := testStore.Set("john1", val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	err = testStore.Set("john2", val, 0)
-	utils.AssertEqual(t, nil, err)
-
-	err = testStore.Reset()
-	utils.AssertEqual(t, nil, err)
+func Test_SQLite3_Non_UTF8(t *testing.T) {
+	val := []byte("0xF5")
 
-	result, err := testStore.Get("john1")
+	err := testStore.Set("0xF6", val, 0)
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
 
-	result, err = testStore.Get("john2")
+	// Values are stored as JSON, which encodes []byte values as base64
+	result, err, _ := testStore.Get("0xF6").Bytes()
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, true, len(result) == 0)
+	utils.AssertEqual(t, []byte(base64.StdEncoding.EncodeToString(val)), result)
 }
 
-func Test_SQLite3_GC(t *testing.T) {
-	var (
-		testVal = []byte("doe")
-	)
-
-	// This key should expire
-	err := testStore.Set("john", testVal, time.Nanosecond)
-	utils.AssertEqual(t, nil, err)
-
-	testStore.gc(time.Now())
-	row := testStore.db.QueryRow(testStore.sqlSelect, "john")
-	err = row.Scan(nil, nil)
-	utils.AssertEqual(t, sqlx.ErrNoRows, err)
+func Test_SQLite3_Migrate_Seconds(t *testing.T) {
+	val := []byte(`"doe"`)
 
-	// This key should not expire
-	err = testStore.Set("john", testVal, 0)
+	// Expiries stored in seconds by an earlier version
+	expiry := time.Now().Add(time.Hour).Unix()
+	_, err := testStore.db.Exec(testStore.sqlInsert, "legacy", val, expiry, testStore.namespace)
 	utils.AssertEqual(t, nil, err)
-
-	testStore.gc(time.Now())
-	val, err := testStore.Get("john")
+	_, err = testStore.db.Exec(testStore.sqlInsert, "legacy_other", val, expiry, "other")
 	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, testVal, val)
 
-}
+	stored := func(key string) int64 {
+		var stored int64
+		err := testStore.db.QueryRow("SELECT expiry FROM fiber_storage WHERE key = ?", key).Scan(&stored)
+		utils.AssertEqual(t, nil, err)
+		return stored
+	}
 
-func Test_SQLite3_Non_UTF8(t *testing.T) {
-	val := []byte("0xF5")
+	// Opening the table again converts its namespace to milliseconds, once
+	for i := 0; i < 2; i++ {
+		store := New(Config{ DB: testStore.db })
+		store.done <- struct{}{}
+	}
+	utils.AssertEqual(t, expiry * 1000, stored("legacy"))
+	utils.AssertEqual(t, expiry, stored("legacy_other"))
 
-	err := testStore.Set("0xF6", val, 0)
+	result, err, missed := testStore.Get("legacy").String()
 	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, missed)
+	utils.AssertEqual(t, "doe", result)
 
-	result, err := testStore.Get("0xF6")
-	utils.AssertEqual(t, nil, err)
-	utils.AssertEqual(t, val, result)
+	// Other namespaces are converted when they are opened
+	store := New(Config{ DB: testStore.db, Namespace: "other" })
+	store.done <- struct{}{}
+	utils.AssertEqual(t, expiry * 1000, stored("legacy_other"))
 }
 
 func Test_SQLite3_Close(t *testing.T) {
@@ -9,6 +9,7 @@ type Storage interface {
 	Get(key string) *Result
 
 	// Set the value for the given key along with an optional expiration value, 0 means no expiration.
+	// Expiries are precise to the millisecond (see Expiry) and negative expiries flag an error.
 	// An empty key will flag an error, but empty values are allowed.
 	Set(key string, val any, expiry ...time.Duration) error
 
@@ -0,0 +1,538 @@
+// Package storagetest checks that a Storage implementation honours the documented contract.
+//
+// Drivers (including third party ones) run the suite from their own tests:
+//
+//	func Test_Redis_Conformance(t *testing.T) {
+//		storagetest.Run(t, func() storage.Storage {
+//			return New(Config{ Reset: true })
+//		})
+//	}
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+	"github.com/google/uuid"
+	"github.com/paul-norman/go-fiber-storage"
+)
+
+// Config defines the config for the suite.
+type Config struct {
+	// Creates a store that keeps its keys in the given namespace, used to check that Reset only affects its own namespace.
+	// Unlike the factory passed to Run it should not clear the underlying database.
+	//
+	// Optional. Default is nil (namespace tests are skipped)
+	Namespaced func(namespace string) storage.Storage
+
+	// Longest time an expired key may still be returned, for drivers whose expiry is only checked periodically
+	//
+	// Optional. Default is 3 * time.Second
+	ExpiryTimeout time.Duration
+
+	// Moves the storage's clock forward, so that expiry is tested without waiting.
+	// Usually the Advance method of a clocktest.Fake given to the storages made by the factory.
+	//
+	// Optional. Default is nil (the tests wait in real time)
+	Advance func(d time.Duration)
+
+	// Known failures, the tests named (e.g. "Types/Bytes") are skipped with the given reason so that the storage's
+	// deviations from the contract are reported rather than hidden
+	//
+	// Optional. Default is nil
+	Skip map[string]string
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Namespaced:		nil,
+	ExpiryTimeout:	3 * time.Second,
+	Advance:		nil,
+	Skip:			nil,
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		return ConfigDefault
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.ExpiryTimeout <= 0 {
+		cfg.ExpiryTimeout = ConfigDefault.ExpiryTimeout
+	}
+
+	return cfg
+}
+
+// Run checks the storage returned by factory against the Storage contract.
+// The factory is called once for each test and must return a new, empty storage, which is closed when the test finishes.
+func Run(t *testing.T, factory func() storage.Storage, config ...Config) {
+	t.Helper()
+
+	// Set default config
+	cfg := configDefault(config...)
+
+	open := func(t *testing.T) storage.Storage {
+		s := factory()
+		t.Cleanup(func() {
+			_ = s.Close()
+		})
+
+		return s
+	}
+
+	tests := []struct {
+		name	string
+		test	func(t *testing.T)
+	}{
+		{ "Set_Get", func(t *testing.T) { testSetGet(t, open(t)) } },
+		{ "Set_Override", func(t *testing.T) { testSetOverride(t, open(t)) } },
+		{ "Get_NotExist", func(t *testing.T) { testGetNotExist(t, open(t)) } },
+		{ "Empty_Key", func(t *testing.T) { testEmptyKey(t, open(t)) } },
+		{ "Expiry", func(t *testing.T) { testExpiry(t, open(t), cfg) } },
+		{ "Expiry_Precision", func(t *testing.T) { testExpiryPrecision(t, open(t), cfg) } },
+		{ "Delete", func(t *testing.T) { testDelete(t, open(t)) } },
+		{ "Delete_NotExist", func(t *testing.T) { testDeleteNotExist(t, open(t)) } },
+		{ "Reset", func(t *testing.T) { testReset(t, open(t)) } },
+		{ "Reset_Namespace", func(t *testing.T) { testResetNamespace(t, cfg.Namespaced) } },
+		{ "Concurrency", func(t *testing.T) { testConcurrency(t, open(t)) } },
+		{ "Types", func(t *testing.T) { testTypes(t, open(t), cfg) } },
+		{ "Context", func(t *testing.T) { testContext(t, open(t)) } },
+		{ "OnExpire", func(t *testing.T) { testOnExpire(t, open(t), cfg) } },
+		{ "Close", func(t *testing.T) { utils.AssertEqual(t, nil, factory().Close()) } },
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			skip(t, cfg, tt.name)
+			tt.test(t)
+		})
+	}
+}
+
+// skip skips the test when the config lists it as a known failure
+func skip(t *testing.T, cfg Config, name string) {
+	t.Helper()
+
+	if reason, ok := cfg.Skip[name]; ok {
+		t.Skipf("known failure: %s", reason)
+	}
+}
+
+func testSetGet(t *testing.T, s storage.Storage) {
+	err := s.Set("john", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+
+	result := s.Get("john")
+	utils.AssertEqual(t, nil, result.Err())
+	utils.AssertEqual(t, true, result.Hit())
+	utils.AssertEqual(t, false, result.Miss())
+
+	val, err, missed := result.String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, missed)
+	utils.AssertEqual(t, "doe", val)
+
+	// Omitting the expiry is the same as no expiry
+	err = s.Set("jane", "doe")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, s.Get("jane").Hit())
+}
+
+func testSetOverride(t *testing.T, s storage.Storage) {
+	err := s.Set("john", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+
+	err = s.Set("john", "smith", 0)
+	utils.AssertEqual(t, nil, err)
+
+	str, err, _ := s.Get("john").String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "smith", str)
+}
+
+func testGetNotExist(t *testing.T, s storage.Storage) {
+	result := s.Get("notexist")
+	utils.AssertEqual(t, nil, result.Err())
+	utils.AssertEqual(t, true, result.Miss())
+	utils.AssertEqual(t, false, result.Hit())
+
+	// Every accessor reports the miss without an error
+	_, err, missed := result.String()
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, missed)
+}
+
+func testEmptyKey(t *testing.T, s storage.Storage) {
+	result := s.Get("")
+	utils.AssertEqual(t, true, result.Err() != nil)
+	utils.AssertEqual(t, false, result.Miss())
+
+	utils.AssertEqual(t, true, s.Set("", "doe", 0) != nil)
+	utils.AssertEqual(t, true, s.Delete("") != nil)
+	utils.AssertEqual(t, true, s.Delete() != nil)
+
+	// No keys are deleted when any of them are empty
+	err := s.Set("john", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, s.Delete("john", "") != nil)
+	utils.AssertEqual(t, true, s.Get("john").Hit())
+}
+
+func testExpiry(t *testing.T, s storage.Storage, cfg Config) {
+	// Long enough to survive drivers that only store whole seconds
+	err := s.Set("john", "doe", 2 * time.Second)
+	utils.AssertEqual(t, nil, err)
+
+	err = s.Set("jane", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+
+	utils.AssertEqual(t, true, s.Get("john").Hit())
+
+	wait(cfg, 2 * time.Second)
+	waitForMiss(cfg, s, "john")
+
+	result := s.Get("john")
+	utils.AssertEqual(t, nil, result.Err())
+	utils.AssertEqual(t, true, result.Miss(), "key should have expired")
+
+	// Keys without an expiry are kept
+	utils.AssertEqual(t, true, s.Get("jane").Hit())
+}
+
+func testExpiryPrecision(t *testing.T, s storage.Storage, cfg Config) {
+	// Negative expiries are rejected rather than meaning "no expiry" or "already expired"
+	utils.AssertEqual(t, true, s.Set("john", "doe", -time.Second) != nil)
+
+	// Sub-second expiries must not be truncated to 0 (no expiry)
+	start := time.Now()
+	utils.AssertEqual(t, nil, s.Set("short", "doe", 500 * time.Millisecond))
+	utils.AssertEqual(t, nil, s.Set("long", "doe", 1500 * time.Millisecond))
+	utils.AssertEqual(t, true, s.Get("short").Hit())
+
+	wait(cfg, 500 * time.Millisecond)
+	waitForMiss(cfg, s, "short")
+	utils.AssertEqual(t, true, s.Get("short").Miss(), "500ms expiry should have expired")
+
+	// Fractions of a second must not be rounded down either
+	if cfg.Advance != nil {
+		cfg.Advance(500 * time.Millisecond)
+	} else if time.Since(start) < time.Second {
+		time.Sleep(time.Second - time.Since(start))
+	}
+	utils.AssertEqual(t, true, s.Get("long").Hit(), "1.5s expiry should not expire after 1s")
+
+	wait(cfg, 500 * time.Millisecond)
+	waitForMiss(cfg, s, "long")
+	utils.AssertEqual(t, true, s.Get("long").Miss(), "1.5s expiry should have expired")
+}
+
+// wait lets d pass, advancing the storage's clock when possible
+func wait(cfg Config, d time.Duration) {
+	if cfg.Advance != nil {
+		cfg.Advance(d)
+		return
+	}
+
+	time.Sleep(d)
+}
+
+// waitForMiss polls until the key is missing or ExpiryTimeout passes, a storage with an advanced clock must miss at once
+func waitForMiss(cfg Config, s storage.Storage, key string) {
+	if cfg.Advance != nil {
+		return
+	}
+
+	deadline := time.Now().Add(cfg.ExpiryTimeout)
+	for s.Get(key).Hit() && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func testDelete(t *testing.T, s storage.Storage) {
+	for _, key := range []string{ "john", "jane", "jim" } {
+		err := s.Set(key, "doe", 0)
+		utils.AssertEqual(t, nil, err)
+	}
+
+	err := s.Delete("john", "jane")
+	utils.AssertEqual(t, nil, err)
+
+	utils.AssertEqual(t, true, s.Get("john").Miss())
+	utils.AssertEqual(t, true, s.Get("jane").Miss())
+	utils.AssertEqual(t, true, s.Get("jim").Hit())
+}
+
+func testDeleteNotExist(t *testing.T, s storage.Storage) {
+	err := s.Set("john", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+
+	// Missing keys are not an error, and do not prevent the others being deleted
+	err = s.Delete("notexist")
+	utils.AssertEqual(t, nil, err)
+
+	err = s.Delete("notexist", "john")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, s.Get("john").Miss())
+}
+
+func testReset(t *testing.T, s storage.Storage) {
+	for _, key := range []string{ "john1", "john2" } {
+		err := s.Set(key, "doe", 0)
+		utils.AssertEqual(t, nil, err)
+	}
+
+	err := s.Reset()
+	utils.AssertEqual(t, nil, err)
+
+	utils.AssertEqual(t, true, s.Get("john1").Miss())
+	utils.AssertEqual(t, true, s.Get("john2").Miss())
+
+	// The storage is still usable afterwards
+	err = s.Set("john1", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, s.Get("john1").Hit())
+}
+
+func testResetNamespace(t *testing.T, namespaced func(namespace string) storage.Storage) {
+	if namespaced == nil {
+		t.Skip("no namespaced factory configured")
+	}
+
+	a := namespaced("storagetest_a")
+	b := namespaced("storagetest_b")
+	t.Cleanup(func() {
+		_ = a.Reset()
+		_ = b.Reset()
+		_ = a.Close()
+		_ = b.Close()
+	})
+
+	utils.AssertEqual(t, nil, a.Reset())
+	utils.AssertEqual(t, nil, b.Reset())
+
+	utils.AssertEqual(t, nil, a.Set("john", "doe", 0))
+	utils.AssertEqual(t, nil, b.Set("jane", "doe", 0))
+
+	// Keys are only visible in their own namespace
+	utils.AssertEqual(t, true, a.Get("jane").Miss())
+	utils.AssertEqual(t, true, b.Get("john").Miss())
+
+	utils.AssertEqual(t, nil, a.Reset())
+	utils.AssertEqual(t, true, a.Get("john").Miss())
+	utils.AssertEqual(t, true, b.Get("jane").Hit())
+}
+
+func testConcurrency(t *testing.T, s storage.Storage) {
+	const (
+		workers		= 8
+		iterations	= 50
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers * iterations * 4)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				key := fmt.Sprintf("worker%d_%d", w, i)
+				val := fmt.Sprintf("value%d", i)
+
+				if err := s.Set(key, val, 0); err != nil {
+					errs <- err
+					continue
+				}
+
+				str, err, _ := s.Get(key).String()
+				if err != nil {
+					errs <- err
+				} else if str != val {
+					errs <- fmt.Errorf("%s: expected %q, got %q", key, val, str)
+				}
+
+				// Every worker also writes and reads a key shared with all the others
+				if err := s.Set("shared", val, 0); err != nil {
+					errs <- err
+				}
+				if err := s.Get("shared").Err(); err != nil {
+					errs <- err
+				}
+
+				if i % 2 == 0 {
+					if err := s.Delete(key); err != nil {
+						errs <- err
+					}
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	utils.AssertEqual(t, true, s.Get("shared").Hit())
+	utils.AssertEqual(t, true, s.Get("worker0_0").Miss())
+	utils.AssertEqual(t, true, s.Get("worker0_1").Hit())
+}
+
+// typeTest stores value and reads it back through one of the Result accessors
+type typeTest struct {
+	name		string
+	value		any
+	get			func(r *storage.Result) (any, error)
+	optional	bool
+}
+
+// accessor adapts a typed Result accessor for use in a typeTest
+func accessor[T any](fn func(r *storage.Result) (T, error, bool)) func(r *storage.Result) (any, error) {
+	return func(r *storage.Result) (any, error) {
+		val, err, _ := fn(r)
+		return val, err
+	}
+}
+
+func testTypes(t *testing.T, s storage.Storage, cfg Config) {
+	id := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+
+	tests := []typeTest{
+		{ name: "Bool", value: true, get: accessor((*storage.Result).Bool) },
+		{ name: "Bytes", value: []byte("doe"), get: accessor((*storage.Result).Bytes) },
+		{ name: "String", value: "doe", get: accessor((*storage.Result).String) },
+		{ name: "Int", value: -42, get: accessor((*storage.Result).Int) },
+		{ name: "Int64", value: int64(-42), get: accessor((*storage.Result).Int64) },
+		{ name: "Uint64", value: uint64(42), get: accessor((*storage.Result).Uint64) },
+		{ name: "Float32", value: float32(4.25), get: accessor((*storage.Result).Float32) },
+		{ name: "Float64", value: float64(4.25), get: accessor((*storage.Result).Float64) },
+		{ name: "UUID", value: id, get: accessor((*storage.Result).UUID) },
+
+		// Drivers that only store scalars may reject slices, but slices they accept must be returned intact
+		{ name: "BoolSlice", value: []bool{ true, false }, get: accessor((*storage.Result).BoolSlice), optional: true },
+		{ name: "IntSlice", value: []int{ -1, 2 }, get: accessor((*storage.Result).IntSlice), optional: true },
+		{ name: "Int64Slice", value: []int64{ -1, 2 }, get: accessor((*storage.Result).Int64Slice), optional: true },
+		{ name: "Uint64Slice", value: []uint64{ 1, 2 }, get: accessor((*storage.Result).Uint64Slice), optional: true },
+		{ name: "Float32Slice", value: []float32{ 1.5, 2 }, get: accessor((*storage.Result).Float32Slice), optional: true },
+		{ name: "Float64Slice", value: []float64{ 1.5, 2 }, get: accessor((*storage.Result).Float64Slice), optional: true },
+		{ name: "StringSlice", value: []string{ "john", "doe" }, get: accessor((*storage.Result).StringSlice), optional: true },
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			skip(t, cfg, "Types/" + tt.name)
+
+			key := "type_" + tt.name
+
+			err := s.Set(key, tt.value, 0)
+			if err != nil && tt.optional {
+				t.Skipf("%T is not supported: %v", tt.value, err)
+			}
+			utils.AssertEqual(t, nil, err)
+
+			val, err := tt.get(s.Get(key))
+			utils.AssertEqual(t, nil, err)
+			utils.AssertEqual(t, tt.value, val)
+		})
+	}
+}
+
+// testContext checks the optional ContextStorage interface
+func testContext(t *testing.T, s storage.Storage) {
+	cs, ok := s.(storage.ContextStorage)
+	if !ok {
+		t.Skip("storage does not implement storage.ContextStorage")
+	}
+
+	ctx := context.Background()
+
+	err := cs.SetContext(ctx, "john", "doe", 0)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, cs.GetContext(ctx, "john").Hit())
+	utils.AssertEqual(t, true, cs.GetContext(ctx, "notexist").Miss())
+	utils.AssertEqual(t, true, cs.GetContext(ctx, "").Err() != nil)
+
+	// A cancelled context stops the operation
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	utils.AssertEqual(t, true, cs.GetContext(cancelled, "john").Err() != nil)
+	utils.AssertEqual(t, true, cs.SetContext(cancelled, "jane", "doe", 0) != nil)
+	utils.AssertEqual(t, true, cs.DeleteContext(cancelled, "john") != nil)
+	utils.AssertEqual(t, true, cs.ResetContext(cancelled) != nil)
+	utils.AssertEqual(t, true, cs.Get("john").Hit())
+
+	err = cs.DeleteContext(ctx, "john")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, cs.Get("john").Miss())
+
+	err = cs.ResetContext(ctx)
+	utils.AssertEqual(t, nil, err)
+}
+
+// testOnExpire checks the optional ExpiryNotifier interface, the value reported may be nil
+func testOnExpire(t *testing.T, s storage.Storage, cfg Config) {
+	n, ok := s.(storage.ExpiryNotifier)
+	if !ok {
+		t.Skip("storage does not implement storage.ExpiryNotifier")
+	}
+
+	events, cancel := storage.ExpiryEvents(n, 100)
+	defer cancel()
+
+	// Subscribers that have cancelled are not called
+	var cancelled atomic.Int32
+	n.OnExpire(func(key string, value any) {
+		cancelled.Add(1)
+	})()
+
+	utils.AssertEqual(t, nil, s.Set("expire_john", "doe", time.Second))
+	utils.AssertEqual(t, nil, s.Set("expire_jane", "doe", 0))
+
+	wait(cfg, time.Second)
+
+	event, ok := waitForEvent(cfg, events, "expire_john")
+	utils.AssertEqual(t, true, ok, "expiry was not reported")
+	if event.Value != nil {
+		utils.AssertEqual(t, "doe", event.Value)
+	}
+
+	utils.AssertEqual(t, int32(0), cancelled.Load())
+	utils.AssertEqual(t, true, s.Get("expire_jane").Hit())
+}
+
+// waitForEvent waits up to ExpiryTimeout for key to be reported, ignoring other keys. A storage with an advanced clock
+// is moved on a second at a time, so that drivers which only look for expired keys periodically find it.
+func waitForEvent(cfg Config, events <-chan storage.ExpiryEvent, key string) (storage.ExpiryEvent, bool) {
+	deadline := time.Now().Add(cfg.ExpiryTimeout)
+	for time.Now().Before(deadline) {
+		select {
+			case event := <-events:
+				if event.Key == key {
+					return event, true
+				}
+			case <-time.After(50 * time.Millisecond):
+				if cfg.Advance != nil {
+					cfg.Advance(time.Second)
+				}
+		}
+	}
+
+	return storage.ExpiryEvent{}, false
+}
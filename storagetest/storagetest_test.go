@@ -0,0 +1,167 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/clocktest"
+)
+
+// mapStorage is the smallest storage that satisfies the contract, it doubles as an example for driver authors
+type mapStorage struct {
+	mux			*sync.RWMutex
+	db			map[string]mapEntry
+	namespace	string
+	clock		storage.Clock
+}
+
+type mapEntry struct {
+	value	any
+	expiry	time.Time
+}
+
+func newMapStorage() *mapStorage {
+	return &mapStorage{ mux: &sync.RWMutex{}, db: make(map[string]mapEntry), clock: storage.SystemClock }
+}
+
+func (s *mapStorage) GetContext(ctx context.Context, key string) *storage.Result {
+	if err := ctx.Err(); err != nil {
+		return &storage.Result{ Value: nil, Error: err, Missed: false }
+	}
+
+	if len(key) <= 0 {
+		return &storage.Result{ Value: nil, Error: errors.New("storage keys cannot be zero length"), Missed: false }
+	}
+
+	s.mux.RLock()
+	e, ok := s.db[s.namespace + key]
+	s.mux.RUnlock()
+
+	if !ok || !e.expiry.IsZero() && !e.expiry.After(s.clock.Now()) {
+		return &storage.Result{ Value: nil, Error: nil, Missed: true }
+	}
+
+	return &storage.Result{ Value: e.value, Error: nil, Missed: false }
+}
+
+func (s *mapStorage) Get(key string) *storage.Result {
+	return s.GetContext(context.Background(), key)
+}
+
+func (s *mapStorage) SetContext(ctx context.Context, key string, value any, expiry ...time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(key) <= 0 {
+		return errors.New("storage keys cannot be zero length")
+	}
+
+	exp, err := storage.Expiry(expiry...)
+	if err != nil {
+		return err
+	}
+
+	e := mapEntry{ value: value }
+	if exp != 0 {
+		e.expiry = s.clock.Now().Add(exp)
+	}
+
+	s.mux.Lock()
+	s.db[s.namespace + key] = e
+	s.mux.Unlock()
+
+	return nil
+}
+
+func (s *mapStorage) Set(key string, value any, expiry ...time.Duration) error {
+	return s.SetContext(context.Background(), key, value, expiry...)
+}
+
+func (s *mapStorage) DeleteContext(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) <= 0 {
+		return errors.New("at least one key is required for Delete")
+	}
+
+	for _, key := range keys {
+		if len(key) == 0 {
+			return errors.New("storage keys cannot be zero length (no keys deleted)")
+		}
+	}
+
+	s.mux.Lock()
+	for _, key := range keys {
+		delete(s.db, s.namespace + key)
+	}
+	s.mux.Unlock()
+
+	return nil
+}
+
+func (s *mapStorage) Delete(keys ...string) error {
+	return s.DeleteContext(context.Background(), keys...)
+}
+
+func (s *mapStorage) ResetContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	for key := range s.db {
+		if strings.HasPrefix(key, s.namespace) {
+			delete(s.db, key)
+		}
+	}
+	s.mux.Unlock()
+
+	return nil
+}
+
+func (s *mapStorage) Reset() error {
+	return s.ResetContext(context.Background())
+}
+
+func (s *mapStorage) Close() error {
+	return nil
+}
+
+func Test_Storagetest_Run(t *testing.T) {
+	// Namespaced stores share one map, as they would share a database
+	shared := newMapStorage()
+
+	Run(t, func() storage.Storage {
+		return newMapStorage()
+	}, Config{
+		Namespaced: func(namespace string) storage.Storage {
+			return &mapStorage{ mux: shared.mux, db: shared.db, namespace: namespace + ":", clock: storage.SystemClock }
+		},
+	})
+}
+
+func Test_Storagetest_Chain(t *testing.T) {
+	// Middleware chains must honour the same contract as the storage they wrap
+	Run(t, func() storage.Storage {
+		return storage.Use(newMapStorage())
+	})
+}
+
+func Test_Storagetest_Advance(t *testing.T) {
+	// Expiry is checked against the fake clock, so the tests do not wait
+	clock := clocktest.NewFake()
+
+	Run(t, func() storage.Storage {
+		s := newMapStorage()
+		s.clock = clock
+		return s
+	}, Config{ Advance: clock.Advance })
+}
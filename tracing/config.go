@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"github.com/paul-norman/go-fiber-storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config defines the config for storage.
+type Config struct {
+	// Storage that will be traced
+	//
+	// Required. Default is nil
+	Storage storage.Storage
+
+	// Provider of the tracer that creates the spans
+	//
+	// Optional. Default is otel.GetTracerProvider()
+	TracerProvider trace.TracerProvider
+
+	// Backend recorded on every span (as storage.backend and db.system)
+	//
+	// Optional. Default is the package name of the wrapped storage, i.e. "redis"
+	Backend string
+
+	// Namespace recorded on every span (as storage.namespace)
+	//
+	// Optional. Default is ""
+	Namespace string
+}
+
+// ConfigDefault is the default config
+var ConfigDefault = Config{
+	Storage:		nil,
+	TracerProvider:	nil,
+	Backend:		"",
+	Namespace:		"",
+}
+
+// Helper function to set default values
+func configDefault(config ...Config) Config {
+	// Return default config if nothing provided
+	if len(config) < 1 {
+		cfg := ConfigDefault
+		cfg.TracerProvider = otel.GetTracerProvider()
+		return cfg
+	}
+
+	// Override default config
+	cfg := config[0]
+
+	// Set default values
+	if cfg.TracerProvider == nil {
+		cfg.TracerProvider = otel.GetTracerProvider()
+	}
+
+	if cfg.Backend == "" && cfg.Storage != nil {
+		cfg.Backend = backend(cfg.Storage)
+	}
+
+	return cfg
+}
@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/paul-norman/go-fiber-storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer, also recorded as the instrumentation scope of every span
+const tracerName = "github.com/paul-norman/go-fiber-storage/tracing"
+
+// New wraps Config.Storage so that every operation is recorded as a span.
+// Spans are children of the span in the context passed to the *Context methods.
+func New(config ...Config) storage.Chained {
+	// Set default config
+	cfg := configDefault(config...)
+
+	if cfg.Storage == nil {
+		panic(errors.New("tracing: a Storage to wrap is required"))
+	}
+
+	return storage.Use(cfg.Storage, Middleware(cfg))
+}
+
+// Middleware returns the tracing middleware so that it can be combined with others in storage.Use.
+// Config.Storage is optional here, it is only used to detect the Backend.
+func Middleware(config ...Config) storage.Middleware {
+	// Set default config
+	cfg := configDefault(config...)
+
+	tracer := cfg.TracerProvider.Tracer(tracerName)
+
+	// In process storage is not a remote call
+	kind := trace.SpanKindClient
+	if cfg.Backend == "memory" {
+		kind = trace.SpanKindInternal
+	}
+
+	attributes := []attribute.KeyValue{
+		attribute.String("db.system", cfg.Backend),
+		attribute.String("storage.backend", cfg.Backend),
+	}
+	if cfg.Namespace != "" {
+		attributes = append(attributes, attribute.String("storage.namespace", cfg.Namespace))
+	}
+
+	return func(next storage.Handler) storage.Handler {
+		return func(op *storage.Op) {
+			if op.Name == storage.OpClose {
+				next(op)
+				return
+			}
+
+			operation := strings.ToLower(op.Name)
+
+			ctx, span := tracer.Start(op.Context, "storage." + operation,
+				trace.WithSpanKind(kind),
+				trace.WithAttributes(attributes...),
+				trace.WithAttributes(
+					attribute.String("storage.operation", operation),
+					attribute.Int("storage.keys", len(op.Keys)),
+				),
+			)
+			defer span.End()
+
+			op.Context = ctx
+			next(op)
+
+			if op.Name == storage.OpGet && op.Err == nil && op.Result != nil {
+				span.SetAttributes(attribute.Bool("storage.hit", op.Result.Hit()))
+			}
+
+			if op.Err != nil {
+				span.RecordError(op.Err)
+				span.SetStatus(codes.Error, op.Err.Error())
+			}
+		}
+	}
+}
+
+// backend names the wrapped storage after its package, looking through wrappers and middleware chains
+func backend(s storage.Storage) string {
+	for {
+		if wrapper, ok := s.(interface{ Unwrap() storage.Storage }); ok {
+			s = wrapper.Unwrap()
+			continue
+		}
+		if wrapper, ok := s.(interface{ Conn() storage.Storage }); ok {
+			s = wrapper.Conn()
+			continue
+		}
+		break
+	}
+
+	t := reflect.TypeOf(s)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t.PkgPath() == "" {
+		return "unknown"
+	}
+
+	return path.Base(t.PkgPath())
+}
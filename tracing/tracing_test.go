@@ -0,0 +1,128 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/utils"
+	"github.com/paul-norman/go-fiber-storage"
+	"github.com/paul-norman/go-fiber-storage/memory"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTestStore returns a traced memory store along with the in-memory exporter that receives its spans
+func newTestStore() (storage.Chained, *tracetest.InMemoryExporter, trace.Tracer) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	store := New(Config{
+		Storage:        memory.New(),
+		TracerProvider: provider,
+		Namespace:      "sessions",
+	})
+
+	return store, exporter, provider.Tracer("test")
+}
+
+// attributes flattens the span attributes for easier comparison
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+
+	return attrs
+}
+
+func Test_Tracing_Child_Span(t *testing.T) {
+	store, exporter, tracer := newTestStore()
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	err := store.SetContext(ctx, "john", "doe")
+	utils.AssertEqual(t, nil, err)
+	result := store.GetContext(ctx, "john")
+	utils.AssertEqual(t, true, result.Hit())
+	parent.End()
+
+	spans := exporter.GetSpans()
+	utils.AssertEqual(t, 3, len(spans))
+
+	set, get := spans[0], spans[1]
+	utils.AssertEqual(t, "storage.set", set.Name)
+	utils.AssertEqual(t, "storage.get", get.Name)
+	utils.AssertEqual(t, parent.SpanContext().SpanID(), set.Parent.SpanID())
+	utils.AssertEqual(t, parent.SpanContext().TraceID(), get.SpanContext.TraceID())
+	utils.AssertEqual(t, trace.SpanKindInternal, get.SpanKind)
+	utils.AssertEqual(t, tracerName, get.InstrumentationLibrary.Name)
+}
+
+func Test_Tracing_Attributes(t *testing.T) {
+	store, exporter, _ := newTestStore()
+
+	_ = store.Set("john", "doe")
+	_ = store.Get("john")
+	_ = store.Get("notexist")
+	_ = store.Delete("john", "jane")
+
+	spans := exporter.GetSpans()
+	utils.AssertEqual(t, 4, len(spans))
+
+	hit := attributes(spans[1])
+	utils.AssertEqual(t, "memory", hit["storage.backend"].AsString())
+	utils.AssertEqual(t, "memory", hit["db.system"].AsString())
+	utils.AssertEqual(t, "get", hit["storage.operation"].AsString())
+	utils.AssertEqual(t, "sessions", hit["storage.namespace"].AsString())
+	utils.AssertEqual(t, int64(1), hit["storage.keys"].AsInt64())
+	utils.AssertEqual(t, true, hit["storage.hit"].AsBool())
+
+	miss := attributes(spans[2])
+	utils.AssertEqual(t, false, miss["storage.hit"].AsBool())
+
+	del := attributes(spans[3])
+	utils.AssertEqual(t, "delete", del["storage.operation"].AsString())
+	utils.AssertEqual(t, int64(2), del["storage.keys"].AsInt64())
+	_, ok := del["storage.hit"]
+	utils.AssertEqual(t, false, ok)
+}
+
+func Test_Tracing_Error(t *testing.T) {
+	store, exporter, _ := newTestStore()
+
+	err := store.Set("", "doe")
+	utils.AssertEqual(t, true, err != nil)
+
+	spans := exporter.GetSpans()
+	utils.AssertEqual(t, 1, len(spans))
+	utils.AssertEqual(t, codes.Error, spans[0].Status.Code)
+	utils.AssertEqual(t, err.Error(), spans[0].Status.Description)
+	utils.AssertEqual(t, "exception", spans[0].Events[0].Name)
+}
+
+func Test_Tracing_Backend(t *testing.T) {
+	// Detected through other wrappers
+	utils.AssertEqual(t, "memory", backend(storage.Use(memory.New())))
+
+	exporter := tracetest.NewInMemoryExporter()
+	store := storage.Use(memory.New(), Middleware(Config{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+		Backend:        "redis",
+	}))
+
+	_ = store.Reset()
+
+	spans := exporter.GetSpans()
+	utils.AssertEqual(t, "storage.reset", spans[0].Name)
+	utils.AssertEqual(t, trace.SpanKindClient, spans[0].SpanKind)
+	utils.AssertEqual(t, "redis", attributes(spans[0])["storage.backend"].AsString())
+}
+
+func Test_Tracing_Close(t *testing.T) {
+	store, exporter, _ := newTestStore()
+
+	utils.AssertEqual(t, nil, store.Close())
+	utils.AssertEqual(t, 0, len(exporter.GetSpans()))
+}